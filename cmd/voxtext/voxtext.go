@@ -60,4 +60,8 @@ func main() {
 	for i, m := range main.Materials {
 		fmt.Printf("%3d: %s\n", i, m)
 	}
+	fmt.Printf("\nlights:\n")
+	for _, l := range main.Lights {
+		fmt.Printf("    %s\n", l)
+	}
 }
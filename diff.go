@@ -0,0 +1,178 @@
+package vox
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+)
+
+// SortedVoxels returns a copy of m's voxels, sorted by z, then y, then
+// x (and by color index, for voxels at the same position). Two models
+// with the same voxels have the same sorted voxels, whatever the order
+// of their voxels in the file.
+func (m Model) SortedVoxels() []Voxel {
+	v := append([]Voxel{}, m.voxels()...)
+	sort.Slice(v, func(i, j int) bool { return voxelLess(v[i], v[j]) })
+	return v
+}
+
+func voxelLess(a, b Voxel) bool {
+	if a.Z != b.Z {
+		return a.Z < b.Z
+	}
+	if a.Y != b.Y {
+		return a.Y < b.Y
+	}
+	if a.X != b.X {
+		return a.X < b.X
+	}
+	return a.ColorIndex < b.ColorIndex
+}
+
+// Equal reports whether m and o have the same size and the same
+// voxels. The order of the voxels doesn't matter.
+func (m *Model) Equal(o *Model) bool {
+	if m.X != o.X || m.Y != o.Y || m.Z != o.Z {
+		return false
+	}
+	mv, ov := m.SortedVoxels(), o.SortedVoxels()
+	if len(mv) != len(ov) {
+		return false
+	}
+	for i := range mv {
+		if mv[i] != ov[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ChangeKind describes the kind of a Change.
+type ChangeKind int
+
+const (
+	ModelAdded      ChangeKind = 0 // A model is only in the new file.
+	ModelRemoved    ChangeKind = 1 // A model is only in the old file.
+	ModelMoved      ChangeKind = 2 // A model is unchanged, but has a different index.
+	ModelChanged    ChangeKind = 3 // The model with the same index has different voxels.
+	ColorChanged    ChangeKind = 4 // A palette entry has a different color.
+	MaterialChanged ChangeKind = 5 // A material has different properties (other than its color and Fields).
+)
+
+func (ck ChangeKind) String() string {
+	switch ck {
+	case ModelAdded:
+		return "model added"
+	case ModelRemoved:
+		return "model removed"
+	case ModelMoved:
+		return "model moved"
+	case ModelChanged:
+		return "model changed"
+	case ColorChanged:
+		return "color changed"
+	case MaterialChanged:
+		return "material changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", ck)
+}
+
+// A Change is a single difference between two .vox files, as
+// returned by Diff.
+type Change struct {
+	Kind ChangeKind
+	// Old and New are the indexes of the model or material in
+	// the old and new files. The index is -1 for a model that
+	// doesn't appear in one of the files.
+	Old, New int
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ModelAdded:
+		return fmt.Sprintf("model %d added", c.New)
+	case ModelRemoved:
+		return fmt.Sprintf("model %d removed", c.Old)
+	case ModelMoved:
+		return fmt.Sprintf("model %d moved to %d", c.Old, c.New)
+	}
+	return fmt.Sprintf("%s %d", c.Kind, c.Old)
+}
+
+// Diff returns the differences between an old file a, and a new
+// file b. Models are compared using Model.Equal, and a model that
+// appears in both files at different indexes is reported as moved.
+// The changes are returned with the model changes first, followed by
+// the material changes in order of index.
+func Diff(a, b *Main) []Change {
+	var r []Change
+
+	// Match up equal models, preferring models with the same index.
+	matchA := make([]int, len(a.Models))
+	matchB := make([]int, len(b.Models))
+	for i := range matchA {
+		matchA[i] = -1
+	}
+	for j := range matchB {
+		matchB[j] = -1
+	}
+	for i := range a.Models {
+		if i < len(b.Models) && a.Models[i].Equal(&b.Models[i]) {
+			matchA[i], matchB[i] = i, i
+		}
+	}
+	for i := range a.Models {
+		for j := range b.Models {
+			if matchA[i] == -1 && matchB[j] == -1 && a.Models[i].Equal(&b.Models[j]) {
+				matchA[i], matchB[j] = j, i
+			}
+		}
+	}
+
+	for i, j := range matchA {
+		switch {
+		case j != -1 && j != i:
+			r = append(r, Change{Kind: ModelMoved, Old: i, New: j})
+		case j == -1 && i < len(matchB) && matchB[i] == -1:
+			// Neither model at this index has a match, so treat
+			// it as the same model with different voxels.
+			matchA[i], matchB[i] = i, i
+			r = append(r, Change{Kind: ModelChanged, Old: i, New: i})
+		}
+	}
+	for i, j := range matchA {
+		if j == -1 {
+			r = append(r, Change{Kind: ModelRemoved, Old: i, New: -1})
+		}
+	}
+	for j, i := range matchB {
+		if i == -1 {
+			r = append(r, Change{Kind: ModelAdded, Old: -1, New: j})
+		}
+	}
+
+	n := len(a.Materials)
+	if len(b.Materials) > n {
+		n = len(b.Materials)
+	}
+	for i := 0; i < n; i++ {
+		var ma, mb Material
+		if i < len(a.Materials) {
+			ma = a.Materials[i]
+		}
+		if i < len(b.Materials) {
+			mb = b.Materials[i]
+		}
+		if ma.Color != mb.Color {
+			r = append(r, Change{Kind: ColorChanged, Old: i, New: i})
+		}
+		// Fields only records which properties a parsed material
+		// had, so it doesn't take part in the comparison.
+		ma.Color, mb.Color = color.RGBA{}, color.RGBA{}
+		ma.Fields, mb.Fields = 0, 0
+		if ma != mb {
+			r = append(r, Change{Kind: MaterialChanged, Old: i, New: i})
+		}
+	}
+	return r
+}
@@ -0,0 +1,106 @@
+package vox
+
+import (
+	"bytes"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestModelEqual(t *testing.T) {
+	a := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {1, 0, 0, 2}}}
+	b := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 2}, {0, 0, 0, 1}}}
+	if !a.Equal(&b) {
+		t.Errorf("%v.Equal(%v) = false, want true", a, b)
+	}
+	b.V[0].ColorIndex = 3
+	if a.Equal(&b) {
+		t.Errorf("%v.Equal(%v) = true, want false", a, b)
+	}
+	c := Model{X: 3, Y: 1, Z: 1, V: a.V}
+	if a.Equal(&c) {
+		t.Errorf("models with different sizes are equal")
+	}
+}
+
+func TestSortedVoxels(t *testing.T) {
+	m := Model{X: 2, Y: 2, Z: 2, V: []Voxel{{1, 1, 0, 1}, {0, 0, 1, 2}, {1, 0, 0, 3}, {0, 1, 0, 4}}}
+	want := []Voxel{{1, 0, 0, 3}, {0, 1, 0, 4}, {1, 1, 0, 1}, {0, 0, 1, 2}}
+	if got := m.SortedVoxels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedVoxels() = %v, want %v", got, want)
+	}
+	if m.V[0] != (Voxel{1, 1, 0, 1}) {
+		t.Errorf("SortedVoxels() changed the model's voxels")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	m0 := Model{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}
+	m1 := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 1}}}
+	m2 := Model{X: 3, Y: 1, Z: 1, V: []Voxel{{2, 0, 0, 1}}}
+	m3 := Model{X: 4, Y: 1, Z: 1, V: []Voxel{{3, 0, 0, 1}}}
+	a := &Main{Models: []Model{m0, m1, m2}}
+	b := &Main{Models: []Model{m1, m3, m2, m0}}
+	for i := 0; i < 4; i++ {
+		a.Materials = append(a.Materials, NewMaterial(MaterialDiffuse))
+		b.Materials = append(b.Materials, NewMaterial(MaterialDiffuse))
+	}
+	b.Materials[1].Color = color.RGBA{255, 0, 0, 255}
+	b.Materials[2].Type = MaterialGlass
+	b.Materials = b.Materials[:3]
+	a.Materials[3].Color = color.RGBA{0, 0, 0, 255}
+
+	got := Diff(a, b)
+	want := []Change{
+		{ModelMoved, 0, 3},
+		{ModelMoved, 1, 0},
+		{ModelAdded, -1, 1},
+		{ColorChanged, 1, 1},
+		{MaterialChanged, 2, 2},
+		{ColorChanged, 3, 3},
+		{MaterialChanged, 3, 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+
+	if got := Diff(a, a); len(got) != 0 {
+		t.Errorf("Diff(a, a) = %v, want no changes", got)
+	}
+
+	b.Models = []Model{m0, m3}
+	got = Diff(a, b)
+	want = []Change{
+		{ModelChanged, 1, 1},
+		{ModelRemoved, 2, -1},
+	}
+	if !reflect.DeepEqual(got[:2], want) {
+		t.Errorf("Diff() = %v, want %v followed by material changes", got, want)
+	}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	// Encoding and parsing a file changes nothing, even though the
+	// Fields of materials made by NewMaterial are set by parsing.
+	mains := map[string]*Main{"smallMain": smallMain()}
+	for _, filename := range []string{"testdata/test.vox", "testdata/scene.vox", "testdata/newattrs.vox"} {
+		m, err := ParseFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mains[filename] = m
+	}
+	for name, a := range mains {
+		var b bytes.Buffer
+		if err := Encode(&b, a); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := Diff(a, got); len(d) != 0 {
+			t.Errorf("%s: Diff after a round trip = %v, want no changes", name, d)
+		}
+	}
+}
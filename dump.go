@@ -0,0 +1,140 @@
+package vox
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DumpCanonical returns a text description of everything in m: its
+// models (with their voxels sorted as by SortedVoxels), materials,
+// lights, scale, layers, scene graph and custom chunks. The output
+// depends only on the contents of m, and not on the order of voxels or
+// chunks in the file it was read from, so it's useful as a golden file
+// in tests. Like Hash, it doesn't include ChunkOrder.
+func DumpCanonical(m *Main) string {
+	var b strings.Builder
+	dumpCanonical(&b, m, true)
+	return b.String()
+}
+
+// dumpCanonical writes the canonical description of m. If voxels is
+// false, each model's voxels are summarized by its hash rather than
+// listed.
+func dumpCanonical(w io.Writer, m *Main, voxels bool) {
+	fmt.Fprintf(w, "models %d\n", len(m.Models))
+	for i, model := range m.Models {
+		vs, err := model.Voxels()
+		if err != nil {
+			fmt.Fprintf(w, "model %d size %d %d %d error %v\n", i, model.X, model.Y, model.Z, err)
+			continue
+		}
+		model.V = vs
+		fmt.Fprintf(w, "model %d size %d %d %d voxels %d hash %x\n", i, model.X, model.Y, model.Z, len(vs), model.Hash())
+		if voxels {
+			for _, v := range model.SortedVoxels() {
+				fmt.Fprintf(w, "  %d %d %d %d\n", v.X, v.Y, v.Z, v.ColorIndex)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "materials %d\n", len(m.Materials))
+	for i, mat := range m.Materials {
+		c := mat.Color
+		fmt.Fprintf(w, "material %d rgba %02x%02x%02x%02x %s weight %g plastic %v rough %g spec %g ior %g attn %g flux %g ldr %g fields %x\n",
+			i, c.R, c.G, c.B, c.A, mat.Type, mat.Weight, mat.Plastic, mat.Roughness, mat.Specular, mat.IOR, mat.Attenuation, mat.Flux, mat.LDR, uint16(mat.Fields))
+	}
+
+	fmt.Fprintf(w, "lights %d\n", len(m.Lights))
+	for _, l := range m.Lights {
+		c := l.Color
+		fmt.Fprintf(w, "light %s rgba %02x%02x%02x%02x intensity %g angle %g %g area %g disk %v\n",
+			l.Type, c.R, c.G, c.B, c.A, l.Intensity, l.Angle[0], l.Angle[1], l.Area, l.Disk)
+	}
+
+	s := m.voxelScale()
+	fmt.Fprintf(w, "scale %g %g %g\n", s[0], s[1], s[2])
+
+	fmt.Fprintf(w, "layers %d\n", len(m.Scene.Layers))
+	for _, l := range m.Scene.Layers {
+		fmt.Fprintf(w, "layer %d name %q hidden %v\n", l.Index, l.Name, l.Hidden)
+	}
+
+	fmt.Fprintf(w, "scene\n")
+	if m.Scene.Node != nil {
+		d := &sceneDumper{w: w, m: m, seen: map[AnyNode]int{}}
+		d.dump(m.Scene.Node, 1)
+	}
+
+	var ids []string
+	for id := range m.CustomChunks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(w, "custom chunks %d\n", len(ids))
+	for _, id := range ids {
+		fmt.Fprintf(w, "custom %q count %d\n", id, len(m.CustomChunks[id]))
+	}
+}
+
+// sceneDumper writes the nodes of a scene graph, one per line, indented
+// by their depth.
+type sceneDumper struct {
+	w io.Writer
+	m *Main
+	// seen holds the number of each node that's been written. A node
+	// that appears more than once is written in full only the first
+	// time.
+	seen map[AnyNode]int
+}
+
+func (d *sceneDumper) dump(n AnyNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if n == nil {
+		fmt.Fprintf(d.w, "%snil\n", indent)
+		return
+	}
+	if id, ok := d.seen[n]; ok {
+		fmt.Fprintf(d.w, "%snode %d again\n", indent, id)
+		return
+	}
+	id := len(d.seen)
+	d.seen[n] = id
+
+	switch t := n.(type) {
+	case *TransformNode:
+		layer := "none"
+		if t.Layer != nil {
+			layer = fmt.Sprint(t.Layer.Index)
+		}
+		fmt.Fprintf(d.w, "%snode %d transform name %q hidden %v layer %s\n", indent, id, t.Name, t.Hidden, layer)
+		for _, tf := range t.Transforms {
+			fmt.Fprintf(d.w, "%s  frame %d r %d t %d %d %d\n", indent, tf.Frame, tf.R, tf.T[0], tf.T[1], tf.T[2])
+		}
+		d.dump(t.Child, depth+1)
+	case *GroupNode:
+		fmt.Fprintf(d.w, "%snode %d group name %q hidden %v children %d\n", indent, id, t.Name, t.Hidden, len(t.Children))
+		for _, c := range t.Children {
+			d.dump(c, depth+1)
+		}
+	case *ShapeNode:
+		fmt.Fprintf(d.w, "%snode %d shape name %q hidden %v models %d\n", indent, id, t.Name, t.Hidden, len(t.Models))
+		for i, model := range t.Models {
+			fmt.Fprintf(d.w, "%s  model %s frame %d\n", indent, d.modelRef(model), t.frame(i))
+		}
+	default:
+		fmt.Fprintf(d.w, "%snode %d %T\n", indent, id, n)
+	}
+}
+
+// modelRef returns the index of the model in Main.Models, or if it's
+// not there, its hash.
+func (d *sceneDumper) modelRef(model *Model) string {
+	for i := range d.m.Models {
+		if &d.m.Models[i] == model {
+			return fmt.Sprint(i)
+		}
+	}
+	return fmt.Sprintf("hash %x", model.Hash())
+}
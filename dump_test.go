@@ -0,0 +1,62 @@
+package vox
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden checks the canonical dump of m against the golden file,
+// or if the -update flag is set, writes the golden file. Voxels are
+// included in the dump only if voxels is true, so that golden files for
+// large models stay small.
+func checkGolden(t *testing.T, m *Main, golden string, voxels bool) {
+	t.Helper()
+	var b bytes.Buffer
+	dumpCanonical(&b, m, voxels)
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != string(want) {
+		gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+		for i := range gotLines {
+			if i >= len(wantLines) || gotLines[i] != wantLines[i] {
+				t.Fatalf("dump differs from %s at line %d:\ngot:  %s", golden, i+1, gotLines[i])
+			}
+		}
+		t.Fatalf("dump is a prefix of %s", golden)
+	}
+}
+
+func TestDumpCanonical(t *testing.T) {
+	m, err := ParseFile("testdata/test.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, m, "testdata/test.golden", true)
+
+	// Reordering voxels doesn't change the dump.
+	d := DumpCanonical(m)
+	v := m.Models[0].V
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
+	}
+	if DumpCanonical(m) != d {
+		t.Errorf("reversing the voxels changed the dump")
+	}
+	m.Models[0].V[0].ColorIndex++
+	if DumpCanonical(m) == d {
+		t.Errorf("changing a voxel didn't change the dump")
+	}
+}
@@ -0,0 +1,561 @@
+package vox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// A chunk is an encoded RIFF chunk without children.
+type chunk struct {
+	id       string
+	contents []byte
+}
+
+// newChunk returns a chunk with the given id, whose contents
+// are written by fn.
+func newChunk(id string, fn func(vw *voxWriter)) chunk {
+	var b bytes.Buffer
+	fn(&voxWriter{w: &b})
+	return chunk{id: id, contents: b.Bytes()}
+}
+
+// writeChunk writes a RIFF chunk with the given children.
+func writeChunk(vw *voxWriter, id string, contents []byte, children []chunk) {
+	n := 0
+	for _, c := range children {
+		n += 12 + len(c.contents)
+	}
+	vw.WriteBytes([]byte(id))
+	vw.WriteInt32(int32(len(contents)))
+	vw.WriteInt32(int32(n))
+	vw.WriteBytes(contents)
+	for _, c := range children {
+		writeChunk(vw, c.id, c.contents, nil)
+	}
+}
+
+// formatFloat formats a float as it's stored in a .vox DICT.
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+// formatBool formats a boolean as it's stored in a .vox DICT.
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// nodeAttrs returns the DICT of attributes of a scene node.
+func nodeAttrs(n Node) []dictEntry {
+	var d []dictEntry
+	if n.Name != "" {
+		d = append(d, dictEntry{"_name", n.Name})
+	}
+	if n.Hidden {
+		d = append(d, dictEntry{"_hidden", formatBool(true)})
+	}
+	return d
+}
+
+// sortedDict returns the entries of m, sorted by key so that the
+// output is deterministic.
+func sortedDict(m map[string]string) []dictEntry {
+	var d []dictEntry
+	for k, v := range m {
+		d = append(d, dictEntry{k, v})
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i].key < d[j].key })
+	return d
+}
+
+// encodeModelChunks returns the SIZE and XYZI chunks for the model.
+func encodeModelChunks(m Model) []chunk {
+	size := newChunk("SIZE", func(vw *voxWriter) {
+		vw.WriteInt32(int32(m.X))
+		vw.WriteInt32(int32(m.Y))
+		vw.WriteInt32(int32(m.Z))
+	})
+	xyzi := newChunk("XYZI", func(vw *voxWriter) {
+		if m.raw != nil && m.V == nil {
+			// The voxels haven't been decoded, so write them as they were.
+			vw.WriteBytes(m.raw)
+			return
+		}
+		vw.WriteInt32(int32(len(m.V)))
+		for _, v := range m.V {
+			vw.WriteBytes([]byte{v.X, v.Y, v.Z, v.ColorIndex})
+		}
+	})
+	return []chunk{size, xyzi}
+}
+
+// sceneEncoder assigns ids to the nodes of a scene graph, and
+// produces the chunks that describe it.
+type sceneEncoder struct {
+	models []Model
+	layers map[int32]bool
+	ids    map[AnyNode]int32
+	chunks []chunk
+}
+
+// modelID returns the index in the models of the model m.
+func (se *sceneEncoder) modelID(m *Model) (int32, error) {
+	for i := range se.models {
+		if &se.models[i] == m {
+			return int32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("shape node refers to a model that isn't in Main.Models")
+}
+
+// encodeNode appends the chunks for the node n and its descendants,
+// returning the id of n.
+func (se *sceneEncoder) encodeNode(n AnyNode, root bool) (int32, error) {
+	if n == nil {
+		return 0, fmt.Errorf("scene graph contains a nil node")
+	}
+	if _, ok := se.ids[n]; ok {
+		return 0, fmt.Errorf("node %v appears more than once in the scene graph", n)
+	}
+	id := int32(len(se.ids))
+	se.ids[n] = id
+	// Reserve this node's place, so that nodes appear in the same order as their ids.
+	ci := len(se.chunks)
+	se.chunks = append(se.chunks, chunk{})
+
+	switch t := n.(type) {
+	case *TransformNode:
+		if len(t.Transforms) == 0 {
+			return 0, fmt.Errorf("transform node %q has no transforms", t.Name)
+		}
+		layerID := int32(-1)
+		if !root {
+			if t.Layer == nil {
+				return 0, fmt.Errorf("non-root transform node %q has no layer", t.Name)
+			}
+			if !se.layers[t.Layer.Index] {
+				return 0, fmt.Errorf("transform node %q is on layer %d, which isn't in the scene", t.Name, t.Layer.Index)
+			}
+			layerID = t.Layer.Index
+		} else if t.Layer != nil {
+			return 0, fmt.Errorf("root transform node must not have a layer")
+		}
+		if t.Child == nil {
+			return 0, fmt.Errorf("transform node %q has no child", t.Name)
+		}
+		childID, err := se.encodeNode(t.Child, false)
+		if err != nil {
+			return 0, err
+		}
+		// Each keyframe of an animated node is written as its own frame.
+		var frames [][]dictEntry
+		for _, tf := range t.Transforms {
+			var frame []dictEntry
+			if tf.R != Matrix3x3Identity {
+				frame = append(frame, dictEntry{"_r", strconv.Itoa(int(tf.R))})
+			}
+			if tf.T != [3]int32{} {
+				frame = append(frame, dictEntry{"_t", fmt.Sprintf("%d %d %d", tf.T[0], tf.T[1], tf.T[2])})
+			}
+			if tf.Frame != 0 {
+				frame = append(frame, dictEntry{"_f", strconv.Itoa(int(tf.Frame))})
+			}
+			frames = append(frames, frame)
+		}
+		se.chunks[ci] = newChunk("nTRN", func(vw *voxWriter) {
+			vw.WriteInt32(id)
+			vw.WriteDict(nodeAttrs(t.Node))
+			vw.WriteInt32(childID)
+			vw.WriteInt32(-1)
+			vw.WriteInt32(layerID)
+			vw.WriteInt32(int32(len(frames)))
+			for _, frame := range frames {
+				vw.WriteDict(frame)
+			}
+		})
+	case *GroupNode:
+		if root {
+			return 0, fmt.Errorf("root node of the scene must be a transform node")
+		}
+		var childIDs []int32
+		for _, c := range t.Children {
+			cid, err := se.encodeNode(c, false)
+			if err != nil {
+				return 0, err
+			}
+			childIDs = append(childIDs, cid)
+		}
+		se.chunks[ci] = newChunk("nGRP", func(vw *voxWriter) {
+			vw.WriteInt32(id)
+			vw.WriteDict(nodeAttrs(t.Node))
+			vw.WriteInt32(int32(len(childIDs)))
+			for _, cid := range childIDs {
+				vw.WriteInt32(cid)
+			}
+		})
+	case *ShapeNode:
+		if root {
+			return 0, fmt.Errorf("root node of the scene must be a transform node")
+		}
+		if t.Frames != nil && len(t.Frames) != len(t.Models) {
+			return 0, fmt.Errorf("shape node %q has %d models, but %d frames", t.Name, len(t.Models), len(t.Frames))
+		}
+		if t.ModelAttrs != nil && len(t.ModelAttrs) != len(t.Models) {
+			return 0, fmt.Errorf("shape node %q has %d models, but %d model attributes", t.Name, len(t.Models), len(t.ModelAttrs))
+		}
+		var modelIDs []int32
+		for _, m := range t.Models {
+			mid, err := se.modelID(m)
+			if err != nil {
+				return 0, err
+			}
+			modelIDs = append(modelIDs, mid)
+		}
+		se.chunks[ci] = newChunk("nSHP", func(vw *voxWriter) {
+			vw.WriteInt32(id)
+			vw.WriteDict(nodeAttrs(t.Node))
+			vw.WriteInt32(int32(len(modelIDs)))
+			for i, mid := range modelIDs {
+				vw.WriteInt32(mid)
+				var attrs []dictEntry
+				if t.Frames != nil && t.Frames[i] != 0 {
+					attrs = append(attrs, dictEntry{"_f", strconv.Itoa(int(t.Frames[i]))})
+				}
+				if t.ModelAttrs != nil {
+					attrs = append(attrs, sortedDict(t.ModelAttrs[i])...)
+				}
+				vw.WriteDict(attrs)
+			}
+		})
+	default:
+		return 0, fmt.Errorf("found unexpected node of type %T", n)
+	}
+	return id, nil
+}
+
+// encodeSceneChunks returns the nTRN, nGRP, nSHP and LAYR chunks
+// that describe the scene.
+func encodeSceneChunks(m *Main) ([]chunk, error) {
+	se := &sceneEncoder{
+		models: m.Models,
+		layers: map[int32]bool{},
+		ids:    map[AnyNode]int32{},
+	}
+	for _, l := range m.Scene.Layers {
+		if se.layers[l.Index] {
+			return nil, fmt.Errorf("two layers have index %d", l.Index)
+		}
+		se.layers[l.Index] = true
+	}
+	if _, err := se.encodeNode(m.Scene.Node, true); err != nil {
+		return nil, err
+	}
+	for _, l := range m.Scene.Layers {
+		l := l
+		se.chunks = append(se.chunks, newChunk("LAYR", func(vw *voxWriter) {
+			vw.WriteInt32(l.Index)
+			vw.WriteDict(nodeAttrs(Node{Name: l.Name, Hidden: l.Hidden}))
+			vw.WriteInt32(-1)
+		}))
+	}
+	return se.chunks, nil
+}
+
+// encodeRGBAChunk returns the RGBA chunk holding the colors of
+// raw, which are in the order returned by RawPalette.
+func encodeRGBAChunk(raw [256]color.RGBA) chunk {
+	return newChunk("RGBA", func(vw *voxWriter) {
+		for _, c := range raw {
+			vw.WriteBytes([]byte{c.R, c.G, c.B, c.A})
+		}
+	})
+}
+
+// matTypeNames are the names of the material types in MATL chunks.
+var matTypeNames = map[MaterialType]string{
+	MaterialDiffuse:  "_diffuse",
+	MaterialMetal:    "_metal",
+	MaterialGlass:    "_glass",
+	MaterialEmissive: "_emit",
+}
+
+// encodeMatlChunk returns the MATL chunk for the material with the
+// given id. It reverses the scaling done by parseMatlChunk.
+func encodeMatlChunk(idx int, m Material) (chunk, error) {
+	matType, ok := matTypeNames[m.Type]
+	if !ok {
+		return chunk{}, fmt.Errorf("material %d has unknown type %v", idx, m.Type)
+	}
+	d := []dictEntry{{"_type", matType}}
+	// Only the properties that are present are written, so that a
+	// parsed material is written back with the same fields.
+	for _, e := range []struct {
+		field MaterialFields
+		entry dictEntry
+	}{
+		{FieldWeight, dictEntry{"_weight", formatFloat(m.Weight / 100)}},
+		{FieldRoughness, dictEntry{"_rough", formatFloat(m.Roughness / 100)}},
+		{FieldSpecular, dictEntry{"_spec", formatFloat(m.Specular / 100)}},
+		{FieldIOR, dictEntry{"_ior", formatFloat(m.IOR - 1)}},
+		{FieldAttenuation, dictEntry{"_att", formatFloat(m.Attenuation / 100)}},
+		{FieldFlux, dictEntry{"_flux", formatFloat(m.Flux / 100)}},
+		{FieldPlastic, dictEntry{"_plastic", formatBool(m.Plastic)}},
+		{FieldLDR, dictEntry{"_ldr", formatFloat(m.LDR / 100)}},
+	} {
+		if m.has(e.field) {
+			d = append(d, e.entry)
+		}
+	}
+	return newChunk("MATL", func(vw *voxWriter) {
+		vw.WriteInt32(int32(idx))
+		vw.WriteDict(d)
+	}), nil
+}
+
+// encodeMainChunks returns the child chunks of the MAIN chunk.
+//
+// If the main has a scene graph, the models are followed by the
+// nodes of the scene graph and its layers. Otherwise the file is
+// written in the older style, with a PACK chunk giving the number
+// of models if there's more than one.
+func encodeMainChunks(m *Main) ([]chunk, error) {
+	var chunks []chunk
+	if m.Scene.Node == nil {
+		if len(m.Scene.Layers) != 0 {
+			return nil, fmt.Errorf("scene has %d layers, but no nodes", len(m.Scene.Layers))
+		}
+		if len(m.Models) > 1 {
+			chunks = append(chunks, newChunk("PACK", func(vw *voxWriter) {
+				vw.WriteInt32(int32(len(m.Models)))
+			}))
+		}
+	}
+	for _, model := range m.Models {
+		chunks = append(chunks, encodeModelChunks(model)...)
+	}
+	if m.Scene.Node != nil {
+		sc, err := encodeSceneChunks(m)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding scene graph: %v", err)
+		}
+		chunks = append(chunks, sc...)
+	}
+	chunks = append(chunks, encodeRGBAChunk(m.RawPalette()))
+	// Like MagicaVoxel, the materials are written with ids 1 to 256,
+	// where 256 is the material of index 0 (see parseMatlChunk).
+	for i := 1; i <= len(m.Materials); i++ {
+		id, mat := i, m.Materials[i%len(m.Materials)]
+		if i == len(m.Materials) {
+			id = 256
+		}
+		c, err := encodeMatlChunk(id, mat)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	cc, err := encodeCustomChunks(m.CustomChunks)
+	if err != nil {
+		return nil, err
+	}
+	chunks = append(chunks, cc...)
+	if m.ChunkOrder != nil {
+		orderChunks(chunks, m.ChunkOrder)
+	}
+	return chunks, nil
+}
+
+// chunkGroup returns the group of chunks that must be kept together
+// that a chunk with the given ID belongs to.
+func chunkGroup(id string) string {
+	switch id {
+	case "SIZE", "XYZI":
+		// Each SIZE chunk is followed by its XYZI chunk.
+		return "SIZE"
+	case "nTRN", "nGRP", "nSHP":
+		// Scene nodes are written in the order they're found in the
+		// scene graph, which is what MagicaVoxel does too.
+		return "nTRN"
+	}
+	return id
+}
+
+// orderChunks sorts the chunks so that each group of chunks appears
+// in the same position as its first chunk in order. The order of chunks
+// in the same group is preserved, and chunks that aren't in order
+// are moved to the end.
+func orderChunks(chunks []chunk, order []string) {
+	rank := map[string]int{}
+	for _, id := range order {
+		if _, ok := rank[chunkGroup(id)]; !ok {
+			rank[chunkGroup(id)] = len(rank)
+		}
+	}
+	chunkRank := func(c chunk) int {
+		if r, ok := rank[chunkGroup(c.id)]; ok {
+			return r
+		}
+		return len(rank)
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunkRank(chunks[i]) < chunkRank(chunks[j])
+	})
+}
+
+// encodeCustomChunks returns the chunks for the values in
+// Main.CustomChunks, sorted by ID.
+func encodeCustomChunks(custom map[string][]interface{}) ([]chunk, error) {
+	var ids []string
+	for id := range custom {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var chunks []chunk
+	for _, id := range ids {
+		if len(id) != 4 {
+			return nil, fmt.Errorf("custom chunk ID %q must be 4 bytes long", id)
+		}
+		if standardChunks[id] {
+			return nil, fmt.Errorf("custom chunk has the ID %q of a standard chunk", id)
+		}
+		for _, v := range custom[id] {
+			var b []byte
+			switch v := v.(type) {
+			case []byte:
+				b = v
+			case encoding.BinaryMarshaler:
+				var err error
+				if b, err = v.MarshalBinary(); err != nil {
+					return nil, fmt.Errorf("error encoding %s chunk: %v", id, err)
+				}
+			default:
+				return nil, fmt.Errorf("can't encode %s chunk of type %T", id, v)
+			}
+			chunks = append(chunks, chunk{id: id, contents: b})
+		}
+	}
+	return chunks, nil
+}
+
+// Encode writes m to w as a magicavoxel .vox file.
+func Encode(w io.Writer, m *Main) error {
+	chunks, err := encodeMainChunks(m)
+	if err != nil {
+		return err
+	}
+	vw := &voxWriter{w: w}
+	vw.WriteBytes([]byte("VOX "))
+	vw.WriteInt32(version)
+	writeChunk(vw, "MAIN", nil, chunks)
+	return vw.Error()
+}
+
+// modelChunksSize returns the number of bytes that the SIZE and XYZI
+// chunks of the model take up, including their headers.
+func modelChunksSize(m Model) int64 {
+	n := int64(4 + 4*len(m.V))
+	if m.raw != nil && m.V == nil {
+		n = int64(len(m.raw))
+	}
+	return 12 + 12 + 12 + n
+}
+
+// EncodeStream writes the models produced by models to w as a
+// magicavoxel .vox file, with the colors in pal, without holding more
+// than one model in memory at a time. It's for generating worlds too
+// large to build as a Main and pass to Encode. pal[i] is the color of
+// palette index i, as in Main.Palette. The file has no scene graph
+// or MATL chunks, so every material is diffuse.
+//
+// models is called twice, and must produce the same models each time:
+// the first time to find the size of the file, which is written before
+// the models, and the second time to write them. It returns an error
+// if there are no models. Each call should
+// pass the models to yield in turn, stopping if it returns false.
+func EncodeStream(w io.Writer, models func(yield func(Model) bool), pal [256]color.RGBA) error {
+	count := 0
+	var modelsSize int64
+	models(func(m Model) bool {
+		count++
+		modelsSize += modelChunksSize(m)
+		return true
+	})
+	if count == 0 {
+		return fmt.Errorf("models produced no models")
+	}
+	var chunks []chunk
+	if count > 1 {
+		chunks = append(chunks, newChunk("PACK", func(vw *voxWriter) {
+			vw.WriteInt32(int32(count))
+		}))
+	}
+	chunks = append(chunks, encodeRGBAChunk(rawPalette(pal)))
+	size := modelsSize
+	for _, c := range chunks {
+		size += 12 + int64(len(c.contents))
+	}
+	if size > math.MaxInt32 {
+		return fmt.Errorf("the models take up %d bytes, which is too large for a .vox file", modelsSize)
+	}
+
+	vw := &voxWriter{w: w}
+	vw.WriteBytes([]byte("VOX "))
+	vw.WriteInt32(version)
+	vw.WriteBytes([]byte("MAIN"))
+	vw.WriteInt32(0)
+	vw.WriteInt32(int32(size))
+	if count > 1 {
+		writeChunk(vw, chunks[0].id, chunks[0].contents, nil)
+	}
+	n := 0
+	var written int64
+	models(func(m Model) bool {
+		n++
+		written += modelChunksSize(m)
+		if n > count || written > modelsSize {
+			// Stop before writing more than the MAIN chunk holds.
+			return false
+		}
+		for _, c := range encodeModelChunks(m) {
+			writeChunk(vw, c.id, c.contents, nil)
+		}
+		return vw.Error() == nil
+	})
+	if err := vw.Error(); err != nil {
+		return err
+	}
+	if n != count || written != modelsSize {
+		return fmt.Errorf("models produced different models the second time it was called")
+	}
+	rgba := chunks[len(chunks)-1]
+	writeChunk(vw, rgba.id, rgba.contents, nil)
+	return vw.Error()
+}
+
+// EncodeFile writes m to the file with the given name as a magicavoxel .vox file.
+func EncodeFile(filename string, m *Main) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := Encode(bw, m); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
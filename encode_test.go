@@ -0,0 +1,421 @@
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// describeScene returns a description of the scene graph rooted at n
+// that doesn't depend on pointer values.
+func describeScene(m *Main, n AnyNode) string {
+	var parts []string
+	switch t := n.(type) {
+	case *TransformNode:
+		layer := "-"
+		if t.Layer != nil {
+			layer = fmt.Sprint(t.Layer.Index)
+		}
+		parts = append(parts, fmt.Sprintf("T(%q %v %s %v)", t.Name, t.Hidden, layer, t.Transforms), describeScene(m, t.Child))
+	case *GroupNode:
+		parts = append(parts, fmt.Sprintf("G(%q %v)[", t.Name, t.Hidden))
+		for _, c := range t.Children {
+			parts = append(parts, describeScene(m, c))
+		}
+		parts = append(parts, "]")
+	case *ShapeNode:
+		var ids []int
+		for _, sm := range t.Models {
+			for i := range m.Models {
+				if &m.Models[i] == sm {
+					ids = append(ids, i)
+				}
+			}
+		}
+		parts = append(parts, fmt.Sprintf("S(%q %v %v %v)", t.Name, t.Hidden, ids, t.Frames))
+	default:
+		parts = append(parts, fmt.Sprintf("%T", n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, filename := range []string{"testdata/test.vox", "testdata/scene.vox", "testdata/newattrs.vox"} {
+		orig, err := ParseFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := Encode(&b, orig); err != nil {
+			t.Errorf("%s: failed to encode: %v", filename, err)
+			continue
+		}
+		got, err := Parse(&b)
+		if err != nil {
+			t.Errorf("%s: failed to parse encoded file: %v", filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Models, orig.Models) {
+			t.Errorf("%s: models differ after round trip", filename)
+		}
+		if !reflect.DeepEqual(got.Scene.Layers, orig.Scene.Layers) {
+			t.Errorf("%s: layers = %v, want %v", filename, got.Scene.Layers, orig.Scene.Layers)
+		}
+		if g, w := describeScene(got, got.Scene.Node), describeScene(orig, orig.Scene.Node); g != w {
+			t.Errorf("%s: scene = %s, want %s", filename, g, w)
+		}
+		if len(got.Materials) != len(orig.Materials) {
+			t.Errorf("%s: got %d materials, want %d", filename, len(got.Materials), len(orig.Materials))
+			continue
+		}
+		for i := range got.Materials {
+			if g, w := got.Materials[i].String(), orig.Materials[i].String(); g != w {
+				t.Errorf("%s: material %d = %s, want %s", filename, i, g, w)
+			}
+		}
+	}
+}
+
+// chunkIDs returns the ids of the child chunks of the MAIN chunk in
+// an encoded file.
+func chunkIDs(t *testing.T, b []byte) []string {
+	vr := &voxReader{r: bytes.NewReader(b[8:])}
+	_, _, cc, err := parseChunk(vr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vr = &voxReader{r: bytes.NewReader(cc)}
+	var ids []string
+	for {
+		id, _, _, err := parseChunk(vr)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestEncodePack(t *testing.T) {
+	m := &Main{
+		Models: []Model{
+			{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}},
+			{X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 2}}},
+		},
+		Materials: make([]Material, 256),
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	ids := chunkIDs(t, b.Bytes())
+	want := []string{"PACK", "SIZE", "XYZI", "SIZE", "XYZI", "RGBA"}
+	if len(ids) < len(want) || !reflect.DeepEqual(ids[:len(want)], want) {
+		t.Errorf("chunks = %v, want prefix %v", ids, want)
+	}
+
+	// Layers without a scene graph are inconsistent.
+	m.Scene.Layers = []Layer{{Index: 0}}
+	if err := Encode(&bytes.Buffer{}, m); err == nil {
+		t.Errorf("Encode succeeded with layers but no scene graph")
+	}
+}
+
+func TestEncodeSceneErrors(t *testing.T) {
+	model := Model{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}
+	m := &Main{
+		Models:    []Model{model},
+		Materials: make([]Material, 256),
+	}
+	m.Scene.Node = &TransformNode{
+		Transforms: []TransformFrame{identityFrame},
+		Child:      &ShapeNode{Models: []*Model{&model}},
+	}
+	if err := Encode(&bytes.Buffer{}, m); err == nil {
+		t.Errorf("Encode succeeded with a shape referring to a model not in Main.Models")
+	}
+	m.Scene.Node.Child = &ShapeNode{Models: []*Model{&m.Models[0]}}
+	if err := Encode(&bytes.Buffer{}, m); err != nil {
+		t.Errorf("Encode failed: %v", err)
+	}
+	m.Scene.Node.Child = &ShapeNode{Models: []*Model{&m.Models[0]}, Frames: []int32{1, 2}}
+	if err := Encode(&bytes.Buffer{}, m); err == nil {
+		t.Errorf("Encode succeeded with a shape with more frames than models")
+	}
+}
+
+func TestEncodeShapeFrames(t *testing.T) {
+	m := &Main{
+		Models:    []Model{{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}, {X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 2}}}},
+		Materials: make([]Material, 256),
+	}
+	m.Scene.Node = &TransformNode{
+		Transforms: []TransformFrame{identityFrame},
+		Child:      &ShapeNode{Models: []*Model{&m.Models[0], &m.Models[1]}, Frames: []int32{0, 5}},
+	}
+	m.Scene.Layers = []Layer{{Index: 0}}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn, ok := got.Scene.Node.Child.(*ShapeNode)
+	if !ok {
+		t.Fatalf("scene is %s, want a transform node over a shape node", describeScene(got, got.Scene.Node))
+	}
+	if want := []int32{0, 5}; !reflect.DeepEqual(sn.Frames, want) {
+		t.Errorf("after round trip, shape has frames %v, want %v", sn.Frames, want)
+	}
+}
+
+func TestEncodeChunkOrder(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, c := range splitChunks(t, orig) {
+		want = append(want, string(c[:4]))
+	}
+	m, err := ParseOptions{KeepChunkOrder: true}.Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.ChunkOrder, want) {
+		t.Fatalf("ChunkOrder = %v, want %v", m.ChunkOrder, want)
+	}
+
+	// Re-encoding gives the same order, without the rOBJ chunks
+	// which we don't write.
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	var wantWritten []string
+	for _, id := range want {
+		if id != "rOBJ" {
+			wantWritten = append(wantWritten, id)
+		}
+	}
+	if got := chunkIDs(t, b.Bytes()); !reflect.DeepEqual(got, wantWritten) {
+		t.Errorf("re-encoded chunks = %v, want %v", got, wantWritten)
+	}
+
+	// Put the palette and materials first.
+	m.ChunkOrder = append([]string{"RGBA", "MATL"}, m.ChunkOrder...)
+	b.Reset()
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got := chunkIDs(t, b.Bytes())
+	if len(got) < 258 || got[0] != "RGBA" || got[1] != "MATL" || got[257] != "SIZE" {
+		t.Errorf("reordered file starts with chunks %v, want RGBA, 256 MATL, then SIZE", got[:3])
+	}
+	if _, err := (ParseOptions{Lenient: true}).Parse(&b); err != nil {
+		t.Errorf("failed to parse reordered file: %v", err)
+	}
+}
+
+func TestEncodeMaterialFields(t *testing.T) {
+	// An emissive material with only its type and _ldr set.
+	c := newChunk("MATL", func(vw *voxWriter) {
+		vw.WriteInt32(1)
+		vw.WriteDict([]dictEntry{{"_type", "_emit"}, {"_ldr", "0.5"}})
+	})
+	_, mat, err := parseMatlChunk(c.contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := FieldType | FieldLDR; mat.Fields != want {
+		t.Errorf("parsed material has fields %x, want %x", mat.Fields, want)
+	}
+	if got, want := mat.String(), "Mat{rgba:00000000, emissive, ldr:50.0}"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	enc, err := encodeMatlChunk(1, mat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc.contents, c.contents) {
+		t.Errorf("encoded MATL chunk is %q, want %q", enc.contents, c.contents)
+	}
+
+	// Properties set after parsing are written, even though they
+	// were missing.
+	edited := mat
+	edited.Flux = 200
+	edited.Type = MaterialGlass
+	edited.Attenuation = 25
+	enc, err = encodeMatlChunk(1, edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := parseMatlChunk(enc.contents); err != nil {
+		t.Error(err)
+	} else if got.Flux != 200 || got.Attenuation != 25 || got.LDR != 50 || got.Type != MaterialGlass {
+		t.Errorf("edited material was encoded as %v, want flux 200, attenuation 25 and ldr 50", got)
+	}
+
+	// Missing properties aren't shown, even if they don't have the
+	// default values.
+	glass := newChunk("MATL", func(vw *voxWriter) {
+		vw.WriteInt32(2)
+		vw.WriteDict([]dictEntry{{"_type", "_glass"}})
+	})
+	if _, mat, err := parseMatlChunk(glass.contents); err != nil {
+		t.Error(err)
+	} else if got, want := mat.String(), "Mat{rgba:00000000, glass}"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// A material with no fields set has all its properties written.
+	enc, err = encodeMatlChunk(1, NewMaterial(MaterialEmissive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, mat, err = parseMatlChunk(enc.contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := MaterialFields(1<<9 - 1); mat.Fields != want {
+		t.Errorf("material from NewMaterial has fields %x after round trip, want %x", mat.Fields, want)
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	gen := func(n int) func(yield func(Model) bool) {
+		return func(yield func(Model) bool) {
+			for i := 0; i < n; i++ {
+				m := Model{X: i + 1, Y: 1, Z: 1}
+				for x := 0; x <= i; x++ {
+					m.V = append(m.V, Voxel{uint8(x), 0, 0, uint8(i + 1)})
+				}
+				if !yield(m) {
+					return
+				}
+			}
+		}
+	}
+	var pal [256]color.RGBA
+	pal[1] = color.RGBA{255, 0, 0, 255}
+	pal[255] = color.RGBA{1, 2, 3, 4}
+	for _, n := range []int{1, 3} {
+		var b bytes.Buffer
+		if err := EncodeStream(&b, gen(n), pal); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Parse(&b)
+		if err != nil {
+			t.Fatalf("failed to parse stream of %d models: %v", n, err)
+		}
+		if len(m.Models) != n {
+			t.Fatalf("stream of %d models parsed as %d models", n, len(m.Models))
+		}
+		var want []Model
+		gen(n)(func(m Model) bool {
+			want = append(want, m)
+			return true
+		})
+		for i := range want {
+			if vs, _ := m.Models[i].Voxels(); m.Models[i].X != want[i].X || !reflect.DeepEqual(vs, want[i].V) {
+				t.Errorf("model %d of %d is %v, want %v", i, n, m.Models[i], want[i])
+			}
+		}
+		if m.Materials[1].Color != pal[1] || m.Materials[255].Color != pal[255] {
+			t.Errorf("stream of %d models has colors %v and %v, want %v and %v", n, m.Materials[1].Color, m.Materials[255].Color, pal[1], pal[255])
+		}
+	}
+
+	if err := EncodeStream(ioutil.Discard, gen(0), pal); err == nil {
+		t.Errorf("EncodeStream with no models succeeded")
+	}
+	// A generator that gives different models each time is an error.
+	calls := 0
+	changing := func(yield func(Model) bool) {
+		calls++
+		gen(calls)(yield)
+	}
+	if err := EncodeStream(ioutil.Discard, changing, pal); err == nil {
+		t.Errorf("EncodeStream with different models each time succeeded")
+	}
+}
+
+func TestRawPalette(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/test.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := splitChunks(t, orig)
+	var rgba []byte
+	for _, c := range chunks {
+		if string(c[:4]) == "RGBA" {
+			rgba = c
+		}
+	}
+	if rgba == nil {
+		t.Fatal("no RGBA chunk found")
+	}
+	// Set the last entry, which no voxel can use.
+	copy(rgba[len(rgba)-4:], []byte{1, 2, 3, 4})
+	m, err := Parse(bytes.NewReader(joinChunks(chunks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := m.RawPalette()
+	for i, c := range raw {
+		if got := rgba[12+4*i : 16+4*i]; !bytes.Equal(got, []byte{c.R, c.G, c.B, c.A}) {
+			t.Fatalf("RawPalette()[%d] = %v, want %v", i, c, got)
+		}
+	}
+	if got, want := m.Materials[0].Color, (color.RGBA{1, 2, 3, 4}); got != want {
+		t.Errorf("color of index 0 is %v, want %v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range splitChunks(t, b.Bytes()) {
+		if string(c[:4]) == "RGBA" && !bytes.Equal(c, rgba) {
+			t.Errorf("re-encoded RGBA chunk differs from the original")
+		}
+	}
+}
+
+func TestEncodeMaterialIDs(t *testing.T) {
+	// MagicaVoxel writes the materials with ids 1 to 256, and they
+	// must be written back with the same ids, in the same order.
+	orig, err := ioutil.ReadFile("testdata/newattrs.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	matIDs := func(b []byte) []int32 {
+		var r []int32
+		for _, c := range splitChunks(t, b) {
+			if string(c[:4]) == "MATL" {
+				r = append(r, int32(binary.LittleEndian.Uint32(c[12:])))
+			}
+		}
+		return r
+	}
+	if got, want := matIDs(b.Bytes()), matIDs(orig); !reflect.DeepEqual(got, want) {
+		t.Errorf("MATL chunks have ids %v, want %v", got, want)
+	}
+}
@@ -1,8 +1,10 @@
 package vox
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -40,6 +42,21 @@ func (d *dict) AssertNoUnreadFields() error {
 	return nil
 }
 
+// UnreadFields returns the fields in the dict that haven't been read,
+// or nil if there are none.
+func (d *dict) UnreadFields() map[string]string {
+	var r map[string]string
+	for k, v := range d.d {
+		if !d.read[k] {
+			if r == nil {
+				r = map[string]string{}
+			}
+			r[k] = v
+		}
+	}
+	return r
+}
+
 // Read3xInt32 returns 3 int32s read from the dict, defaulting to def.
 func (d *dict) Read3xInt32(name string, def [3]int32) [3]int32 {
 	d.read[name] = true
@@ -59,7 +76,7 @@ func (d *dict) Read3xInt32(name string, def [3]int32) [3]int32 {
 	for i, p := range parts {
 		x, err := strconv.ParseInt(p, 10, 32)
 		if err != nil {
-			d.err = fmt.Errorf("error parsing 3xint32 %q in field %q: %v", r, name, err)
+			d.err = fmt.Errorf("error parsing 3xint32 %q in field %q: %w", r, name, err)
 			return def
 		}
 		rv[i] = int32(x)
@@ -67,6 +84,46 @@ func (d *dict) Read3xInt32(name string, def [3]int32) [3]int32 {
 	return rv
 }
 
+// readFloats reads len(rv) space-separated floats from the dict into
+// rv, leaving rv unchanged if the field isn't present.
+func (d *dict) readFloats(name string, rv []float32) {
+	d.read[name] = true
+	if d.err != nil {
+		return
+	}
+	r, ok := d.d[name]
+	if !ok {
+		return
+	}
+	parts := strings.Split(r, " ")
+	if len(parts) != len(rv) {
+		d.err = fmt.Errorf("error parsing %dxfloat %q in field %q", len(rv), r, name)
+		return
+	}
+	var fs []float32
+	for _, p := range parts {
+		x, err := strconv.ParseFloat(p, 32)
+		if err != nil {
+			d.err = fmt.Errorf("error parsing %dxfloat %q in field %q: %w", len(rv), r, name, err)
+			return
+		}
+		fs = append(fs, float32(x))
+	}
+	copy(rv, fs)
+}
+
+// Read2xFloat returns 2 floats read from the dict, defaulting to def.
+func (d *dict) Read2xFloat(name string, def [2]float32) [2]float32 {
+	d.readFloats(name, def[:])
+	return def
+}
+
+// Read3xFloat returns 3 floats read from the dict, defaulting to def.
+func (d *dict) Read3xFloat(name string, def [3]float32) [3]float32 {
+	d.readFloats(name, def[:])
+	return def
+}
+
 // ReadMatrix3x3 returns a 3x3 matrix, read from the dict, defaulting
 // to 'def'.
 func (d *dict) ReadMatrix3x3(name string, def Matrix3x3) Matrix3x3 {
@@ -83,7 +140,7 @@ func (d *dict) ReadMatrix3x3(name string, def Matrix3x3) Matrix3x3 {
 	}
 	x, err := strconv.ParseInt(r, 10, 8)
 	if err != nil {
-		d.err = fmt.Errorf("error parsing matrix %q in field %q: %v", r, name, err)
+		d.err = fmt.Errorf("error parsing matrix %q in field %q: %w", r, name, err)
 		return def
 	}
 	rv := Matrix3x3(x)
@@ -94,6 +151,25 @@ func (d *dict) ReadMatrix3x3(name string, def Matrix3x3) Matrix3x3 {
 	return rv
 }
 
+// ReadInt returns an int32, read from the dict, defaulting
+// to 'def'.
+func (d *dict) ReadInt(name string, def int32) int32 {
+	d.read[name] = true
+	if d.err != nil {
+		return def
+	}
+	r, ok := d.d[name]
+	if !ok {
+		return def
+	}
+	x, err := strconv.ParseInt(r, 10, 32)
+	if err != nil {
+		d.err = fmt.Errorf("error parsing int32 %q in field %q: %w", r, name, err)
+		return def
+	}
+	return int32(x)
+}
+
 // ReadFloat returns a float, read from the dict, defaulting
 // to 'def'.
 func (d *dict) ReadFloat(name string, def float32) float32 {
@@ -107,7 +183,7 @@ func (d *dict) ReadFloat(name string, def float32) float32 {
 	}
 	f, err := strconv.ParseFloat(r, 32)
 	if err != nil {
-		d.err = fmt.Errorf("error parsing float %q in field %q: %v", r, name, err)
+		d.err = fmt.Errorf("error parsing float %q in field %q: %w", r, name, err)
 		return def
 	}
 	return float32(f)
@@ -135,6 +211,10 @@ func (d *dict) ReadString(name string, def string) string {
 	return r
 }
 
+// maxPrealloc is the largest read that voxReader allocates
+// space for before reading.
+const maxPrealloc = 1 << 20
+
 // voxReader provides help for reading .vox-styled
 // RIFF files.
 // The reader can be used after error (although default
@@ -144,6 +224,15 @@ func (d *dict) ReadString(name string, def string) string {
 type voxReader struct {
 	r   io.Reader
 	err error
+	off int64 // the offset in the file of the next byte to be read.
+
+	scratch [4]byte // used to read scalars without allocating.
+}
+
+// Offset returns the offset in the file of the next
+// byte to be read.
+func (vr *voxReader) Offset() int64 {
+	return vr.off
 }
 
 // Error() returns the first error (if any) encountered
@@ -168,30 +257,99 @@ func (vr *voxReader) RequireEOF(chunk string) {
 
 // ReadBytes reads n bytes from the input.
 func (vr *voxReader) ReadBytes(n int) []byte {
+	if n < 0 {
+		if vr.err == nil {
+			vr.err = fmt.Errorf("can't read %d bytes", n)
+		}
+		return nil
+	}
+	if n > maxPrealloc {
+		// The length may have come from a corrupt file, so rather than
+		// allocate all of it up front, let the buffer grow as data arrives.
+		if vr.err != nil {
+			return nil
+		}
+		var b bytes.Buffer
+		var read int64
+		read, vr.err = io.CopyN(&b, vr.r, int64(n))
+		vr.off += read
+		if vr.err == io.EOF {
+			vr.err = io.ErrUnexpectedEOF
+		}
+		return b.Bytes()
+	}
 	r := make([]byte, n)
 	if vr.err != nil {
 		return r
 	}
-	_, vr.err = io.ReadFull(vr.r, r)
+	var read int
+	read, vr.err = io.ReadFull(vr.r, r)
+	vr.off += int64(read)
 	return r
 }
 
+// Skip reads and discards n bytes from the input.
+func (vr *voxReader) Skip(n int64) {
+	if vr.err != nil {
+		return
+	}
+	if n < 0 {
+		vr.err = fmt.Errorf("can't skip %d bytes", n)
+		return
+	}
+	var read int64
+	read, vr.err = io.CopyN(io.Discard, vr.r, n)
+	vr.off += read
+	if vr.err == io.EOF {
+		vr.err = io.ErrUnexpectedEOF
+	}
+}
+
+// readScratch reads n bytes (at most 4) into the scratch
+// buffer, and returns them. After an error, the bytes returned
+// are all zero.
+func (vr *voxReader) readScratch(n int) []byte {
+	b := vr.scratch[:n]
+	if vr.err != nil {
+		vr.scratch = [4]byte{}
+		return b
+	}
+	var read int
+	read, vr.err = io.ReadFull(vr.r, b)
+	vr.off += int64(read)
+	if vr.err != nil {
+		vr.scratch = [4]byte{}
+	}
+	return b
+}
+
 // ReadUint8 reads a uint8 from the input.
 func (vr *voxReader) ReadUint8() uint8 {
-	return vr.ReadBytes(1)[0]
+	return vr.readScratch(1)[0]
 }
 
 // ReadInt32 reads a int32 from the input.
 func (vr *voxReader) ReadInt32() int32 {
-	b := vr.ReadBytes(4)
+	b := vr.readScratch(4)
 	u := uint32(b[0]) + uint32(b[1])<<8 + uint32(b[2])<<16 + uint32(b[3])<<24
 	return int32(u)
 }
 
+// ReadFloat32 reads a float32 from the input.
+func (vr *voxReader) ReadFloat32() float32 {
+	return math.Float32frombits(uint32(vr.ReadInt32()))
+}
+
 // ReadString reads a .vox-formatted STRING from
 // the input.
 func (vr *voxReader) ReadString() string {
 	n := int(vr.ReadInt32())
+	if n < 0 {
+		if vr.err == nil {
+			vr.err = fmt.Errorf("string has negative length %d", n)
+		}
+		return ""
+	}
 	bs := vr.ReadBytes(n)
 	return string(bs)
 }
@@ -200,9 +358,12 @@ func (vr *voxReader) ReadString() string {
 func (vr *voxReader) ReadDict() *dict {
 	d := &dict{d: map[string]string{}, read: map[string]bool{}}
 	n := int(vr.ReadInt32())
-	for i := 0; i < n; i++ {
+	for i := 0; i < n && vr.err == nil; i++ {
 		key := vr.ReadString()
 		val := vr.ReadString()
+		if _, ok := d.d[key]; ok && vr.err == nil {
+			vr.err = fmt.Errorf("duplicate key %q in dict", key)
+		}
 		d.d[key] = val
 	}
 	if err := vr.Error(); err != nil {
@@ -210,3 +371,63 @@ func (vr *voxReader) ReadDict() *dict {
 	}
 	return d
 }
+
+// voxWriter provides help for writing .vox-styled
+// RIFF files. Like voxReader, errors are not explicitly
+// returned, and writes after an error do nothing. The
+// first error can be checked using vw.Error().
+type voxWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Error returns the first error (if any) encountered
+// by the writer.
+func (vw *voxWriter) Error() error {
+	return vw.err
+}
+
+// WriteBytes writes b to the output.
+func (vw *voxWriter) WriteBytes(b []byte) {
+	if vw.err != nil {
+		return
+	}
+	_, vw.err = vw.w.Write(b)
+}
+
+// WriteUint8 writes a uint8 to the output.
+func (vw *voxWriter) WriteUint8(x uint8) {
+	vw.WriteBytes([]byte{x})
+}
+
+// WriteInt32 writes a little-endian int32 to the output.
+func (vw *voxWriter) WriteInt32(x int32) {
+	u := uint32(x)
+	vw.WriteBytes([]byte{byte(u), byte(u >> 8), byte(u >> 16), byte(u >> 24)})
+}
+
+// WriteFloat32 writes a little-endian IEEE 754 float32 to the output.
+func (vw *voxWriter) WriteFloat32(f float32) {
+	vw.WriteInt32(int32(math.Float32bits(f)))
+}
+
+// WriteString writes s as a .vox-formatted STRING.
+func (vw *voxWriter) WriteString(s string) {
+	vw.WriteInt32(int32(len(s)))
+	vw.WriteBytes([]byte(s))
+}
+
+// dictEntry is a single key-value pair in a DICT.
+type dictEntry struct {
+	key, value string
+}
+
+// WriteDict writes the entries as a .vox-formatted DICT.
+// The entries are written in the order given.
+func (vw *voxWriter) WriteDict(d []dictEntry) {
+	vw.WriteInt32(int32(len(d)))
+	for _, e := range d {
+		vw.WriteString(e.key)
+		vw.WriteString(e.value)
+	}
+}
@@ -0,0 +1,61 @@
+package vox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadDict(t *testing.T) {
+	testCases := []struct {
+		entries []dictEntry
+		wantErr string
+	}{
+		{[]dictEntry{{"_name", "a"}, {"_hidden", "1"}}, ""},
+		{[]dictEntry{{"_name", "a"}, {"_hidden", "1"}, {"_name", "b"}}, `duplicate key "_name"`},
+	}
+	for _, tc := range testCases {
+		var b bytes.Buffer
+		vw := &voxWriter{w: &b}
+		vw.WriteDict(tc.entries)
+		vr := &voxReader{r: &b}
+		d := vr.ReadDict()
+		err := d.Error()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("ReadDict(%v) gave error %v", tc.entries, err)
+			} else if got := d.ReadString("_name", ""); got != "a" {
+				t.Errorf("ReadDict(%v) has _name %q, want %q", tc.entries, got, "a")
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("ReadDict(%v) gave error %v, want error containing %q", tc.entries, err, tc.wantErr)
+		}
+		if vr.Error() == nil {
+			t.Errorf("ReadDict(%v) didn't set the reader's error", tc.entries)
+		}
+	}
+}
+
+func TestDictReadInt(t *testing.T) {
+	d := &dict{d: map[string]string{"_f": "12", "_neg": "-3", "_bad": "1.5", "_big": "3000000000"}, read: map[string]bool{}}
+	if got := d.ReadInt("_f", 0); got != 12 {
+		t.Errorf("ReadInt(_f) = %d, want 12", got)
+	}
+	if got := d.ReadInt("_neg", 0); got != -3 {
+		t.Errorf("ReadInt(_neg) = %d, want -3", got)
+	}
+	if got := d.ReadInt("_missing", 7); got != 7 {
+		t.Errorf("ReadInt(_missing) = %d, want the default 7", got)
+	}
+	if d.Error() != nil {
+		t.Fatalf("unexpected error: %v", d.Error())
+	}
+	for _, name := range []string{"_bad", "_big"} {
+		d.err = nil
+		if got := d.ReadInt(name, 5); got != 5 || d.Error() == nil {
+			t.Errorf("ReadInt(%s) = %d with error %v, want the default and an error", name, got, d.Error())
+		}
+	}
+}
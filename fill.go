@@ -0,0 +1,166 @@
+package vox
+
+// neighbors6 and neighbors26 are the offsets to the neighbors of a
+// voxel that share a face, and that share a face, edge or corner.
+var (
+	neighbors6  = faceDirs[:]
+	neighbors26 [][3]int
+)
+
+func init() {
+	for x := -1; x <= 1; x++ {
+		for y := -1; y <= 1; y++ {
+			for z := -1; z <= 1; z++ {
+				if x != 0 || y != 0 || z != 0 {
+					neighbors26 = append(neighbors26, [3]int{x, y, z})
+				}
+			}
+		}
+	}
+}
+
+// Neighbors6 returns the material indexes of the six voxels that share
+// a face with c, in the order of the FaceDir values: index FaceNegX is
+// the voxel at c - (1, 0, 0), and so on. Voxels outside the world have
+// index 0, like empty voxels.
+func (d *DenseWorld) Neighbors6(c [3]int) [6]uint8 {
+	var r [6]uint8
+	for i, off := range neighbors6 {
+		r[i], _ = d.MaterialIndex(addVec(c, off))
+	}
+	return r
+}
+
+// Neighbors26 returns the material indexes of the 26 voxels that share
+// a face, an edge or a corner with c. They're ordered by x, then y,
+// then z offset, so the first is the voxel at c - (1, 1, 1) and the
+// last is the voxel at c + (1, 1, 1). Voxels outside the world have
+// index 0, like empty voxels.
+func (d *DenseWorld) Neighbors26(c [3]int) [26]uint8 {
+	var r [26]uint8
+	for i, off := range neighbors26 {
+		r[i], _ = d.MaterialIndex(addVec(c, off))
+	}
+	return r
+}
+
+// morph returns a copy of d, in which each voxel for which change
+// returns true is set to idx.
+func (d *DenseWorld) morph(idx uint8, change func(v uint8, neighbors [6]uint8) bool) *DenseWorld {
+	r := &DenseWorld{Min: d.Min, Max: d.Max, Voxels: append([]uint8{}, d.Voxels...)}
+	i := 0
+	for z := d.Min[2]; z <= d.Max[2]; z++ {
+		for y := d.Min[1]; y <= d.Max[1]; y++ {
+			for x := d.Min[0]; x <= d.Max[0]; x++ {
+				if change(d.Voxels[i], d.Neighbors6([3]int{x, y, z})) {
+					r.Voxels[i] = idx
+				}
+				i++
+			}
+		}
+	}
+	return r
+}
+
+// Dilate returns a copy of d, in which every empty voxel that shares a
+// face with a non-empty voxel is set to matIdx. It grows each piece of
+// the world by one voxel, and fills in single-voxel holes.
+func (d *DenseWorld) Dilate(matIdx uint8) *DenseWorld {
+	return d.morph(matIdx, func(v uint8, neighbors [6]uint8) bool {
+		return v == 0 && neighbors != [6]uint8{}
+	})
+}
+
+// Erode returns a copy of d, in which every non-empty voxel that shares
+// a face with an empty voxel (or the edge of the world) is made empty.
+// It shrinks each piece of the world by one voxel, and removes
+// single-voxel noise. Dilating after eroding (or eroding after
+// dilating) smooths a world while mostly keeping its shape.
+func (d *DenseWorld) Erode() *DenseWorld {
+	return d.morph(0, func(v uint8, neighbors [6]uint8) bool {
+		if v == 0 {
+			return false
+		}
+		for _, n := range neighbors {
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// fill visits the voxels connected to start for which match returns
+// true, calling visit for each. Voxels are connected if they are
+// neighbors according to the given offsets. match must return false for
+// voxels that have already been visited.
+func (d *DenseWorld) fill(start [3]int, neighbors [][3]int, match func(i int) bool, visit func(i int)) {
+	i, ok := d.index(start)
+	if !ok || !match(i) {
+		return
+	}
+	visit(i)
+	queue := [][3]int{start}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, off := range neighbors {
+			n := addVec(c, off)
+			if i, ok := d.index(n); ok && match(i) {
+				visit(i)
+				queue = append(queue, n)
+			}
+		}
+	}
+}
+
+// ConnectedComponents labels each non-empty voxel with the connected
+// piece of the world that it's part of. Two non-empty voxels are in the
+// same piece if there's a path between them through non-empty voxels,
+// moving between voxels that share a face if sixConnected is true, or
+// that share a face, an edge or a corner if it's false.
+// It returns a label for each voxel, stored in the same order as
+// d.Voxels, and the number of pieces. Empty voxels have label 0, and
+// the pieces are labeled from 1.
+func (d *DenseWorld) ConnectedComponents(sixConnected bool) ([]int, int) {
+	neighbors := neighbors26
+	if sixConnected {
+		neighbors = neighbors6
+	}
+	labels := make([]int, len(d.Voxels))
+	n := 0
+	for z := d.Min[2]; z <= d.Max[2]; z++ {
+		for y := d.Min[1]; y <= d.Max[1]; y++ {
+			for x := d.Min[0]; x <= d.Max[0]; x++ {
+				c := [3]int{x, y, z}
+				if i, _ := d.index(c); d.Voxels[i] == 0 || labels[i] != 0 {
+					continue
+				}
+				n++
+				d.fill(c, neighbors, func(i int) bool {
+					return d.Voxels[i] != 0 && labels[i] == 0
+				}, func(i int) {
+					labels[i] = n
+				})
+			}
+		}
+	}
+	return labels, n
+}
+
+// FloodFill sets every voxel connected to start that has the same
+// material index as start to newIdx, like the bucket tool in a paint
+// program. Voxels are connected if they share a face. Filling an empty
+// voxel fills the empty region around it, up to the edges of the world.
+// If start is outside the world, FloodFill does nothing.
+func (d *DenseWorld) FloodFill(start [3]int, newIdx uint8) {
+	old, ok := d.MaterialIndex(start)
+	if !ok || old == newIdx {
+		return
+	}
+	d.fill(start, neighbors6, func(i int) bool {
+		return d.Voxels[i] == old
+	}, func(i int) {
+		d.Voxels[i] = newIdx
+	})
+}
@@ -0,0 +1,139 @@
+package vox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNeighbors(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{0, 1, 1}, 1)
+	dw.SetMaterialIndex([3]int{1, 1, 2}, 2)
+	dw.SetMaterialIndex([3]int{2, 2, 2}, 3)
+	if got, want := dw.Neighbors6([3]int{1, 1, 1}), [6]uint8{1, 0, 0, 0, 0, 2}; got != want {
+		t.Errorf("Neighbors6(1, 1, 1) = %v, want %v", got, want)
+	}
+	if got, want := dw.Neighbors6([3]int{2, 2, 2}), [6]uint8{0, 0, 0, 0, 0, 0}; got != want {
+		t.Errorf("Neighbors6(2, 2, 2) = %v, want %v", got, want)
+	}
+	n := dw.Neighbors26([3]int{1, 1, 1})
+	if n[0] != 0 || n[25] != 3 {
+		t.Errorf("Neighbors26(1, 1, 1) = %v, want first 0 and last 3", n)
+	}
+	sum := 0
+	for _, idx := range n {
+		sum += int(idx)
+	}
+	if sum != 6 {
+		t.Errorf("Neighbors26(1, 1, 1) = %v, want indexes 1, 2 and 3", n)
+	}
+}
+
+func TestDilateErode(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{4, 4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{2, 2, 2}, 1)
+	dil := dw.Dilate(5)
+	if n := countNonEmpty(dil); n != 7 {
+		t.Errorf("dilating a single voxel gave %d voxels, want 7", n)
+	}
+	if idx, _ := dil.MaterialIndex([3]int{2, 2, 2}); idx != 1 {
+		t.Errorf("dilating changed the original voxel to %d", idx)
+	}
+	if idx, _ := dil.MaterialIndex([3]int{2, 3, 2}); idx != 5 {
+		t.Errorf("dilated voxel has index %d, want 5", idx)
+	}
+	if n := countNonEmpty(dw); n != 1 {
+		t.Errorf("Dilate changed the original world")
+	}
+
+	// Eroding the dilated voxel gives back the original voxel.
+	if er := dil.Erode(); !reflect.DeepEqual(er, dw) {
+		t.Errorf("eroding a dilated voxel gave %v, want %v", er.Voxels, dw.Voxels)
+	}
+	// A 3x3x3 cube erodes to its center voxel.
+	cube, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{4, 4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 1; x <= 3; x++ {
+		for y := 1; y <= 3; y++ {
+			for z := 1; z <= 3; z++ {
+				cube.SetMaterialIndex([3]int{x, y, z}, 2)
+			}
+		}
+	}
+	if er := cube.Erode(); countNonEmpty(er) != 1 {
+		t.Errorf("eroding a cube left %d voxels, want 1", countNonEmpty(er))
+	}
+}
+
+func countNonEmpty(d *DenseWorld) int {
+	n := 0
+	for _, v := range d.Voxels {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConnectedComponents(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{3, 3, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two voxels joined by a face, one touching them diagonally,
+	// and one on its own.
+	for _, c := range [][3]int{{0, 0, 0}, {1, 0, 0}, {2, 1, 0}, {0, 3, 0}} {
+		dw.SetMaterialIndex(c, 1)
+	}
+	for _, tc := range []struct {
+		six  bool
+		want int
+	}{{true, 3}, {false, 2}} {
+		labels, n := dw.ConnectedComponents(tc.six)
+		if n != tc.want {
+			t.Errorf("ConnectedComponents(%v) found %d components, want %d", tc.six, n, tc.want)
+		}
+		label := func(c [3]int) int {
+			i, _ := dw.index(c)
+			return labels[i]
+		}
+		if label([3]int{0, 0, 0}) != label([3]int{1, 0, 0}) || label([3]int{0, 0, 0}) == 0 {
+			t.Errorf("ConnectedComponents(%v): face neighbors have labels %d and %d", tc.six, label([3]int{0, 0, 0}), label([3]int{1, 0, 0}))
+		}
+		if got := label([3]int{3, 3, 0}); got != 0 {
+			t.Errorf("ConnectedComponents(%v): empty voxel has label %d, want 0", tc.six, got)
+		}
+	}
+}
+
+func TestFloodFill(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{2, 2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A wall down the middle, with a different color at the bottom.
+	dw.SetMaterialIndex([3]int{1, 0, 0}, 2)
+	dw.SetMaterialIndex([3]int{1, 1, 0}, 1)
+	dw.SetMaterialIndex([3]int{1, 2, 0}, 1)
+
+	dw.FloodFill([3]int{0, 0, 0}, 5)
+	dw.FloodFill([3]int{1, 2, 0}, 7)
+	want := []uint8{
+		5, 2, 0,
+		5, 7, 0,
+		5, 7, 0,
+	}
+	for i, v := range dw.Voxels {
+		if v != want[i] {
+			t.Fatalf("after flood fill, voxels = %v, want %v", dw.Voxels, want)
+		}
+	}
+}
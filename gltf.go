@@ -0,0 +1,383 @@
+package vox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// The parts of a glTF 2.0 document that WriteGLTF uses.
+// See https://registry.khronos.org/glTF/specs/2.0/glTF-2.0.html
+
+type gltfDoc struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes,omitempty"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes,omitempty"`
+}
+
+type gltfNode struct {
+	Name     string       `json:"name,omitempty"`
+	Matrix   *[16]float64 `json:"matrix,omitempty"`
+	Scale    *[3]float64  `json:"scale,omitempty"`
+	Mesh     *int         `json:"mesh,omitempty"`
+	Children []int        `json:"children,omitempty"`
+}
+
+type gltfMesh struct {
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   int            `json:"material"`
+}
+
+type gltfMaterial struct {
+	Name           string      `json:"name,omitempty"`
+	PBR            gltfPBR     `json:"pbrMetallicRoughness"`
+	EmissiveFactor *[3]float64 `json:"emissiveFactor,omitempty"`
+	AlphaMode      string      `json:"alphaMode,omitempty"`
+}
+
+type gltfPBR struct {
+	BaseColorFactor [4]float64 `json:"baseColorFactor"`
+	MetallicFactor  float64    `json:"metallicFactor"`
+	RoughnessFactor float64    `json:"roughnessFactor"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri"`
+}
+
+const (
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+)
+
+// gltfWriter accumulates the parts of a glTF document.
+type gltfWriter struct {
+	doc       gltfDoc
+	buf       bytes.Buffer
+	materials map[uint8]int // palette index to glTF material
+	meshes    map[*Model]*int
+	main      *Main
+	opts      ExportOptions
+}
+
+// addData appends the little-endian encoding of data to the buffer,
+// and returns a new accessor for it.
+func (gw *gltfWriter) addData(data interface{}, count int, componentType int, typ string, target int) int {
+	off := gw.buf.Len()
+	binary.Write(&gw.buf, binary.LittleEndian, data)
+	gw.doc.BufferViews = append(gw.doc.BufferViews, gltfBufferView{
+		ByteOffset: off,
+		ByteLength: gw.buf.Len() - off,
+		Target:     target,
+	})
+	gw.doc.Accessors = append(gw.doc.Accessors, gltfAccessor{
+		BufferView:    len(gw.doc.BufferViews) - 1,
+		ComponentType: componentType,
+		Count:         count,
+		Type:          typ,
+	})
+	return len(gw.doc.Accessors) - 1
+}
+
+// srgbToLinear converts an 8-bit sRGB color component to linear space,
+// which is what glTF color factors use.
+func srgbToLinear(c uint8) float64 {
+	f := float64(c) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// material returns the glTF material for the palette index.
+func (gw *gltfWriter) material(idx uint8) int {
+	if mi, ok := gw.materials[idx]; ok {
+		return mi
+	}
+	var mat Material
+	if int(idx) < len(gw.main.Materials) {
+		mat = gw.main.Materials[idx]
+	}
+	c := mat.Color
+	gm := gltfMaterial{
+		Name: fmt.Sprintf("color%d", idx),
+		PBR: gltfPBR{
+			BaseColorFactor: [4]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B), 1},
+			RoughnessFactor: 1,
+		},
+	}
+	switch mat.Type {
+	case MaterialMetal:
+		gm.PBR.MetallicFactor = float64(mat.Weight) / 100
+		gm.PBR.RoughnessFactor = float64(mat.Roughness) / 100
+	case MaterialGlass:
+		gm.PBR.BaseColorFactor[3] = 1 - float64(mat.Weight)/100
+		gm.PBR.RoughnessFactor = float64(mat.Roughness) / 100
+		gm.AlphaMode = "BLEND"
+	case MaterialEmissive:
+		gm.EmissiveFactor = &[3]float64{gm.PBR.BaseColorFactor[0], gm.PBR.BaseColorFactor[1], gm.PBR.BaseColorFactor[2]}
+	}
+	gw.doc.Materials = append(gw.doc.Materials, gm)
+	gw.materials[idx] = len(gw.doc.Materials) - 1
+	return gw.materials[idx]
+}
+
+// mesh returns the glTF mesh for the model, or nil if the model
+// has no voxels. The mesh is placed so that voxel (size-1)/2 of the
+// model (rounding down) has its lowest corner at the origin, which is
+// where DenseWorldFromModel puts it relative to the translation of
+// the model's transform.
+func (gw *gltfWriter) mesh(m *Model) (*int, error) {
+	if mi, ok := gw.meshes[m]; ok {
+		return mi, nil
+	}
+	dw, err := modelWorld(*m)
+	if err != nil {
+		return nil, err
+	}
+	dw = gw.opts.visible(dw)
+	byMat := map[uint8][]Face{}
+	for _, f := range dw.ExposedFaces() {
+		byMat[f.MaterialIndex] = append(byMat[f.MaterialIndex], f)
+	}
+	if len(byMat) == 0 {
+		gw.meshes[m] = nil
+		return nil, nil
+	}
+	var idxs []int
+	for idx := range byMat {
+		idxs = append(idxs, int(idx))
+	}
+	sort.Ints(idxs)
+
+	center := [3]float32{float32((m.X - 1) / 2), float32((m.Y - 1) / 2), float32((m.Z - 1) / 2)}
+	var mesh gltfMesh
+	for _, idx := range idxs {
+		faces := byMat[uint8(idx)]
+		pos := make([][3]float32, 0, 4*len(faces))
+		norm := make([][3]float32, 0, 4*len(faces))
+		ind := make([]uint32, 0, 6*len(faces))
+		min := []float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+		max := []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+		for _, f := range faces {
+			n := uint32(len(pos))
+			fd := f.Dir.Normal()
+			for _, c := range faceCorners(f.Pos, f.Dir) {
+				p := [3]float32{float32(c[0]) - center[0], float32(c[1]) - center[1], float32(c[2]) - center[2]}
+				for i := range p {
+					min[i] = math.Min(min[i], float64(p[i]))
+					max[i] = math.Max(max[i], float64(p[i]))
+				}
+				pos = append(pos, p)
+				norm = append(norm, [3]float32{float32(fd[0]), float32(fd[1]), float32(fd[2])})
+			}
+			ind = append(ind, n, n+1, n+2, n, n+2, n+3)
+		}
+		pa := gw.addData(pos, len(pos), gltfFloat, "VEC3", gltfArrayBuffer)
+		gw.doc.Accessors[pa].Min = min
+		gw.doc.Accessors[pa].Max = max
+		na := gw.addData(norm, len(norm), gltfFloat, "VEC3", gltfArrayBuffer)
+		ia := gw.addData(ind, len(ind), gltfUnsignedInt, "SCALAR", gltfElementArray)
+		mesh.Primitives = append(mesh.Primitives, gltfPrimitive{
+			Attributes: map[string]int{"POSITION": pa, "NORMAL": na},
+			Indices:    ia,
+			Material:   gw.material(uint8(idx)),
+		})
+	}
+	gw.doc.Meshes = append(gw.doc.Meshes, mesh)
+	mi := len(gw.doc.Meshes) - 1
+	gw.meshes[m] = &mi
+	return &mi, nil
+}
+
+// addNode adds a glTF node, returning its index.
+func (gw *gltfWriter) addNode(n gltfNode) int {
+	gw.doc.Nodes = append(gw.doc.Nodes, n)
+	return len(gw.doc.Nodes) - 1
+}
+
+// gltfMatrix returns the column-major glTF matrix for the transform,
+// or nil if it's the identity.
+func gltfMatrix(tf TransformFrame) *[16]float64 {
+	if tf == identityFrame {
+		return nil
+	}
+	var r [16]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[j*4+i] = float64(tf.R.Get(i, j))
+		}
+		r[12+i] = float64(tf.T[i])
+	}
+	r[15] = 1
+	return &r
+}
+
+// sceneNode adds the glTF nodes for the scene node n and its visible
+// descendants. It returns false if n is hidden.
+func (gw *gltfWriter) sceneNode(n AnyNode) (int, bool, error) {
+	switch t := n.(type) {
+	case *TransformNode:
+		if t.Hidden || (t.Layer != nil && t.Layer.Hidden) {
+			return 0, false, nil
+		}
+		if len(t.Transforms) == 0 {
+			return 0, false, fmt.Errorf("transform node %q has no transforms", t.Name)
+		}
+		gn := gltfNode{Name: t.Name, Matrix: gltfMatrix(t.Transforms[0])}
+		if t.Child != nil {
+			c, ok, err := gw.sceneNode(t.Child)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				gn.Children = []int{c}
+			}
+		}
+		return gw.addNode(gn), true, nil
+	case *GroupNode:
+		if t.Hidden {
+			return 0, false, nil
+		}
+		gn := gltfNode{Name: t.Name}
+		for _, child := range t.Children {
+			c, ok, err := gw.sceneNode(child)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				gn.Children = append(gn.Children, c)
+			}
+		}
+		return gw.addNode(gn), true, nil
+	case *ShapeNode:
+		if t.Hidden {
+			return 0, false, nil
+		}
+		gn := gltfNode{Name: t.Name}
+		for _, m := range t.Models {
+			mi, err := gw.mesh(m)
+			if err != nil {
+				return 0, false, err
+			}
+			if mi == nil {
+				continue
+			}
+			if len(t.Models) == 1 {
+				gn.Mesh = mi
+			} else {
+				gn.Children = append(gn.Children, gw.addNode(gltfNode{Mesh: mi}))
+			}
+		}
+		return gw.addNode(gn), true, nil
+	}
+	return 0, false, fmt.Errorf("found unexpected node of type %T", n)
+}
+
+// WriteGLTF writes the visible parts of the scene in m as a glTF 2.0
+// document, with the binary data embedded in the document.
+//
+// Each model becomes a mesh, with one primitive for each palette
+// color it uses, and only the faces of voxels that aren't covered by
+// other voxels in the same model. The scene graph becomes a tree of glTF
+// nodes with the same transforms, so models that are used more than once
+// share their mesh. If m has no scene graph, each model is placed at
+// the origin. Coordinates are the same as in the .vox file, so the Z
+// axis is up (see ExportOptions.YUp), and if m.Scale is set, the scene
+// is scaled by it.
+func WriteGLTF(w io.Writer, m *Main) error {
+	return ExportOptions{}.WriteGLTF(w, m)
+}
+
+// WriteGLTF is like the package-level WriteGLTF, but uses the options
+// in o.
+func (o ExportOptions) WriteGLTF(w io.Writer, m *Main) error {
+	gw := &gltfWriter{
+		doc: gltfDoc{
+			Asset: gltfAsset{Version: "2.0", Generator: "github.com/paulhankin/vox"},
+		},
+		materials: map[uint8]int{},
+		meshes:    map[*Model]*int{},
+		main:      m,
+		opts:      o,
+	}
+	var roots []int
+	if m.Scene.Node != nil {
+		r, ok, err := gw.sceneNode(m.Scene.Node)
+		if err != nil {
+			return err
+		}
+		if ok {
+			roots = append(roots, r)
+		}
+	} else {
+		for i := range m.Models {
+			mi, err := gw.mesh(&m.Models[i])
+			if err != nil {
+				return err
+			}
+			roots = append(roots, gw.addNode(gltfNode{Mesh: mi}))
+		}
+	}
+	if s := m.voxelScale(); s != [3]float32{1, 1, 1} && len(roots) > 0 {
+		// Scale the whole scene by the size of a voxel.
+		scale := &[3]float64{float64(s[0]), float64(s[1]), float64(s[2])}
+		roots = []int{gw.addNode(gltfNode{Scale: scale, Children: roots})}
+	}
+	if o.YUp && len(roots) > 0 {
+		roots = []int{gw.addNode(gltfNode{Matrix: gltfMatrix(TransformFrame{R: yUpMatrix}), Children: roots})}
+	}
+	gw.doc.Scenes = []gltfScene{{Nodes: roots}}
+	if gw.buf.Len() > 0 {
+		gw.doc.Buffers = []gltfBuffer{{
+			ByteLength: gw.buf.Len(),
+			URI:        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(gw.buf.Bytes()),
+		}}
+	}
+	enc := json.NewEncoder(w)
+	return enc.Encode(&gw.doc)
+}
@@ -0,0 +1,199 @@
+package vox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteGLTF(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteGLTF(&b, main); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode glTF: %v", err)
+	}
+	if len(doc.Meshes) != len(main.Models) {
+		t.Errorf("got %d meshes, want %d", len(doc.Meshes), len(main.Models))
+	}
+	if len(doc.Scenes) != 1 || len(doc.Scenes[0].Nodes) != 1 {
+		t.Fatalf("got scenes %v, want one scene with one root node", doc.Scenes)
+	}
+	// The root transform, the group, and a transform and shape for each model.
+	if want := 2 + 2*len(main.Models); len(doc.Nodes) != want {
+		t.Errorf("got %d nodes, want %d", len(doc.Nodes), want)
+	}
+	if len(doc.Buffers) != 1 {
+		t.Fatalf("got %d buffers, want 1", len(doc.Buffers))
+	}
+	prefix := "data:application/octet-stream;base64,"
+	if !strings.HasPrefix(doc.Buffers[0].URI, prefix) {
+		t.Fatalf("buffer has uri %.50q, want a base64 data uri", doc.Buffers[0].URI)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(doc.Buffers[0].URI, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != doc.Buffers[0].ByteLength {
+		t.Errorf("buffer has %d bytes, but byteLength %d", len(data), doc.Buffers[0].ByteLength)
+	}
+	for i, a := range doc.Accessors {
+		bv := doc.BufferViews[a.BufferView]
+		if bv.ByteOffset+bv.ByteLength > len(data) {
+			t.Errorf("accessor %d: buffer view %v is outside of the buffer", i, bv)
+		}
+		size := 4
+		if a.Type == "VEC3" {
+			size = 12
+		}
+		if a.Count*size != bv.ByteLength {
+			t.Errorf("accessor %d: %d elements of type %s don't fill buffer view of length %d", i, a.Count, a.Type, bv.ByteLength)
+		}
+	}
+	for _, m := range doc.Meshes {
+		for _, p := range m.Primitives {
+			if p.Material < 0 || p.Material >= len(doc.Materials) {
+				t.Errorf("primitive refers to missing material %d", p.Material)
+			}
+		}
+	}
+}
+
+func TestFaceCorners(t *testing.T) {
+	// The corners of each face must wind counter-clockwise around the
+	// outward normal.
+	for dir, n := range faceDirs {
+		c := faceCorners([3]int{0, 0, 0}, FaceDir(dir))
+		var e1, e2 [3]int
+		for i := 0; i < 3; i++ {
+			e1[i] = c[1][i] - c[0][i]
+			e2[i] = c[2][i] - c[1][i]
+		}
+		cross := [3]int{e1[1]*e2[2] - e1[2]*e2[1], e1[2]*e2[0] - e1[0]*e2[2], e1[0]*e2[1] - e1[1]*e2[0]}
+		if cross != n {
+			t.Errorf("face %d has corners %v with normal %v, want %v", dir, c, cross, n)
+		}
+	}
+}
+
+func TestWriteGLTFScale(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main.Scale = [3]float32{2, 2, 0.5}
+	var b bytes.Buffer
+	if err := WriteGLTF(&b, main); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode glTF: %v", err)
+	}
+	if len(doc.Scenes) != 1 || len(doc.Scenes[0].Nodes) != 1 {
+		t.Fatalf("got scenes %v, want one scene with one root node", doc.Scenes)
+	}
+	root := doc.Nodes[doc.Scenes[0].Nodes[0]]
+	if want := [3]float64{2, 2, 0.5}; root.Scale == nil || *root.Scale != want {
+		t.Errorf("root node has scale %v, want %v", root.Scale, want)
+	}
+}
+
+func TestWriteGLTFYUp(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := (ExportOptions{YUp: true}).WriteGLTF(&b, main); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode glTF: %v", err)
+	}
+	if len(doc.Scenes) != 1 || len(doc.Scenes[0].Nodes) != 1 {
+		t.Fatalf("got scenes %v, want one scene with one root node", doc.Scenes)
+	}
+	// The root node maps (x, y, z) to (x, z, -y).
+	want := [16]float64{1, 0, 0, 0, 0, 0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 1}
+	if root := doc.Nodes[doc.Scenes[0].Nodes[0]]; root.Matrix == nil || *root.Matrix != want {
+		t.Errorf("root node has matrix %v, want %v", root.Matrix, want)
+	}
+}
+
+func TestWriteGLTFTransparent(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Making every color transparent leaves no meshes.
+	opts := ExportOptions{Transparent: map[uint8]bool{}}
+	for i := 1; i < 256; i++ {
+		opts.Transparent[uint8(i)] = true
+	}
+	var b bytes.Buffer
+	if err := opts.WriteGLTF(&b, main); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode glTF: %v", err)
+	}
+	if len(doc.Meshes) != 0 || len(doc.Materials) != 0 {
+		t.Errorf("got %d meshes and %d materials, want none", len(doc.Meshes), len(doc.Materials))
+	}
+}
+
+func TestWriteGLTFPlacement(t *testing.T) {
+	// A model with even sizes must be placed where SceneToDenseWorld
+	// puts it.
+	model := Model{X: 4, Y: 2, Z: 6}
+	for x := 0; x < model.X; x++ {
+		for y := 0; y < model.Y; y++ {
+			for z := 0; z < model.Z; z++ {
+				model.V = append(model.V, Voxel{X: uint8(x), Y: uint8(y), Z: uint8(z), ColorIndex: 1})
+			}
+		}
+	}
+	main := &Main{}
+	main.AddModel(model, TransformFrame{R: Matrix3x3Identity, T: [3]int32{5, -3, 2}}, 0)
+	dw, err := SceneToDenseWorld(main.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteGLTF(&b, main); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode glTF: %v", err)
+	}
+	var tr [3]float64
+	for _, n := range doc.Nodes {
+		if n.Matrix != nil {
+			tr = [3]float64{n.Matrix[12], n.Matrix[13], n.Matrix[14]}
+		}
+	}
+	if len(doc.Meshes) != 1 || len(doc.Meshes[0].Primitives) != 1 {
+		t.Fatalf("got meshes %v, want one mesh with one primitive", doc.Meshes)
+	}
+	pos := doc.Accessors[doc.Meshes[0].Primitives[0].Attributes["POSITION"]]
+	for i := 0; i < 3; i++ {
+		if got, want := tr[i]+pos.Min[i], float64(dw.Min[i]); got != want {
+			t.Errorf("axis %d: glTF model starts at %v, want %v", i, got, want)
+		}
+		if got, want := tr[i]+pos.Max[i], float64(dw.Max[i]+1); got != want {
+			t.Errorf("axis %d: glTF model ends at %v, want %v", i, got, want)
+		}
+	}
+}
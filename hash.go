@@ -0,0 +1,197 @@
+package vox
+
+import (
+	"crypto/sha256"
+	"hash/fnv"
+)
+
+// Hash returns the SHA-256 hash of a canonical form of m: its size
+// and its voxels, sorted as by SortedVoxels. Models that are Equal
+// have the same hash.
+func (m Model) Hash() [32]byte {
+	h := sha256.New()
+	vw := &voxWriter{w: h}
+	writeCanonicalModel(vw, m)
+	var r [32]byte
+	h.Sum(r[:0])
+	return r
+}
+
+// Hash returns the SHA-256 hash of a canonical form of m: its models
+// (with their voxels sorted, so that the order of voxels in a model
+// doesn't matter), materials, lights, scale, layers and scene graph. Files
+// with the same hash have the same content, although they may differ
+// in ways that don't matter, such as the order of their chunks.
+// CustomChunks and ChunkOrder aren't included in the hash.
+func (m *Main) Hash() [32]byte {
+	h := sha256.New()
+	hw := &sceneHasher{
+		vw:    &voxWriter{w: h},
+		m:     m,
+		nodes: map[AnyNode]int32{},
+	}
+	hw.writeMain()
+	var r [32]byte
+	h.Sum(r[:0])
+	return r
+}
+
+// Checksum returns a 64-bit FNV-1a hash of d's bounds and voxels. It's
+// cheaper than comparing two worlds, and is useful for noticing whether
+// d has changed, but unlike Hash, different worlds may (rarely) have
+// the same checksum.
+func (d *DenseWorld) Checksum() uint64 {
+	h := fnv.New64a()
+	vw := &voxWriter{w: h}
+	for _, c := range [][3]int{d.Min, d.Max} {
+		for _, x := range c {
+			vw.WriteInt32(int32(x))
+		}
+	}
+	vw.WriteBytes(d.Voxels)
+	return h.Sum64()
+}
+
+func writeCanonicalModel(vw *voxWriter, m Model) {
+	vw.WriteInt32(int32(m.X))
+	vw.WriteInt32(int32(m.Y))
+	vw.WriteInt32(int32(m.Z))
+	vs := m.SortedVoxels()
+	vw.WriteInt32(int32(len(vs)))
+	for _, v := range vs {
+		vw.WriteBytes([]byte{v.X, v.Y, v.Z, v.ColorIndex})
+	}
+}
+
+// sceneHasher writes the canonical form of a Main.
+type sceneHasher struct {
+	vw *voxWriter
+	m  *Main
+	// nodes holds the nodes that have been written, and the order
+	// in which they were written. A node that appears more than once
+	// in the scene graph is written in full only the first time.
+	nodes map[AnyNode]int32
+}
+
+// Tags that identify the parts of the canonical form.
+const (
+	hashTransform = 't'
+	hashGroup     = 'g'
+	hashShape     = 's'
+	hashSeen      = 'r'
+	hashNil       = 'n'
+)
+
+func (sh *sceneHasher) writeMain() {
+	vw := sh.vw
+	vw.WriteInt32(int32(len(sh.m.Models)))
+	for _, model := range sh.m.Models {
+		writeCanonicalModel(vw, model)
+	}
+	vw.WriteInt32(int32(len(sh.m.Materials)))
+	for _, mat := range sh.m.Materials {
+		vw.WriteBytes([]byte{mat.Color.R, mat.Color.G, mat.Color.B, mat.Color.A})
+		vw.WriteInt32(int32(mat.Type))
+		vw.WriteUint8(boolByte(mat.Plastic))
+		vw.WriteInt32(int32(mat.Fields))
+		for _, f := range []float32{mat.Weight, mat.Roughness, mat.Specular, mat.IOR, mat.Attenuation, mat.Flux, mat.LDR} {
+			vw.WriteFloat32(f)
+		}
+	}
+	vw.WriteInt32(int32(len(sh.m.Lights)))
+	for _, l := range sh.m.Lights {
+		vw.WriteInt32(int32(l.Type))
+		vw.WriteBytes([]byte{l.Color.R, l.Color.G, l.Color.B, l.Color.A})
+		vw.WriteUint8(boolByte(l.Disk))
+		for _, f := range []float32{l.Intensity, l.Angle[0], l.Angle[1], l.Area} {
+			vw.WriteFloat32(f)
+		}
+	}
+	for _, f := range sh.m.voxelScale() {
+		vw.WriteFloat32(f)
+	}
+	vw.WriteInt32(int32(len(sh.m.Scene.Layers)))
+	for _, l := range sh.m.Scene.Layers {
+		vw.WriteInt32(l.Index)
+		vw.WriteString(l.Name)
+		vw.WriteUint8(boolByte(l.Hidden))
+	}
+	if sh.m.Scene.Node == nil {
+		vw.WriteUint8(hashNil)
+		return
+	}
+	sh.writeNode(sh.m.Scene.Node)
+}
+
+func (sh *sceneHasher) writeNode(n AnyNode) {
+	vw := sh.vw
+	if n == nil {
+		vw.WriteUint8(hashNil)
+		return
+	}
+	if id, ok := sh.nodes[n]; ok {
+		vw.WriteUint8(hashSeen)
+		vw.WriteInt32(id)
+		return
+	}
+	sh.nodes[n] = int32(len(sh.nodes))
+	writeNode := func(tag byte, node Node) {
+		vw.WriteUint8(tag)
+		vw.WriteString(node.Name)
+		vw.WriteUint8(boolByte(node.Hidden))
+	}
+	switch t := n.(type) {
+	case *TransformNode:
+		writeNode(hashTransform, t.Node)
+		if t.Layer == nil {
+			vw.WriteUint8(0)
+		} else {
+			vw.WriteUint8(1)
+			vw.WriteInt32(t.Layer.Index)
+		}
+		vw.WriteInt32(int32(len(t.Transforms)))
+		for _, tf := range t.Transforms {
+			vw.WriteUint8(uint8(tf.R))
+			for _, x := range tf.T {
+				vw.WriteInt32(x)
+			}
+			vw.WriteInt32(tf.Frame)
+		}
+		sh.writeNode(t.Child)
+	case *GroupNode:
+		writeNode(hashGroup, t.Node)
+		vw.WriteInt32(int32(len(t.Children)))
+		for _, c := range t.Children {
+			sh.writeNode(c)
+		}
+	case *ShapeNode:
+		writeNode(hashShape, t.Node)
+		vw.WriteInt32(int32(len(t.Models)))
+		for i, model := range t.Models {
+			sh.writeModelRef(model)
+			vw.WriteInt32(t.frame(i))
+		}
+	}
+}
+
+// writeModelRef writes the index of the model in Main.Models, or if
+// it's not there, the model itself.
+func (sh *sceneHasher) writeModelRef(model *Model) {
+	for i := range sh.m.Models {
+		if &sh.m.Models[i] == model {
+			sh.vw.WriteInt32(int32(i))
+			return
+		}
+	}
+	sh.vw.WriteInt32(-1)
+	if model != nil {
+		writeCanonicalModel(sh.vw, *model)
+	}
+}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
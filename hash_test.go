@@ -0,0 +1,98 @@
+package vox
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestModelHash(t *testing.T) {
+	a := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {1, 0, 0, 2}}}
+	b := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 2}, {0, 0, 0, 1}}}
+	if a.Hash() != b.Hash() {
+		t.Errorf("models with the same voxels in a different order have different hashes")
+	}
+	b.V[0].ColorIndex = 3
+	if a.Hash() == b.Hash() {
+		t.Errorf("models with different voxels have the same hash")
+	}
+	c := Model{X: 2, Y: 2, Z: 1, V: a.V}
+	if a.Hash() == c.Hash() {
+		t.Errorf("models with different sizes have the same hash")
+	}
+}
+
+func TestMainHash(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := main.Hash()
+
+	// Re-encoding the file and reversing the voxels in each model
+	// doesn't change the hash.
+	var buf bytes.Buffer
+	if err := Encode(&buf, main); err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Encode doesn't write lights or the scale.
+	other.Lights = main.Lights
+	other.Scale = main.Scale
+	for _, m := range other.Models {
+		for i, j := 0, len(m.V)-1; i < j; i, j = i+1, j-1 {
+			m.V[i], m.V[j] = m.V[j], m.V[i]
+		}
+	}
+	if got := other.Hash(); got != h {
+		t.Errorf("re-encoded file has hash %x, want %x", got, h)
+	}
+
+	other.Materials[5].Color.R++
+	if other.Hash() == h {
+		t.Errorf("changing a color didn't change the hash")
+	}
+	other.Materials[5].Color.R--
+	other.Scene.Node.Name = "renamed"
+	if other.Hash() == h {
+		t.Errorf("renaming the root node didn't change the hash")
+	}
+
+	// A shape node with fewer frames than models is invalid, but
+	// it can still be hashed and printed.
+	sn := &ShapeNode{Models: []*Model{&other.Models[0], &other.Models[0]}, Frames: []int32{4}}
+	other.Scene.Node.Child = sn
+	other.Hash()
+	if got, want := sn.String(), fmt.Sprintf("Shape{model:%p, frame:4, model:%p, frame:0}", sn.Models[0], sn.Models[1]); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestDenseWorldChecksum(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{3, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := dw.Checksum()
+	dw.SetMaterialIndex([3]int{1, 2, 3}, 4)
+	changed := dw.Checksum()
+	if changed == empty {
+		t.Errorf("setting a voxel didn't change the checksum")
+	}
+	dw.Clear([3]int{1, 2, 3})
+	if got := dw.Checksum(); got != empty {
+		t.Errorf("after clearing the voxel, checksum is %x, want %x", got, empty)
+	}
+
+	// The same voxels in a moved world have a different checksum.
+	moved, err := NewDenseWorld([3]int{1, 0, 0}, [3]int{4, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Checksum() == empty {
+		t.Errorf("worlds with different bounds have the same checksum")
+	}
+}
@@ -0,0 +1,308 @@
+package vox
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+)
+
+// FromImages returns a file containing a single model built from a
+// stack of images, such as the frames of a pixel-art animation or the
+// slices of a scan. Image i is the layer of voxels with z = i, and
+// pixel (x, y) of the image is the voxel at (x, h-1-y), where h is the
+// height of the images, so that the top of the image is at the back
+// of the model when it's seen from above. Transparent pixels are
+// empty voxels. The colors are reduced to a palette of 255 colors
+// using QuantizePalette.
+// The images must all have the same size, and there must be at most
+// 256 of them, each at most 256 pixels wide and high.
+func FromImages(imgs []image.Image) (*Main, error) {
+	if len(imgs) == 0 || len(imgs) > 256 {
+		return nil, fmt.Errorf("need between 1 and 256 images, got %d", len(imgs))
+	}
+	size := imgs[0].Bounds().Size()
+	if size.X < 1 || size.Y < 1 || size.X > 256 || size.Y > 256 {
+		return nil, fmt.Errorf("images are %dx%d, but must be between 1x1 and 256x256", size.X, size.Y)
+	}
+	for i, img := range imgs {
+		if s := img.Bounds().Size(); s != size {
+			return nil, fmt.Errorf("image %d is %dx%d, but image 0 is %dx%d", i, s.X, s.Y, size.X, size.Y)
+		}
+	}
+
+	var vs []Voxel
+	var colors []color.RGBA
+	for z, img := range imgs {
+		b := img.Bounds()
+		for y := size.Y - 1; y >= 0; y-- {
+			for x := 0; x < size.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+				if c.A == 0 {
+					continue
+				}
+				vs = append(vs, Voxel{X: uint8(x), Y: uint8(size.Y - 1 - y), Z: uint8(z)})
+				colors = append(colors, color.RGBA{c.R, c.G, c.B, c.A})
+			}
+		}
+	}
+	pal, mapping := QuantizePalette(colors, 255)
+	for i := range vs {
+		vs[i].ColorIndex = mapping[i]
+	}
+
+	m := &Main{
+		Models: []Model{{X: size.X, Y: size.Y, Z: len(imgs), V: vs}},
+	}
+	for _, c := range pal {
+		mat := NewMaterial(MaterialDiffuse)
+		mat.Color = c
+		m.Materials = append(m.Materials, mat)
+	}
+	m.Scene = newScene(m.Models)
+	return m, nil
+}
+
+// SliceOptions controls how SliceImage draws a slice of a world.
+type SliceOptions struct {
+	// Scale is the width and height in pixels of each voxel. If it's
+	// 0, each voxel is a single pixel.
+	Scale int
+
+	// GridEvery, if it's not 0, draws a line along the edge of every
+	// GridEvery'th row and column of voxels, starting from world
+	// coordinate 0, so that the voxels can be counted.
+	GridEvery int
+
+	// GridColor is the color of the gridlines and of the ruler.
+	// If it's nil, they're black.
+	GridColor color.Color
+
+	// Ruler adds a margin below and to the left of the slice, with
+	// a tick at the edge of each voxel, a longer tick every GridEvery
+	// voxels (or every 10 voxels if GridEvery is 0), and a tick across
+	// the ticks' part of the margin at world coordinate 0. Each longer
+	// tick, and the tick at 0, is labeled with its world coordinate in
+	// a small built-in font, outside the ticks. A label that would
+	// overlap the previous one on its axis is left out.
+	Ruler bool
+
+	// Transparent holds palette indices whose voxels aren't drawn,
+	// as in ExportOptions.
+	Transparent map[uint8]bool
+}
+
+// rulerSize is the width in pixels of the part of the margin that holds
+// the ruler's ticks.
+const rulerSize = 8
+
+// labelFont holds 3x5 pixel bitmaps of the characters of the ruler's
+// labels. Each row is 3 bits, with the leftmost pixel in the highest
+// bit.
+var labelFont = map[byte][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'-': {0, 0, 7, 0, 0},
+}
+
+// labelHeight is the height in pixels of the ruler's labels.
+const labelHeight = 5
+
+// labelWidth returns the width in pixels of the label s, which has a
+// blank column between characters.
+func labelWidth(s string) int {
+	return 4*len(s) - 1
+}
+
+// drawLabel draws s with its top-left corner at (x, y).
+func drawLabel(img *image.RGBA, x, y int, s string, c color.Color) {
+	for i := 0; i < len(s); i++ {
+		for r, bits := range labelFont[s[i]] {
+			for j := 0; j < 3; j++ {
+				if bits&(4>>uint(j)) != 0 {
+					img.Set(x+4*i+j, y+r, c)
+				}
+			}
+		}
+	}
+}
+
+// SliceImage returns an image of the voxels of d with the given z
+// coordinate, using the colors in pal (for example, from
+// Main.ColorPalette). It's the reverse of FromImages: voxel (x, y) is
+// drawn at the pixel (x, h-1-y), relative to the corner of the world,
+// where h is the height of the world, and empty voxels are transparent.
+// opts may be nil, to draw just the voxels.
+func (d *DenseWorld) SliceImage(z int, pal color.Palette, opts *SliceOptions) (*image.RGBA, error) {
+	if z < d.Min[2] || z > d.Max[2] {
+		return nil, fmt.Errorf("slice %d is outside the world, which has z from %d to %d", z, d.Min[2], d.Max[2])
+	}
+	if opts == nil {
+		opts = &SliceOptions{}
+	}
+	scale := opts.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	if scale < 0 || opts.GridEvery < 0 {
+		return nil, fmt.Errorf("slice scale and grid spacing must not be negative")
+	}
+	var gridColor color.Color = color.Black
+	if opts.GridColor != nil {
+		gridColor = opts.GridColor
+	}
+	major := opts.GridEvery
+	if major == 0 {
+		major = 10
+	}
+	// The left margin holds the ticks, and to their left, the widest
+	// label and a gap. The bottom margin holds the ticks, a gap and
+	// the labels below them.
+	margin, bottom := 0, 0
+	if opts.Ruler {
+		widest := 0
+		for y := d.Min[1]; y <= d.Max[1]+1; y++ {
+			if lw := labelWidth(strconv.Itoa(y)); mod(y, major) == 0 && lw > widest {
+				widest = lw
+			}
+		}
+		margin = widest + 1 + rulerSize
+		bottom = rulerSize + 1 + labelHeight
+	}
+
+	w, h := d.Max[0]-d.Min[0]+1, d.Max[1]-d.Min[1]+1
+	img := image.NewRGBA(image.Rect(0, 0, margin+w*scale, h*scale+bottom))
+	// px and py return the pixel at the left and top of the voxel
+	// with the given x and y.
+	px := func(x int) int { return margin + (x-d.Min[0])*scale }
+	py := func(y int) int { return (d.Max[1] - y) * scale }
+
+	for y := d.Min[1]; y <= d.Max[1]; y++ {
+		for x := d.Min[0]; x <= d.Max[0]; x++ {
+			idx, _ := d.MaterialIndex([3]int{x, y, z})
+			if idx == 0 || int(idx) >= len(pal) || opts.Transparent[idx] {
+				continue
+			}
+			for i := 0; i < scale; i++ {
+				for j := 0; j < scale; j++ {
+					img.Set(px(x)+i, py(y)+j, pal[idx])
+				}
+			}
+		}
+	}
+
+	// Lines and ticks are drawn along the left of the voxels with a
+	// given x, and along the bottom of the voxels with a given y, so
+	// that they cross at the corners of the voxels with those
+	// coordinates. The lines for the voxels just past the right and top
+	// of the slice are drawn along its edges.
+	col := func(x int) int {
+		if x > d.Max[0] {
+			return margin + w*scale - 1
+		}
+		return px(x)
+	}
+	row := func(y int) int {
+		if y > d.Max[1] {
+			return 0
+		}
+		return py(y) + scale - 1
+	}
+
+	if opts.GridEvery > 0 {
+		for x := d.Min[0]; x <= d.Max[0]+1; x++ {
+			if mod(x, opts.GridEvery) != 0 {
+				continue
+			}
+			for y := 0; y < h*scale; y++ {
+				img.Set(col(x), y, gridColor)
+			}
+		}
+		for y := d.Min[1]; y <= d.Max[1]+1; y++ {
+			if mod(y, opts.GridEvery) != 0 {
+				continue
+			}
+			for x := margin; x < margin+w*scale; x++ {
+				img.Set(x, row(y), gridColor)
+			}
+		}
+	}
+
+	if opts.Ruler {
+		tick := func(v int) int {
+			switch {
+			case v == 0:
+				return rulerSize
+			case mod(v, major) == 0:
+				return rulerSize / 2
+			}
+			return rulerSize / 4
+		}
+		for x := d.Min[0]; x <= d.Max[0]+1; x++ {
+			for i := 0; i < tick(x); i++ {
+				img.Set(col(x), h*scale+i, gridColor)
+			}
+		}
+		for y := d.Min[1]; y <= d.Max[1]+1; y++ {
+			for i := 0; i < tick(y); i++ {
+				img.Set(margin-1-i, row(y), gridColor)
+			}
+		}
+
+		// The labels of x are below their ticks, starting at the
+		// tick, and the labels of y are to the left of theirs,
+		// centered on the tick, both moved inside the image if
+		// they'd cross its edge.
+		imgW, imgH := img.Bounds().Dx(), img.Bounds().Dy()
+		last := -1
+		for x := d.Min[0]; x <= d.Max[0]+1; x++ {
+			if mod(x, major) != 0 {
+				continue
+			}
+			s := strconv.Itoa(x)
+			lx := col(x)
+			if lx+labelWidth(s) > imgW {
+				lx = imgW - labelWidth(s)
+			}
+			if last >= 0 && lx <= last {
+				continue
+			}
+			drawLabel(img, lx, h*scale+rulerSize+1, s, gridColor)
+			last = lx + labelWidth(s)
+		}
+		last = -1
+		for y := d.Min[1]; y <= d.Max[1]+1; y++ {
+			if mod(y, major) != 0 {
+				continue
+			}
+			s := strconv.Itoa(y)
+			ly := row(y) - labelHeight/2
+			if ly < 0 {
+				ly = 0
+			}
+			if ly+labelHeight > imgH {
+				ly = imgH - labelHeight
+			}
+			// y increases up the image, so each label is above the last.
+			if last >= 0 && ly+labelHeight >= last {
+				continue
+			}
+			drawLabel(img, margin-rulerSize-1-labelWidth(s), ly, s, gridColor)
+			last = ly
+		}
+	}
+	return img, nil
+}
+
+// mod returns a mod b, which unlike a % b is never negative.
+func mod(a, b int) int {
+	return ((a % b) + b) % b
+}
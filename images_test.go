@@ -0,0 +1,143 @@
+package vox
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestFromImages(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img0 := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	img0.Set(0, 0, red)
+	img1 := image.NewRGBA(image.Rect(10, 10, 12, 13))
+	img1.Set(11, 12, blue)
+	m, err := FromImages([]image.Image{img0, img1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("FromImages returned invalid file: %v", err)
+	}
+	if len(m.Models) != 1 {
+		t.Fatalf("got %d models, want 1", len(m.Models))
+	}
+	model := m.Models[0]
+	if model.X != 2 || model.Y != 3 || model.Z != 2 {
+		t.Errorf("model has size %dx%dx%d, want 2x3x2", model.X, model.Y, model.Z)
+	}
+	var got []Voxel
+	for _, v := range model.V {
+		got = append(got, Voxel{v.X, v.Y, v.Z, 0})
+	}
+	want := []Voxel{{0, 2, 0, 0}, {1, 0, 1, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("model has voxels at %v, want %v", got, want)
+	}
+	for i, c := range []color.RGBA{red, blue} {
+		if got := m.Materials[model.V[i].ColorIndex].Color; got != c {
+			t.Errorf("voxel %d has color %v, want %v", i, got, c)
+		}
+	}
+
+	if _, err := FromImages([]image.Image{img0, image.NewRGBA(image.Rect(0, 0, 3, 3))}); err == nil {
+		t.Errorf("FromImages with different sized images succeeded, want error")
+	}
+	if _, err := FromImages(nil); err == nil {
+		t.Errorf("FromImages(nil) succeeded, want error")
+	}
+}
+
+func TestSliceImage(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	pal := make(color.Palette, 256)
+	for i := range pal {
+		pal[i] = color.RGBA{}
+	}
+	pal[1], pal[2] = red, blue
+	dw, err := NewDenseWorld([3]int{-2, 0, 0}, [3]int{1, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{-2, 0, 0}, 1)
+	dw.SetMaterialIndex([3]int{1, 1, 0}, 2)
+
+	type pixel struct {
+		x, y int
+		c    color.RGBA
+	}
+	check := func(name string, img *image.RGBA, w, h int, pixels []pixel) {
+		if s := img.Bounds().Size(); s.X != w || s.Y != h {
+			t.Errorf("%s: image is %dx%d, want %dx%d", name, s.X, s.Y, w, h)
+			return
+		}
+		for _, p := range pixels {
+			if got := img.RGBAAt(p.x, p.y); got != p.c {
+				t.Errorf("%s: pixel (%d, %d) = %v, want %v", name, p.x, p.y, got, p.c)
+			}
+		}
+	}
+	black := color.RGBA{0, 0, 0, 255}
+	clear := color.RGBA{}
+
+	img, err := dw.SliceImage(0, pal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("plain", img, 4, 2, []pixel{{0, 1, red}, {3, 0, blue}, {1, 1, clear}})
+
+	img, err = dw.SliceImage(0, pal, &SliceOptions{Scale: 2, GridEvery: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("grid", img, 8, 4, []pixel{
+		{1, 2, red}, {6, 1, blue},
+		{4, 1, black}, {7, 2, black}, {2, 3, black}, {2, 0, black},
+		{2, 1, clear},
+	})
+
+	img, err = dw.SliceImage(0, pal, &SliceOptions{Scale: 2, Ruler: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The left margin is 12 pixels: a 3 pixel label, a gap and
+	// the ticks. The bottom margin is 14: the ticks, a gap and a 5
+	// pixel label.
+	check("ruler", img, 20, 18, []pixel{
+		{13, 2, red},
+		{16, 11, black}, {14, 5, black}, {14, 6, clear},
+		{11, 3, black}, {4, 3, black}, {10, 0, black}, {9, 0, clear},
+		// The labels of x = 0 and y = 0.
+		{16, 13, black}, {18, 13, black}, {17, 14, clear}, {17, 17, black},
+		{0, 1, black}, {2, 1, black}, {1, 2, clear}, {1, 5, black},
+	})
+
+	// With labels every voxel, labels that would overlap are left out.
+	img, err = dw.SliceImage(0, pal, &SliceOptions{Scale: 6, GridEvery: 1, Ruler: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The labels of x are -2 (7 pixels wide) at 12, 0 at 24 and 1 at
+	// 30; -1 and 2 would overlap them. The labels of y are 0 and 1,
+	// and 2 would overlap 1.
+	check("ruler labels", img, 36, 26, []pixel{
+		{12, 21, clear}, {12, 23, black}, {16, 21, black},
+		{24, 21, black}, {25, 22, clear},
+		{30, 21, clear}, {31, 21, black}, {33, 21, clear},
+		{0, 9, black}, {1, 10, clear},
+		{0, 3, clear}, {1, 3, black}, {0, 0, clear},
+	})
+
+	img, err = dw.SliceImage(0, pal, &SliceOptions{Transparent: map[uint8]bool{2: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("transparent", img, 4, 2, []pixel{{0, 1, red}, {3, 0, clear}})
+
+	if _, err := dw.SliceImage(1, pal, nil); err == nil {
+		t.Errorf("SliceImage outside the world succeeded, want error")
+	}
+}
@@ -0,0 +1,270 @@
+package vox
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The scene graph is encoded as JSON with a "type" field in each node,
+// so that nodes can be decoded into the right type. Transform nodes
+// hold the index of their layer, and shape nodes hold copies of their
+// models: decoding a Scene links each transform node to the layer in
+// Scene.Layers with the same index, but the models are new copies that
+// aren't in any Main.Models.
+
+type frameJSON struct {
+	R     Matrix3x3 `json:"r"`
+	T     [3]int32  `json:"t"`
+	Frame int32     `json:"frame,omitempty"`
+}
+
+type transformJSON struct {
+	Type       string      `json:"type"`
+	Name       string      `json:"name,omitempty"`
+	Hidden     bool        `json:"hidden,omitempty"`
+	Layer      *int32      `json:"layer,omitempty"`
+	Transforms []frameJSON `json:"transforms"`
+	Child      JSONNode    `json:"child"`
+}
+
+type groupJSON struct {
+	Type     string     `json:"type"`
+	Name     string     `json:"name,omitempty"`
+	Hidden   bool       `json:"hidden,omitempty"`
+	Children []JSONNode `json:"children"`
+}
+
+type modelJSON struct {
+	Size   [3]int     `json:"size"`
+	Voxels [][4]uint8 `json:"voxels"` // x, y, z, color index
+}
+
+type shapeJSON struct {
+	Type       string              `json:"type"`
+	Name       string              `json:"name,omitempty"`
+	Hidden     bool                `json:"hidden,omitempty"`
+	Models     []modelJSON         `json:"models"`
+	Frames     []int32             `json:"frames,omitempty"`
+	ModelAttrs []map[string]string `json:"modelAttrs,omitempty"`
+}
+
+type layerJSON struct {
+	Index  int32  `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Hidden bool   `json:"hidden,omitempty"`
+}
+
+type sceneJSON struct {
+	Layers []layerJSON    `json:"layers"`
+	Node   *TransformNode `json:"node"`
+}
+
+// checkType returns an error if the type of a node decoded from JSON
+// isn't want.
+func checkType(got, want string) error {
+	if got != want {
+		return fmt.Errorf("expected JSON for a %s node, but found type %q", want, got)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (tn *TransformNode) MarshalJSON() ([]byte, error) {
+	j := transformJSON{Type: "transform", Name: tn.Name, Hidden: tn.Hidden, Child: JSONNode{tn.Child}}
+	if tn.Layer != nil {
+		j.Layer = &tn.Layer.Index
+	}
+	j.Transforms = []frameJSON{}
+	for _, tf := range tn.Transforms {
+		j.Transforms = append(j.Transforms, frameJSON{tf.R, tf.T, tf.Frame})
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. If the node has a layer,
+// Layer is set to a new Layer with just the index filled in.
+func (tn *TransformNode) UnmarshalJSON(b []byte) error {
+	var j transformJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if err := checkType(j.Type, "transform"); err != nil {
+		return err
+	}
+	*tn = TransformNode{Node: Node{Name: j.Name, Hidden: j.Hidden}, Child: j.Child.Node}
+	if j.Layer != nil {
+		tn.Layer = &Layer{Index: *j.Layer}
+	}
+	for _, f := range j.Transforms {
+		tn.Transforms = append(tn.Transforms, TransformFrame{R: f.R, T: f.T, Frame: f.Frame})
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (gn *GroupNode) MarshalJSON() ([]byte, error) {
+	j := groupJSON{Type: "group", Name: gn.Name, Hidden: gn.Hidden, Children: []JSONNode{}}
+	for _, c := range gn.Children {
+		j.Children = append(j.Children, JSONNode{c})
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (gn *GroupNode) UnmarshalJSON(b []byte) error {
+	var j groupJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if err := checkType(j.Type, "group"); err != nil {
+		return err
+	}
+	*gn = GroupNode{Node: Node{Name: j.Name, Hidden: j.Hidden}}
+	for _, c := range j.Children {
+		gn.Children = append(gn.Children, c.Node)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The voxels of each model
+// are included.
+func (sn *ShapeNode) MarshalJSON() ([]byte, error) {
+	j := shapeJSON{Type: "shape", Name: sn.Name, Hidden: sn.Hidden, Models: []modelJSON{}, Frames: sn.Frames, ModelAttrs: sn.ModelAttrs}
+	for _, m := range sn.Models {
+		vs, err := m.Voxels()
+		if err != nil {
+			return nil, err
+		}
+		mj := modelJSON{Size: [3]int{m.X, m.Y, m.Z}, Voxels: [][4]uint8{}}
+		for _, v := range vs {
+			mj.Voxels = append(mj.Voxels, [4]uint8{v.X, v.Y, v.Z, v.ColorIndex})
+		}
+		j.Models = append(j.Models, mj)
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Each model is decoded
+// into a new Model, with its PaletteHint set.
+func (sn *ShapeNode) UnmarshalJSON(b []byte) error {
+	var j shapeJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if err := checkType(j.Type, "shape"); err != nil {
+		return err
+	}
+	*sn = ShapeNode{Node: Node{Name: j.Name, Hidden: j.Hidden}, Frames: j.Frames, ModelAttrs: j.ModelAttrs}
+	for _, mj := range j.Models {
+		m := &Model{X: mj.Size[0], Y: mj.Size[1], Z: mj.Size[2]}
+		for _, v := range mj.Voxels {
+			m.V = append(m.V, Voxel{v[0], v[1], v[2], v[3]})
+		}
+		m.UpdatePaletteHint()
+		sn.Models = append(sn.Models, m)
+	}
+	return nil
+}
+
+// A JSONNode wraps a scene node so that it can be encoded and decoded
+// as JSON, whatever its type. A nil node is encoded as null.
+type JSONNode struct {
+	Node AnyNode
+}
+
+// MarshalJSON implements json.Marshaler.
+func (jn JSONNode) MarshalJSON() ([]byte, error) {
+	switch n := jn.Node.(type) {
+	case nil:
+		return []byte("null"), nil
+	case *TransformNode:
+		return n.MarshalJSON()
+	case *GroupNode:
+		return n.MarshalJSON()
+	case *ShapeNode:
+		return n.MarshalJSON()
+	}
+	return nil, fmt.Errorf("found unexpected node of type %T", jn.Node)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, using the node's "type"
+// field to decide which type of node to create.
+func (jn *JSONNode) UnmarshalJSON(b []byte) error {
+	var j struct {
+		Type *string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j.Type == nil {
+		// null, or an object without a type.
+		if string(b) != "null" {
+			return fmt.Errorf("JSON scene node has no type")
+		}
+		jn.Node = nil
+		return nil
+	}
+	var n interface {
+		AnyNode
+		json.Unmarshaler
+	}
+	switch *j.Type {
+	case "transform":
+		n = &TransformNode{}
+	case "group":
+		n = &GroupNode{}
+	case "shape":
+		n = &ShapeNode{}
+	default:
+		return fmt.Errorf("JSON scene node has unknown type %q", *j.Type)
+	}
+	if err := n.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	jn.Node = n
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Scene) MarshalJSON() ([]byte, error) {
+	j := sceneJSON{Layers: []layerJSON{}, Node: s.Node}
+	for _, l := range s.Layers {
+		j.Layers = append(j.Layers, layerJSON{l.Index, l.Name, l.Hidden})
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Transform nodes are
+// linked to the layers in s.Layers with the same index.
+func (s *Scene) UnmarshalJSON(b []byte) error {
+	var j sceneJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*s = Scene{Node: j.Node}
+	for _, l := range j.Layers {
+		s.Layers = append(s.Layers, Layer{l.Index, l.Name, l.Hidden})
+	}
+	s.linkLayers(s.Node)
+	return nil
+}
+
+// linkLayers sets the layer of each transform node under n to the
+// layer in s.Layers with the same index.
+func (s *Scene) linkLayers(n AnyNode) {
+	switch t := n.(type) {
+	case *TransformNode:
+		if t.Layer != nil {
+			for i := range s.Layers {
+				if s.Layers[i].Index == t.Layer.Index {
+					t.Layer = &s.Layers[i]
+				}
+			}
+		}
+		s.linkLayers(t.Child)
+	case *GroupNode:
+		for _, c := range t.Children {
+			s.linkLayers(c)
+		}
+	}
+}
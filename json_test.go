@@ -0,0 +1,73 @@
+package vox
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSceneJSON(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(main.Scene)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Scene
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, main.Scene) {
+		t.Errorf("scene changed after encoding and decoding as JSON")
+	}
+	// The transform nodes are linked to the decoded layers.
+	shapes, err := got.Shapes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range shapes {
+		found := false
+		for i := range got.Layers {
+			if s.Layer == &got.Layers[i] {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("shape %q isn't on one of the scene's layers", s.Name)
+		}
+	}
+}
+
+func TestJSONNode(t *testing.T) {
+	n := &GroupNode{
+		Node: Node{Name: "g"},
+		Children: []AnyNode{
+			&ShapeNode{Node: Node{Hidden: true}, Models: []*Model{{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 4}}, PaletteHint: []uint8{4}}}},
+			&TransformNode{Transforms: []TransformFrame{{R: Matrix3x3Identity, T: [3]int32{1, 2, 3}, Frame: 2}}},
+		},
+	}
+	b, err := json.Marshal(JSONNode{n})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONNode
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Node, AnyNode(n)) {
+		t.Errorf("decoded %s, want %v", b, n)
+	}
+
+	for _, bad := range []string{`{"name": "x"}`, `{"type": "sphere"}`, `{"type": "group", "children": [{"type": 3}]}`} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("decoding %s succeeded, want error", bad)
+		}
+	}
+	var tn TransformNode
+	if err := json.Unmarshal([]byte(`{"type": "group"}`), &tn); err == nil || !strings.Contains(err.Error(), "transform") {
+		t.Errorf("decoding a group into a TransformNode gave error %v, want wrong type error", err)
+	}
+}
@@ -1,5 +1,9 @@
 package vox
 
+import (
+	"math"
+)
+
 // Matrix3x3 is an encoded 3x3 orthogonal matrix with entries 0, +1, -1.
 type Matrix3x3 uint8
 
@@ -81,28 +85,141 @@ func (m Matrix3x3) MulVec(x [3]int) [3]int {
 	return r
 }
 
-var matInverses [128]Matrix3x3
+// validMatrices holds the valid matrices, in increasing order.
+var validMatrices []Matrix3x3
 
 func init() {
 	for m := Matrix3x3(0); m < 128; m++ {
-		if !m.Valid() {
-			continue
+		if m.Valid() {
+			validMatrices = append(validMatrices, m)
 		}
-		for r := Matrix3x3(0); r < 128; r++ {
-			if !r.Valid() {
+	}
+}
+
+// ValidMatrices returns the 48 valid matrices, in increasing order: the
+// 24 rotations, and the 24 reflections.
+func ValidMatrices() []Matrix3x3 {
+	return append([]Matrix3x3{}, validMatrices...)
+}
+
+// Transpose returns the transpose of the matrix, which for these
+// matrices is the same as the inverse.
+func (m Matrix3x3) Transpose() Matrix3x3 {
+	var r Matrix3x3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			x := m.Get(j, i)
+			if x == 0 {
 				continue
 			}
-			if m.Mul(r) == 0x04 {
-				matInverses[int(m)] = r
+			if x < 0 {
+				r |= 1 << uint(i+4)
+			}
+			if i < 2 {
+				r |= Matrix3x3(j) << uint(2*i)
 			}
 		}
 	}
+	return r
 }
 
-// Inverse returns the inverse of the given matrix.
+// Inverse returns the inverse of the given matrix, or 0 if the
+// matrix isn't valid.
 func (m Matrix3x3) Inverse() Matrix3x3 {
-	if m >= 128 {
+	if !m.Valid() {
 		return 0
 	}
-	return matInverses[int(m)]
+	return m.Transpose()
+}
+
+// Det returns the determinant of the matrix, which is 1 if the matrix
+// is a rotation, and -1 if it's a reflection.
+func (m Matrix3x3) Det() int {
+	d := 0
+	for j := 0; j < 3; j++ {
+		minor := m.Get(1, (j+1)%3)*m.Get(2, (j+2)%3) - m.Get(1, (j+2)%3)*m.Get(2, (j+1)%3)
+		d += m.Get(0, j) * minor
+	}
+	return d
+}
+
+// rotationPart returns the entries of the rotation described by m.
+// If m is a reflection, it returns the entries of the rotation -m.
+func (m Matrix3x3) rotationPart() [3][3]float64 {
+	s := float64(m.Det())
+	var r [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = s * float64(m.Get(i, j))
+		}
+	}
+	return r
+}
+
+// Quaternion returns the unit quaternion describing the same rotation as m,
+// in the order x, y, z, w (as used by glTF).
+//
+// Quaternions can only describe rotations. If m is a reflection
+// (m.Det() == -1), the result is the quaternion for the rotation -m,
+// so m is that rotation followed by a scale of -1.
+func (m Matrix3x3) Quaternion() [4]float64 {
+	r := m.rotationPart()
+	var x, y, z, w float64
+	if tr := r[0][0] + r[1][1] + r[2][2]; tr > 0 {
+		s := math.Sqrt(tr+1) * 2
+		w = s / 4
+		x = (r[2][1] - r[1][2]) / s
+		y = (r[0][2] - r[2][0]) / s
+		z = (r[1][0] - r[0][1]) / s
+	} else if r[0][0] > r[1][1] && r[0][0] > r[2][2] {
+		s := math.Sqrt(1+r[0][0]-r[1][1]-r[2][2]) * 2
+		w = (r[2][1] - r[1][2]) / s
+		x = s / 4
+		y = (r[0][1] + r[1][0]) / s
+		z = (r[0][2] + r[2][0]) / s
+	} else if r[1][1] > r[2][2] {
+		s := math.Sqrt(1+r[1][1]-r[0][0]-r[2][2]) * 2
+		w = (r[0][2] - r[2][0]) / s
+		x = (r[0][1] + r[1][0]) / s
+		y = s / 4
+		z = (r[1][2] + r[2][1]) / s
+	} else {
+		s := math.Sqrt(1+r[2][2]-r[0][0]-r[1][1]) * 2
+		w = (r[1][0] - r[0][1]) / s
+		x = (r[0][2] + r[2][0]) / s
+		y = (r[1][2] + r[2][1]) / s
+		z = s / 4
+	}
+	return [4]float64{x, y, z, w}
+}
+
+// EulerXYZ returns the rotation described by m as angles in degrees
+// about the X, Y and Z axes, which are applied in that order.
+// That is, m is Rz * Ry * Rx. The angles are all multiples of 90.
+//
+// As with Quaternion, if m is a reflection the result describes the
+// rotation -m.
+func (m Matrix3x3) EulerXYZ() [3]float64 {
+	r := m.rotationPart()
+	var x, y, z float64
+	if r[2][0] != 1 && r[2][0] != -1 {
+		x = math.Atan2(r[2][1], r[2][2])
+		y = math.Asin(-r[2][0])
+		z = math.Atan2(r[1][0], r[0][0])
+	} else {
+		// Gimbal lock: the X and Z rotations are about the same
+		// axis, so we put all of the rotation in X.
+		x = math.Atan2(-r[1][2], r[1][1])
+		y = -r[2][0] * math.Pi / 2
+	}
+	var a [3]float64
+	for i, v := range []float64{x, y, z} {
+		// Round to exact multiples of 90 degrees, and avoid -0 and -180.
+		d := math.Round(v*2/math.Pi) * 90
+		if d == -180 || d == 0 {
+			d = math.Abs(d)
+		}
+		a[i] = d
+	}
+	return a
 }
@@ -2,6 +2,7 @@ package vox
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -102,6 +103,28 @@ func TestValid(t *testing.T) {
 	}
 }
 
+func TestValidMatrices(t *testing.T) {
+	ms := ValidMatrices()
+	if len(ms) != 48 {
+		t.Fatalf("ValidMatrices() returned %d matrices, want 48", len(ms))
+	}
+	rotations := 0
+	for i, m := range ms {
+		if !m.Valid() {
+			t.Errorf("ValidMatrices() contains invalid matrix %x", m)
+		}
+		if i > 0 && m <= ms[i-1] {
+			t.Errorf("ValidMatrices() isn't in increasing order: %x follows %x", m, ms[i-1])
+		}
+		if m.Det() == 1 {
+			rotations++
+		}
+	}
+	if rotations != 24 {
+		t.Errorf("ValidMatrices() contains %d rotations, want 24", rotations)
+	}
+}
+
 func TestIdentity(t *testing.T) {
 	id := Matrix3x3Identity
 	if r := id.Mul(id); r != id {
@@ -132,6 +155,48 @@ func TestInverses(t *testing.T) {
 	}
 }
 
+func TestTranspose(t *testing.T) {
+	for _, tc := range []struct {
+		m, want [3][3]int
+	}{
+		{
+			[3][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+			[3][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+		},
+		{
+			[3][3]int{{0, -1, 0}, {1, 0, 0}, {0, 0, 1}},
+			[3][3]int{{0, 1, 0}, {-1, 0, 0}, {0, 0, 1}},
+		},
+		{
+			[3][3]int{{0, 1, 0}, {0, 0, 1}, {1, 0, 0}},
+			[3][3]int{{0, 0, 1}, {1, 0, 0}, {0, 1, 0}},
+		},
+		{
+			[3][3]int{{0, 0, -1}, {-1, 0, 0}, {0, 1, 0}},
+			[3][3]int{{0, -1, 0}, {0, 0, 1}, {-1, 0, 0}},
+		},
+		{
+			[3][3]int{{-1, 0, 0}, {0, 1, 0}, {0, 0, -1}},
+			[3][3]int{{-1, 0, 0}, {0, 1, 0}, {0, 0, -1}},
+		},
+	} {
+		m := matToMatrix3x3(mat{tc.m})
+		if got := matFromMatrix3x3(m.Transpose()).m; got != tc.want {
+			t.Errorf("Transpose(%v) = %v, want %v", tc.m, got, tc.want)
+		}
+	}
+
+	// Every valid matrix times its transpose is the identity.
+	for m := Matrix3x3(0); m < 128; m++ {
+		if !m.Valid() {
+			continue
+		}
+		if got := m.Mul(m.Transpose()); got != Matrix3x3Identity {
+			t.Errorf("%x * %x.Transpose() = %x, want the identity", m, m, got)
+		}
+	}
+}
+
 func TestMul(t *testing.T) {
 	for a := Matrix3x3(0); a < 128; a++ {
 		if !a.Valid() {
@@ -218,3 +283,90 @@ func TestMulVec(t *testing.T) {
 		}
 	}
 }
+
+func TestDet(t *testing.T) {
+	rotations := 0
+	for m := Matrix3x3(0); m < 128; m++ {
+		if !m.Valid() {
+			continue
+		}
+		d := m.Det()
+		if d != 1 && d != -1 {
+			t.Errorf("%x.Det() = %d, want 1 or -1", m, d)
+		}
+		if d == 1 {
+			rotations++
+		}
+	}
+	if rotations != 24 {
+		t.Errorf("found %d rotations, want 24", rotations)
+	}
+}
+
+// rotateByQuaternion rotates v by the unit quaternion q (x, y, z, w).
+func rotateByQuaternion(q [4]float64, v [3]float64) [3]float64 {
+	cross := func(a, b [3]float64) [3]float64 {
+		return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+	}
+	u := [3]float64{q[0], q[1], q[2]}
+	c := cross(u, v)
+	tv := [3]float64{2 * c[0], 2 * c[1], 2 * c[2]}
+	uc := cross(u, tv)
+	return [3]float64{v[0] + q[3]*tv[0] + uc[0], v[1] + q[3]*tv[1] + uc[1], v[2] + q[3]*tv[2] + uc[2]}
+}
+
+// eulerMatrix returns Rz * Ry * Rx for the given angles in degrees.
+func eulerMatrix(a [3]float64) [3][3]float64 {
+	sx, cx := math.Sincos(a[0] * math.Pi / 180)
+	sy, cy := math.Sincos(a[1] * math.Pi / 180)
+	sz, cz := math.Sincos(a[2] * math.Pi / 180)
+	return [3][3]float64{
+		{cz * cy, cz*sy*sx - sz*cx, cz*sy*cx + sz*sx},
+		{sz * cy, sz*sy*sx + cz*cx, sz*sy*cx - cz*sx},
+		{-sy, cy * sx, cy * cx},
+	}
+}
+
+func TestQuaternion(t *testing.T) {
+	for m := Matrix3x3(0); m < 128; m++ {
+		if !m.Valid() {
+			continue
+		}
+		q := m.Quaternion()
+		if n := q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3]; math.Abs(n-1) > 1e-9 {
+			t.Errorf("%x.Quaternion() = %v, which has norm %v", m, q, n)
+		}
+		for _, v := range [][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {2, -3, 5}} {
+			want := m.MulVec(v)
+			got := rotateByQuaternion(q, [3]float64{float64(v[0]), float64(v[1]), float64(v[2])})
+			for i := range got {
+				if math.Abs(got[i]*float64(m.Det())-float64(want[i])) > 1e-9 {
+					t.Errorf("%x: quaternion %v rotates %v to %v, want %v (det %d)", m, q, v, got, want, m.Det())
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestEulerXYZ(t *testing.T) {
+	for m := Matrix3x3(0); m < 128; m++ {
+		if !m.Valid() {
+			continue
+		}
+		a := m.EulerXYZ()
+		for _, x := range a {
+			if math.Mod(x, 90) != 0 {
+				t.Errorf("%x.EulerXYZ() = %v, want multiples of 90", m, a)
+			}
+		}
+		r := eulerMatrix(a)
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				if want := float64(m.Get(i, j) * m.Det()); math.Abs(r[i][j]-want) > 1e-9 {
+					t.Fatalf("%x.EulerXYZ() = %v, which gives matrix %v", m, a, r)
+				}
+			}
+		}
+	}
+}
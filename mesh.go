@@ -0,0 +1,154 @@
+package vox
+
+import (
+	"fmt"
+)
+
+// faceDirs are the outward normals of the six faces of a voxel:
+// -X, +X, -Y, +Y, -Z, +Z.
+var faceDirs = [6][3]int{{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1}}
+
+// FaceDir is the direction that a face of a voxel points in.
+type FaceDir int
+
+const (
+	FaceNegX FaceDir = 0
+	FacePosX FaceDir = 1
+	FaceNegY FaceDir = 2
+	FacePosY FaceDir = 3
+	FaceNegZ FaceDir = 4
+	FacePosZ FaceDir = 5
+)
+
+func (fd FaceDir) String() string {
+	if fd < 0 || fd > 5 {
+		return fmt.Sprintf("FaceDir(%d)", int(fd))
+	}
+	return [6]string{"-X", "+X", "-Y", "+Y", "-Z", "+Z"}[fd]
+}
+
+// Normal returns the outward normal of faces in the direction fd.
+func (fd FaceDir) Normal() [3]int {
+	return faceDirs[fd]
+}
+
+// A Face is one face of a non-empty voxel that borders an
+// empty voxel (or the outside of the world).
+type Face struct {
+	Pos           [3]int // The coordinates of the voxel.
+	Dir           FaceDir
+	MaterialIndex uint8 // The material index of the voxel.
+}
+
+// ExposedFaces returns the faces of the non-empty voxels of d
+// that aren't hidden by a neighboring voxel. These are the faces
+// that need to be drawn to render the world, and the faces that
+// a renderer needs to compute ambient occlusion for.
+func (d *DenseWorld) ExposedFaces() []Face {
+	var faces []Face
+	for z := d.Min[2]; z <= d.Max[2]; z++ {
+		for y := d.Min[1]; y <= d.Max[1]; y++ {
+			for x := d.Min[0]; x <= d.Max[0]; x++ {
+				c := [3]int{x, y, z}
+				idx, _ := d.MaterialIndex(c)
+				if idx == 0 {
+					continue
+				}
+				for dir, fd := range faceDirs {
+					if n, _ := d.MaterialIndex(addVec(c, fd)); n == 0 {
+						faces = append(faces, Face{c, FaceDir(dir), idx})
+					}
+				}
+			}
+		}
+	}
+	return faces
+}
+
+// faceCorners returns the corners of the face of the voxel at c in
+// direction dir, in counter-clockwise order when seen from outside
+// the voxel. The voxel c occupies the unit cube from c to c+(1, 1, 1).
+func faceCorners(c [3]int, dir FaceDir) [4][3]int {
+	a := int(dir) / 2
+	u, v := (a+1)%3, (a+2)%3
+	base := c
+	if dir%2 == 1 {
+		base[a]++
+	}
+	uv := [4][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	if dir%2 == 0 {
+		uv = [4][2]int{{0, 0}, {0, 1}, {1, 1}, {1, 0}}
+	}
+	var r [4][3]int
+	for i, p := range uv {
+		r[i] = base
+		r[i][u] += p[0]
+		r[i][v] += p[1]
+	}
+	return r
+}
+
+// ExportOptions controls how the exporters (WritePLY and WriteGLTF)
+// write voxels. The package-level functions use the zero
+// ExportOptions.
+type ExportOptions struct {
+	// Transparent holds the palette indices of voxels that aren't
+	// written, such as a color used for glass or water. They're
+	// treated as empty, so the faces of the voxels behind them are
+	// written.
+	Transparent map[uint8]bool
+
+	// YUp converts coordinates from MagicaVoxel's convention, where the
+	// Z axis is up, to the convention used by most game engines, where
+	// the Y axis is up. Each point (x, y, z) is written as (x, z, -y),
+	// which is a rotation, so the handedness of the coordinates and the
+	// winding of faces are unchanged.
+	YUp bool
+}
+
+// yUpMatrix rotates Z-up coordinates to Y-up coordinates, mapping
+// (x, y, z) to (x, z, -y).
+const yUpMatrix = Matrix3x3(2<<2 | 1<<6)
+
+// position returns the coordinates of the point p as they're written
+// by the exporters.
+func (o ExportOptions) position(p [3]float32) [3]float32 {
+	if o.YUp {
+		return [3]float32{p[0], p[2], -p[1]}
+	}
+	return p
+}
+
+// visible returns d without the voxels that o makes transparent. If
+// there are none, d itself is returned.
+func (o ExportOptions) visible(d *DenseWorld) *DenseWorld {
+	if len(o.Transparent) == 0 {
+		return d
+	}
+	r := &DenseWorld{Min: d.Min, Max: d.Max, Voxels: make([]uint8, len(d.Voxels))}
+	for i, v := range d.Voxels {
+		if !o.Transparent[v] {
+			r.Voxels[i] = v
+		}
+	}
+	return r
+}
+
+// modelWorld returns a DenseWorld containing the voxels of the model
+// in model coordinates, from (0, 0, 0) to the size of the model.
+func modelWorld(m Model) (*DenseWorld, error) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{m.X - 1, m.Y - 1, m.Z - 1})
+	if err != nil {
+		return nil, err
+	}
+	vs, err := m.decoded()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vs {
+		if !dw.SetMaterialIndex([3]int{int(v.X), int(v.Y), int(v.Z)}, v.ColorIndex) {
+			return nil, fmt.Errorf("voxel %v is outside the model of size %d,%d,%d", v, m.X, m.Y, m.Z)
+		}
+	}
+	return dw, nil
+}
@@ -0,0 +1,52 @@
+package vox
+
+import (
+	"testing"
+)
+
+func TestExposedFaces(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := SceneToDenseWorld(main.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Count the faces by checking the six neighbors of every voxel.
+	size := [3]int{dw.Max[0] - dw.Min[0] + 1, dw.Max[1] - dw.Min[1] + 1, dw.Max[2] - dw.Min[2] + 1}
+	solid := func(x, y, z int) bool {
+		if x < 0 || y < 0 || z < 0 || x >= size[0] || y >= size[1] || z >= size[2] {
+			return false
+		}
+		return dw.Voxels[(z*size[1]+y)*size[0]+x] != 0
+	}
+	want := 0
+	for z := 0; z < size[2]; z++ {
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				if !solid(x, y, z) {
+					continue
+				}
+				for _, n := range [][3]int{{x - 1, y, z}, {x + 1, y, z}, {x, y - 1, z}, {x, y + 1, z}, {x, y, z - 1}, {x, y, z + 1}} {
+					if !solid(n[0], n[1], n[2]) {
+						want++
+					}
+				}
+			}
+		}
+	}
+
+	faces := dw.ExposedFaces()
+	if len(faces) != want || want == 0 {
+		t.Errorf("found %d exposed faces, want %d", len(faces), want)
+	}
+	for _, f := range faces {
+		idx, _ := dw.MaterialIndex(f.Pos)
+		n, _ := dw.MaterialIndex(addVec(f.Pos, f.Dir.Normal()))
+		if idx == 0 || idx != f.MaterialIndex || n != 0 {
+			t.Fatalf("face %v of voxel %d borders voxel %d", f, idx, n)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package vox
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+)
+
+// defaultPalette is the palette that MagicaVoxel uses for files
+// without an RGBA chunk, indexed by color index. It's a 6x6x6 color
+// cube (without black), followed by ramps of red, green, blue and gray.
+var defaultPalette = func() [256]color.RGBA {
+	var p [256]color.RGBA
+	i := 1
+	for r := 5; r >= 0; r-- {
+		for g := 5; g >= 0; g-- {
+			for b := 5; b >= 0; b-- {
+				if r+g+b > 0 {
+					p[i] = color.RGBA{uint8(r * 0x33), uint8(g * 0x33), uint8(b * 0x33), 255}
+					i++
+				}
+			}
+		}
+	}
+	for _, ramp := range [][3]uint8{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 1}} {
+		for _, v := range []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11} {
+			p[i] = color.RGBA{ramp[0] * v, ramp[1] * v, ramp[2] * v, 255}
+			i++
+		}
+	}
+	return p
+}()
+
+// ColorUsage returns, for each palette index, the number of voxels
+// in all of the models that use it.
+func (m *Main) ColorUsage() [256]int {
+	var r [256]int
+	for _, model := range m.Models {
+		for _, v := range model.voxels() {
+			r[v.ColorIndex]++
+		}
+	}
+	return r
+}
+
+// UnusedColors returns the palette indices (other than 0, which
+// means an empty voxel) that aren't used by any voxel.
+func (m *Main) UnusedColors() []uint8 {
+	usage := m.ColorUsage()
+	var r []uint8
+	for i := 1; i < 256; i++ {
+		if usage[i] == 0 {
+			r = append(r, uint8(i))
+		}
+	}
+	return r
+}
+
+// CompactPalette renumbers the palette so that the colors used by
+// the voxels occupy indices 1, 2, 3, and so on, keeping their
+// original order. The materials of unused colors are moved after the
+// used ones, and the voxels of every model are updated to use the new
+// indices. Index 0 always means an empty voxel, so it's left alone.
+// Models parsed with ParseOptions.LazyModels are decoded first, and
+// CompactPalette returns an error, without changing m, if one of them
+// is invalid.
+func (m *Main) CompactPalette() error {
+	for i := range m.Models {
+		if _, err := m.Models[i].Voxels(); err != nil {
+			return fmt.Errorf("model %d: %w", i, err)
+		}
+	}
+	for len(m.Materials) < 256 {
+		m.Materials = append(m.Materials, NewMaterial(MaterialDiffuse))
+	}
+	usage := m.ColorUsage()
+	var remap [256]uint8
+	mats := append([]Material{}, m.Materials...)
+	next := 1
+	for _, used := range []bool{true, false} {
+		for i := 1; i < 256; i++ {
+			if (usage[i] != 0) == used {
+				remap[i] = uint8(next)
+				mats[next] = m.Materials[i]
+				next++
+			}
+		}
+	}
+	m.Materials = mats
+	for _, model := range m.Models {
+		for i, v := range model.V {
+			model.V[i].ColorIndex = remap[v.ColorIndex]
+		}
+		// Used colors keep their order, so the hint stays sorted.
+		for i, c := range model.PaletteHint {
+			model.PaletteHint[i] = remap[c]
+		}
+	}
+	return nil
+}
+
+// NearestColorIndex returns the palette index (other than 0, which
+// means an empty voxel) whose color is closest to c, measuring the
+// distance between colors as the squared difference of their red,
+// green, blue and alpha components. If several entries are equally
+// close, the smallest index is returned. It returns 0 if the palette
+// has no entries other than 0.
+func (m *Main) NearestColorIndex(c color.RGBA) uint8 {
+	best, bestD := 0, -1
+	for i := 1; i < len(m.Materials) && i < 256; i++ {
+		pc := m.Materials[i].Color
+		d := 0
+		for _, diff := range [4]int{
+			int(pc.R) - int(c.R), int(pc.G) - int(c.G), int(pc.B) - int(c.B), int(pc.A) - int(c.A),
+		} {
+			d += diff * diff
+		}
+		if bestD == -1 || d < bestD {
+			best, bestD = i, d
+		}
+	}
+	return uint8(best)
+}
+
+// ColorPalette returns the colors of the 256 palette entries as a
+// color.Palette, so that the palette can be used with image.Paletted
+// and other parts of the image packages. The colors are those returned
+// by Palette, so entries without a material are transparent black, and
+// entry 0 may be opaque. Note that the palette's Index method may
+// return 0, which for voxels means empty: use NearestColorIndex to
+// find a color for a non-empty voxel.
+func (m *Main) ColorPalette() color.Palette {
+	p := make(color.Palette, 256)
+	for i, c := range m.Palette() {
+		p[i] = c
+	}
+	return p
+}
+
+// Colors returns the colors of the 256 palette entries as a slice of
+// color.Color, for use with code that takes a list of colors. As with
+// Palette, entries without a material are transparent black, and entry
+// 0 may be opaque.
+func (m *Main) Colors() []color.Color {
+	r := make([]color.Color, 256)
+	for i, c := range m.Palette() {
+		r[i] = c
+	}
+	return r
+}
+
+// colorCount is a color, and the number of times it appears.
+type colorCount struct {
+	c [4]int // r, g, b, a
+	n int
+}
+
+// QuantizePalette reduces an arbitrary set of colors (for example, the
+// pixels of an image) to a palette of at most n colors, using the
+// median cut algorithm. It returns the palette, using entries 1 to n
+// since index 0 means an empty voxel, and for each of the input
+// colors, the index of the palette entry that represents it. If there
+// are at most n different colors, they are all represented exactly.
+// n must be between 1 and 255.
+func QuantizePalette(colors []color.RGBA, n int) ([256]color.RGBA, []uint8) {
+	if n < 1 || n > 255 {
+		panic(fmt.Sprintf("vox: QuantizePalette palette size %d must be between 1 and 255", n))
+	}
+	var pal [256]color.RGBA
+	mapping := make([]uint8, len(colors))
+	if len(colors) == 0 {
+		return pal, mapping
+	}
+
+	counts := map[color.RGBA]int{}
+	for _, c := range colors {
+		counts[c]++
+	}
+	var all []colorCount
+	for c, k := range counts {
+		all = append(all, colorCount{[4]int{int(c.R), int(c.G), int(c.B), int(c.A)}, k})
+	}
+	// Sort the colors so the result doesn't depend on map order.
+	sort.Slice(all, func(i, j int) bool {
+		for k := 0; k < 4; k++ {
+			if all[i].c[k] != all[j].c[k] {
+				return all[i].c[k] < all[j].c[k]
+			}
+		}
+		return false
+	})
+
+	// Repeatedly split the box with the widest range of values on any
+	// channel, at the median of the colors in it along that channel.
+	boxes := [][]colorCount{all}
+	for len(boxes) < n {
+		best, bestChannel, bestRange := -1, 0, 0
+		for i, b := range boxes {
+			for k := 0; k < 4; k++ {
+				lo, hi := 255, 0
+				for _, cc := range b {
+					if cc.c[k] < lo {
+						lo = cc.c[k]
+					}
+					if cc.c[k] > hi {
+						hi = cc.c[k]
+					}
+				}
+				if hi-lo > bestRange {
+					best, bestChannel, bestRange = i, k, hi-lo
+				}
+			}
+		}
+		if best == -1 {
+			// Every box contains a single color.
+			break
+		}
+		b := boxes[best]
+		sort.SliceStable(b, func(i, j int) bool { return b[i].c[bestChannel] < b[j].c[bestChannel] })
+		total := 0
+		for _, cc := range b {
+			total += cc.n
+		}
+		split, seen := 1, b[0].n
+		for split < len(b)-1 && 2*seen < total {
+			seen += b[split].n
+			split++
+		}
+		boxes[best] = b[:split]
+		boxes = append(boxes, b[split:])
+	}
+
+	index := map[color.RGBA]uint8{}
+	for i, b := range boxes {
+		var sum [4]int
+		total := 0
+		for _, cc := range b {
+			for k := range sum {
+				sum[k] += cc.c[k] * cc.n
+			}
+			total += cc.n
+		}
+		var avg [4]uint8
+		for k := range sum {
+			avg[k] = uint8((sum[k] + total/2) / total)
+		}
+		pal[i+1] = color.RGBA{avg[0], avg[1], avg[2], avg[3]}
+		for _, cc := range b {
+			index[color.RGBA{uint8(cc.c[0]), uint8(cc.c[1]), uint8(cc.c[2]), uint8(cc.c[3])}] = uint8(i + 1)
+		}
+	}
+	for i, c := range colors {
+		mapping[i] = index[c]
+	}
+	return pal, mapping
+}
@@ -0,0 +1,161 @@
+package vox
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestColorUsage(t *testing.T) {
+	m := &Main{
+		Models: []Model{
+			{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {1, 0, 0, 3}}},
+			{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 3}}},
+		},
+	}
+	usage := m.ColorUsage()
+	for i, n := range usage {
+		want := 0
+		switch i {
+		case 1:
+			want = 1
+		case 3:
+			want = 2
+		}
+		if n != want {
+			t.Errorf("usage[%d] = %d, want %d", i, n, want)
+		}
+	}
+	unused := m.UnusedColors()
+	if len(unused) != 253 || unused[0] != 2 || unused[1] != 4 || unused[252] != 255 {
+		t.Errorf("UnusedColors() = %v, want 2, 4, 5, ... 255", unused)
+	}
+}
+
+func TestCompactPalette(t *testing.T) {
+	m := &Main{
+		Models: []Model{
+			{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 10}, {1, 0, 0, 200}}},
+			{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 10}}},
+		},
+	}
+	for i := 0; i < 256; i++ {
+		m.Materials = append(m.Materials, Material{Color: color.RGBA{uint8(i), 0, 0, 255}})
+	}
+	m.Models[0].UpdatePaletteHint()
+	if got, want := m.Models[0].PaletteHint, []uint8{10, 200}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PaletteHint = %v, want %v", got, want)
+	}
+	if err := m.CompactPalette(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Models[0].PaletteHint, []uint8{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after compacting, PaletteHint = %v, want %v", got, want)
+	}
+	if got := m.Models[0].V; got[0].ColorIndex != 1 || got[1].ColorIndex != 2 {
+		t.Errorf("model 0 voxels = %v, want colors 1 and 2", got)
+	}
+	if got := m.Models[1].V[0].ColorIndex; got != 1 {
+		t.Errorf("model 1 voxel has color %d, want 1", got)
+	}
+	for i, want := range map[int]uint8{0: 0, 1: 10, 2: 200, 3: 1, 4: 2, 12: 11, 255: 255} {
+		if got := m.Materials[i].Color.R; got != want {
+			t.Errorf("material %d has color from index %d, want %d", i, got, want)
+		}
+	}
+	if len(m.Materials) != 256 {
+		t.Errorf("got %d materials, want 256", len(m.Materials))
+	}
+}
+
+func TestNearestColorIndex(t *testing.T) {
+	m := &Main{Materials: make([]Material, 256)}
+	m.Materials[0].Color = color.RGBA{255, 0, 0, 255}
+	m.Materials[3].Color = color.RGBA{250, 10, 0, 255}
+	m.Materials[4].Color = color.RGBA{0, 0, 250, 255}
+	for i := 5; i < 256; i++ {
+		m.Materials[i].Color = color.RGBA{0, 0, 0, 255}
+	}
+	for _, tc := range []struct {
+		c    color.RGBA
+		want uint8
+	}{
+		{color.RGBA{255, 0, 0, 255}, 3},
+		{color.RGBA{0, 0, 255, 255}, 4},
+		{color.RGBA{0, 0, 0, 0}, 1},
+		{color.RGBA{0, 0, 0, 255}, 5},
+	} {
+		if got := m.NearestColorIndex(tc.c); got != tc.want {
+			t.Errorf("NearestColorIndex(%v) = %d, want %d", tc.c, got, tc.want)
+		}
+	}
+
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dw.SetColor([3]int{1, 0, 0}, color.RGBA{200, 0, 0, 255}, m) {
+		t.Fatalf("SetColor failed")
+	}
+	if idx, _ := dw.MaterialIndex([3]int{1, 0, 0}); idx != 3 {
+		t.Errorf("SetColor(red) set index %d, want 3", idx)
+	}
+	if dw.SetColor([3]int{2, 0, 0}, color.RGBA{200, 0, 0, 255}, m) {
+		t.Errorf("SetColor outside the world succeeded")
+	}
+}
+
+func TestQuantizePalette(t *testing.T) {
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {255, 0, 0, 255}, {0, 0, 255, 128}}
+	pal, mapping := QuantizePalette(colors, 4)
+	for i, c := range colors {
+		if got := pal[mapping[i]]; got != c || mapping[i] == 0 {
+			t.Errorf("color %v maps to index %d with color %v", c, mapping[i], got)
+		}
+	}
+
+	// A gradient of 1000 grays, reduced to 16 colors.
+	colors = nil
+	for i := 0; i < 1000; i++ {
+		g := uint8(i * 256 / 1000)
+		colors = append(colors, color.RGBA{g, g, g, 255})
+	}
+	pal, mapping = QuantizePalette(colors, 16)
+	used := map[uint8]bool{}
+	for i, c := range colors {
+		idx := mapping[i]
+		used[idx] = true
+		if idx == 0 || idx > 16 {
+			t.Fatalf("color %v maps to index %d, want 1 to 16", c, idx)
+		}
+		if d := int(pal[idx].R) - int(c.R); d < -16 || d > 16 {
+			t.Errorf("color %v maps to %v, which is too far away", c, pal[idx])
+		}
+	}
+	if len(used) != 16 {
+		t.Errorf("palette uses %d colors, want 16", len(used))
+	}
+}
+
+func TestColorPalette(t *testing.T) {
+	m := &Main{Materials: make([]Material, 10)}
+	m.Materials[3].Color = color.RGBA{10, 20, 30, 255}
+	m.Materials[7].Color = color.RGBA{200, 200, 200, 255}
+	p := m.ColorPalette()
+	if len(p) != 256 {
+		t.Fatalf("ColorPalette() has %d colors, want 256", len(p))
+	}
+	if got := p[3]; got != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("ColorPalette()[3] = %v, want %v", got, m.Materials[3].Color)
+	}
+	if got := p[100]; got != (color.RGBA{}) {
+		t.Errorf("ColorPalette()[100] = %v, want transparent black", got)
+	}
+	if got := p.Index(color.RGBA{190, 210, 200, 255}); got != 7 {
+		t.Errorf("ColorPalette().Index(light gray) = %d, want 7", got)
+	}
+	cs := m.Colors()
+	if len(cs) != 256 || cs[3] != p[3] || cs[100] != p[100] {
+		t.Errorf("Colors() = %v, want the same colors as ColorPalette()", cs)
+	}
+}
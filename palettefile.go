@@ -0,0 +1,171 @@
+package vox
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Palette returns the colors of m's palette, indexed by color index.
+// Entries without a material are transparent black. Entry 0 is the
+// color of Materials[0], which no voxel uses, but which for a parsed
+// file is the last entry of its RGBA chunk, and so may be opaque.
+func (m *Main) Palette() [256]color.RGBA {
+	var pal [256]color.RGBA
+	for i := 0; i < len(m.Materials) && i < 256; i++ {
+		pal[i] = m.Materials[i].Color
+	}
+	return pal
+}
+
+// RawPalette returns the colors of m's palette in the order they're
+// stored in the RGBA chunk of a file, which is what Encode writes:
+// entry i is the color of index i+1, and the last entry is the color
+// of index 0 (see Main.Materials). It's Palette rotated by one place.
+func (m *Main) RawPalette() [256]color.RGBA {
+	return rawPalette(m.Palette())
+}
+
+// rawPalette returns the colors of pal, which is indexed by color
+// index, in the order of an RGBA chunk.
+func rawPalette(pal [256]color.RGBA) [256]color.RGBA {
+	var raw [256]color.RGBA
+	for i := range raw {
+		raw[i] = pal[(i+1)%256]
+	}
+	return raw
+}
+
+// paletteFromRaw returns the colors of raw, which are in the order of
+// an RGBA chunk, indexed by color index. It's the inverse of rawPalette.
+func paletteFromRaw(raw [256]color.RGBA) [256]color.RGBA {
+	var pal [256]color.RGBA
+	for i := range pal {
+		pal[i] = raw[(i+255)%256]
+	}
+	return pal
+}
+
+// SetPalette sets the colors of m's materials to the colors of pal,
+// indexed by color index, adding diffuse materials if m has fewer than
+// 256. pal[1] is the color of voxels with color index 1, and pal[0] is
+// the unused last entry of the file's RGBA chunk. For palettes in the
+// order of an RGBA chunk, such as those exported by many tools, where
+// the first entry is the color of index 1, use SetRawPalette.
+func (m *Main) SetPalette(pal [256]color.RGBA) {
+	for len(m.Materials) < 256 {
+		m.Materials = append(m.Materials, NewMaterial(MaterialDiffuse))
+	}
+	for i, c := range pal {
+		m.Materials[i].Color = c
+	}
+}
+
+// SetRawPalette is like SetPalette, but raw is in the order of an RGBA
+// chunk, as returned by RawPalette: raw[i] is the color of index i+1.
+func (m *Main) SetRawPalette(raw [256]color.RGBA) {
+	m.SetPalette(paletteFromRaw(raw))
+}
+
+// WriteGPL writes pal, which is indexed by color index, as a GIMP
+// palette file.
+//
+// Like WritePalettePNG, the colors are written in the order of the
+// RGBA chunk of a .vox file, not in order of color index: the first
+// color is the color of index 1, and the last is the color of index 0.
+// That's the order of the palettes that MagicaVoxel and most other
+// tools use. GIMP palettes have no alpha channel, so the alpha of each
+// color is lost.
+func WriteGPL(w io.Writer, pal [256]color.RGBA) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: vox\nColumns: 16\n#\n")
+	for i, c := range rawPalette(pal) {
+		fmt.Fprintf(bw, "%3d %3d %3d\tIndex %d\n", c.R, c.G, c.B, (i+1)%256)
+	}
+	return bw.Flush()
+}
+
+// ReadGPL reads a GIMP palette file, such as one written by WriteGPL,
+// and returns its colors indexed by color index.
+//
+// Like ReadPalettePNG, the colors in the file are in the order of the
+// RGBA chunk of a .vox file: the first color is the color of index 1,
+// and a 256th color is the color of index 0. The colors are opaque. If
+// the file has fewer than 256 colors, the remaining entries, including
+// index 0, are transparent black.
+func ReadGPL(r io.Reader) ([256]color.RGBA, error) {
+	var pal, raw [256]color.RGBA
+	s := bufio.NewScanner(r)
+	if !s.Scan() || strings.TrimSpace(s.Text()) != "GIMP Palette" {
+		if err := s.Err(); err != nil {
+			return pal, err
+		}
+		return pal, fmt.Errorf("not a GIMP palette file")
+	}
+	n := 0
+	for line := 2; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "Name:") || strings.HasPrefix(text, "Columns:") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return pal, fmt.Errorf("line %d: expected a color, got %q", line, text)
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return pal, fmt.Errorf("line %d: bad color component %q", line, fields[i])
+			}
+			rgb[i] = uint8(v)
+		}
+		if n == 256 {
+			return pal, fmt.Errorf("line %d: palette has more than 256 colors", line)
+		}
+		raw[n] = color.RGBA{rgb[0], rgb[1], rgb[2], 255}
+		n++
+	}
+	return paletteFromRaw(raw), s.Err()
+}
+
+// WritePalettePNG writes pal, which is indexed by color index, as a
+// MagicaVoxel palette image: a 256x1 PNG in which pixel x has the color
+// of index x+1, in the same order as the RGBA chunk of a .vox file and
+// the colors written by WriteGPL. The last pixel is unused, and is the
+// color of index 0.
+func WritePalettePNG(w io.Writer, pal [256]color.RGBA) error {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 1))
+	for x, c := range rawPalette(pal) {
+		img.SetNRGBA(x, 0, color.NRGBA{c.R, c.G, c.B, c.A})
+	}
+	return png.Encode(w, img)
+}
+
+// ReadPalettePNG reads a MagicaVoxel palette image, as written by
+// WritePalettePNG, and returns its colors indexed by color index. As
+// with ReadGPL, the first pixel is the color of index 1, and the last
+// is the color of index 0. The image must be 256 pixels wide and 1
+// pixel high.
+func ReadPalettePNG(r io.Reader) ([256]color.RGBA, error) {
+	var pal [256]color.RGBA
+	img, err := png.Decode(r)
+	if err != nil {
+		return pal, err
+	}
+	b := img.Bounds()
+	if b.Dx() != 256 || b.Dy() != 1 {
+		return pal, fmt.Errorf("palette image is %dx%d, but must be 256x1", b.Dx(), b.Dy())
+	}
+	var raw [256]color.RGBA
+	for x := range raw {
+		c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y)).(color.NRGBA)
+		raw[x] = color.RGBA{c.R, c.G, c.B, c.A}
+	}
+	return paletteFromRaw(raw), nil
+}
@@ -0,0 +1,131 @@
+package vox
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func testPalette() [256]color.RGBA {
+	var pal [256]color.RGBA
+	for i := range pal {
+		pal[i] = color.RGBA{uint8(i), uint8(255 - i), uint8(i * 7), 255}
+	}
+	return pal
+}
+
+func TestGPL(t *testing.T) {
+	pal := testPalette()
+	var b bytes.Buffer
+	if err := WriteGPL(&b, pal); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadGPL(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != pal {
+		t.Errorf("palette changed after writing and reading as GPL")
+	}
+
+	got, err = ReadGPL(strings.NewReader("GIMP Palette\nName: test\n# comment\n\n255 0 0 red\n  0 128 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first color is the color of index 1.
+	if got[1] != (color.RGBA{255, 0, 0, 255}) || got[2] != (color.RGBA{0, 128, 0, 255}) || got[3] != (color.RGBA{}) || got[0] != (color.RGBA{}) {
+		t.Errorf("ReadGPL gave %v, want empty, red, green, then empty", got[:4])
+	}
+	for _, bad := range []string{"", "JASC-PAL\n", "GIMP Palette\n1 2\n", "GIMP Palette\n1 2 256\n"} {
+		if _, err := ReadGPL(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadGPL(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestPalettePNG(t *testing.T) {
+	pal := testPalette()
+	pal[10].A = 128
+	var b bytes.Buffer
+	if err := WritePalettePNG(&b, pal); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadPalettePNG(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != pal {
+		t.Errorf("palette changed after writing and reading as PNG")
+	}
+
+	m := &Main{}
+	m.SetPalette(pal)
+	if len(m.Materials) != 256 || m.Palette() != pal {
+		t.Errorf("Palette() after SetPalette gave a different palette")
+	}
+}
+
+func TestPaletteFilesOrder(t *testing.T) {
+	// GPL and PNG palette files have their colors in the same order,
+	// so a palette can be converted from one to the other.
+	pal := testPalette()
+	var gpl, png bytes.Buffer
+	if err := WriteGPL(&gpl, pal); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePalettePNG(&png, pal); err != nil {
+		t.Fatal(err)
+	}
+	fromGPL, err := ReadGPL(bytes.NewReader(gpl.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPNG, err := ReadPalettePNG(&png)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromGPL != fromPNG {
+		t.Errorf("GPL and PNG files of the same palette read differently")
+	}
+	png.Reset()
+	if err := WritePalettePNG(&png, fromGPL); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadPalettePNG(&png); err != nil || got != pal {
+		t.Errorf("palette changed after converting from GPL to PNG (error %v)", err)
+	}
+
+	// The first color of both files is the color of index 1.
+	pal[0], pal[1] = color.RGBA{1, 2, 3, 255}, color.RGBA{4, 5, 6, 255}
+	gpl.Reset()
+	if err := WriteGPL(&gpl, pal); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(gpl.String(), "\n")
+	if got, want := lines[4], "  4   5   6\tIndex 1"; got != want {
+		t.Errorf("first color of GPL file is %q, want %q", got, want)
+	}
+	if got, want := lines[4+255], "  1   2   3\tIndex 0"; got != want {
+		t.Errorf("last color of GPL file is %q, want %q", got, want)
+	}
+}
+
+func TestSetRawPalette(t *testing.T) {
+	raw := testPalette()
+	m := &Main{}
+	m.SetRawPalette(raw)
+	if got := m.Materials[1].Color; got != raw[0] {
+		t.Errorf("index 1 has color %v, want the first raw entry %v", got, raw[0])
+	}
+	if got := m.Palette()[0]; got != raw[255] {
+		t.Errorf("index 0 has color %v, want the last raw entry %v", got, raw[255])
+	}
+	if got := m.RawPalette(); got != raw {
+		t.Errorf("RawPalette() doesn't give back the palette passed to SetRawPalette")
+	}
+	m.SetPalette(m.Palette())
+	if got := m.RawPalette(); got != raw {
+		t.Errorf("SetPalette(Palette()) changed the palette")
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"image/color"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"sort"
+	"sync"
 )
 
 const version = 150
@@ -16,10 +18,8 @@ const version = 150
 // parseChunk reads a RIFF chunk from the input, returning the ID (MAIN, MATL, etc.)
 // and the bytes that hold the contents of this chunk and any child contents.
 func parseChunk(vr *voxReader) (ID string, contents, childContents []byte, err error) {
-	id := vr.ReadBytes(4)
-	N := vr.ReadInt32()
-	M := vr.ReadInt32()
-	if err := vr.Error(); err != nil {
+	id, N, M, err := parseChunkHeader(vr)
+	if err != nil {
 		return "", nil, nil, err
 	}
 	c := vr.ReadBytes(int(N))
@@ -27,15 +27,37 @@ func parseChunk(vr *voxReader) (ID string, contents, childContents []byte, err e
 	if err := vr.Error(); err != nil {
 		return "", nil, nil, err
 	}
-	return string(id), c, cc, nil
+	return id, c, cc, nil
+}
+
+// parseChunkHeader reads the header of a RIFF chunk from the input,
+// returning the ID and the lengths of the chunk's contents and
+// children, which follow the header.
+func parseChunkHeader(vr *voxReader) (ID string, N, M int32, err error) {
+	id := vr.ReadBytes(4)
+	N = vr.ReadInt32()
+	M = vr.ReadInt32()
+	if err := vr.Error(); err != nil {
+		return "", 0, 0, err
+	}
+	if N < 0 || M < 0 {
+		return "", 0, 0, fmt.Errorf("chunk %q has negative length (%d bytes of contents, %d bytes of children)", id, N, M)
+	}
+	return string(id), N, M, nil
 }
 
 func buildMain(models []Model, rgba []color.RGBA, mats []Material, scene Scene) (*Main, error) {
 	if len(rgba) != 256 {
 		return nil, fmt.Errorf("expected 256 palette entries, but found %d", len(rgba))
 	}
-	for i := 1; i < 256; i++ {
-		mats[i].Color = rgba[i-1]
+	for len(mats) < 256 {
+		// Files without MATL chunks get the default material.
+		mats = append(mats, NewMaterial(MaterialDiffuse))
+	}
+	// Index 0 means an empty voxel, so the RGBA chunk starts with
+	// color 1, and its last entry is kept as the color of index 0.
+	for i := 0; i < 256; i++ {
+		mats[i].Color = rgba[(i+255)%256]
 	}
 	return &Main{
 		Models:    models,
@@ -104,6 +126,16 @@ func (s *ShapeNode) nodeCount(visited map[AnyNode]bool) (int, error) {
 	return 1, nil
 }
 
+// sortInt32s sorts s into increasing order.
+func sortInt32s(s []int32) {
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+}
+
+// buildScene links the nodes read from the file into a scene graph.
+// The maps are visited in order of node ID, so that the result (and
+// which error is returned for a bad scene) doesn't depend on the order
+// of map iteration. The children of each node are in the order they're
+// listed in the file.
 func buildScene(sceneIDs map[int32]AnyNode, sceneChildrenIDs map[int32][]int32, sceneLayers map[int32]int32, layerIDs map[int32]*Layer) (Scene, error) {
 	scene := Scene{}
 	for _, layer := range layerIDs {
@@ -111,10 +143,31 @@ func buildScene(sceneIDs map[int32]AnyNode, sceneChildrenIDs map[int32][]int32,
 	}
 	sort.Slice(scene.Layers, func(i, j int) bool { return scene.Layers[i].Index < scene.Layers[j].Index })
 
+	// Transform nodes refer to the layers stored in the scene, rather than
+	// the temporary copies read from the LAYR chunks.
+	sceneLayerIDs := map[int32]*Layer{}
+	for i := range scene.Layers {
+		sceneLayerIDs[scene.Layers[i].Index] = &scene.Layers[i]
+	}
+
+	var nodeIDs, layerNodeIDs, parentIDs []int32
+	for id := range sceneIDs {
+		nodeIDs = append(nodeIDs, id)
+	}
+	for id := range sceneLayers {
+		layerNodeIDs = append(layerNodeIDs, id)
+	}
+	for id := range sceneChildrenIDs {
+		parentIDs = append(parentIDs, id)
+	}
+	sortInt32s(nodeIDs)
+	sortInt32s(layerNodeIDs)
+	sortInt32s(parentIDs)
+
 	// The root node in the scene is a transform node with layer -1.
 	var top *TransformNode
-	for k, v := range sceneIDs {
-		if tn, ok := v.(*TransformNode); ok {
+	for _, k := range nodeIDs {
+		if tn, ok := sceneIDs[k].(*TransformNode); ok {
 			if lid, ok := sceneLayers[k]; ok && lid == -1 {
 				if top != nil {
 					return scene, fmt.Errorf("scene has two root nodes")
@@ -127,7 +180,8 @@ func buildScene(sceneIDs map[int32]AnyNode, sceneChildrenIDs map[int32][]int32,
 		return scene, fmt.Errorf("failed to find root node in the scene graph")
 	}
 
-	for nid, lid := range sceneLayers {
+	for _, nid := range layerNodeIDs {
+		lid := sceneLayers[nid]
 		n, ok := sceneIDs[nid]
 		if !ok {
 			return Scene{}, fmt.Errorf("missing node is marked to be on a layer?")
@@ -140,14 +194,15 @@ func buildScene(sceneIDs map[int32]AnyNode, sceneChildrenIDs map[int32][]int32,
 			// the root node has layer id -1.
 			continue
 		}
-		layer, ok := layerIDs[lid]
+		layer, ok := sceneLayerIDs[lid]
 		if !ok {
 			return Scene{}, fmt.Errorf("layer id %d not found", lid)
 		}
 		tn.Layer = layer
 	}
 
-	for scid, children := range sceneChildrenIDs {
+	for _, scid := range parentIDs {
+		children := sceneChildrenIDs[scid]
 		node, ok := sceneIDs[scid]
 		if !ok {
 			return Scene{}, fmt.Errorf("node %d has children, but doesn't exist in the scene graph", scid)
@@ -201,14 +256,23 @@ func parsePackChunk(c []byte) (int, error) {
 }
 
 // parseSizeChunk parses a SIZE chunk from the input,
-// returning the size it contains.
+// returning the size it contains. Each dimension must be between
+// 1 and 256.
 func parseSizeChunk(c []byte) ([3]int32, error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	x := vr.ReadInt32()
 	y := vr.ReadInt32()
 	z := vr.ReadInt32()
 	vr.RequireEOF("SIZE")
-	return [3]int32{x, y, z}, vr.Error()
+	if err := vr.Error(); err != nil {
+		return [3]int32{}, err
+	}
+	for _, d := range [3]int32{x, y, z} {
+		if d < 1 || d > 256 {
+			return [3]int32{}, fmt.Errorf("SIZE chunk has invalid size %dx%dx%d: each dimension must be between 1 and 256", x, y, z)
+		}
+	}
+	return [3]int32{x, y, z}, nil
 }
 
 // parseXYZIChunk parses an XYZI chunk from the input,
@@ -216,24 +280,45 @@ func parseSizeChunk(c []byte) ([3]int32, error) {
 func parseXYZIChunk(c []byte) ([]Voxel, error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	N := int(vr.ReadInt32())
-	v := []Voxel{}
-	for i := 0; i < N; i++ {
-		x := vr.ReadUint8()
-		y := vr.ReadUint8()
-		z := vr.ReadUint8()
-		idx := vr.ReadUint8()
-		v = append(v, Voxel{x, y, z, idx})
+	if err := vr.Error(); err != nil {
+		return nil, err
+	}
+	if N < 0 || N > (len(c)-4)/4 {
+		return nil, fmt.Errorf("XYZI chunk has %d voxels, but is only %d bytes long", N, len(c))
+	}
+	if len(c) != 4+4*N {
+		return nil, fmt.Errorf("expected EOF, but found at least one more byte in XYZI chunk")
+	}
+	// Decode the voxels directly from the chunk, rather than reading
+	// them a byte at a time: models can have millions of voxels.
+	b := c[4:]
+	v := make([]Voxel, N)
+	for i := range v {
+		v[i] = Voxel{b[4*i], b[4*i+1], b[4*i+2], b[4*i+3]}
 	}
-	vr.RequireEOF("XYZI")
-	return v, vr.Error()
+	return v, nil
 }
 
 // parseRGBAChunk parses an RGBA chunk from the input,
-// returning the colors it contains.
-func parseRGBAChunk(c []byte) ([]color.RGBA, error) {
+// returning the colors it contains. If o.AllowShortPalette is set, a
+// chunk with fewer than 256 colors is padded with the rest of the
+// default palette.
+func (o ParseOptions) parseRGBAChunk(c []byte) ([]color.RGBA, error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	r := make([]color.RGBA, 256)
-	for i := range r {
+	n := len(r)
+	if o.AllowShortPalette && len(c) < 4*len(r) {
+		if len(c)%4 != 0 {
+			return nil, fmt.Errorf("RGBA chunk has %d bytes, which isn't a whole number of colors", len(c))
+		}
+		n = len(c) / 4
+		o.logf("RGBA chunk has only %d colors, using the default palette for the rest\n", n)
+		// Entry i of the chunk is the color of index i+1.
+		for i := n; i < len(r); i++ {
+			r[i] = defaultPalette[(i+1)%256]
+		}
+	}
+	for i := 0; i < n; i++ {
 		cr := vr.ReadUint8()
 		cg := vr.ReadUint8()
 		cb := vr.ReadUint8()
@@ -247,7 +332,7 @@ func parseRGBAChunk(c []byte) ([]color.RGBA, error) {
 // parsenTRNChunk parses a nTRN (transform) node chunk from the input,
 // returning the ids it contains, along with the partially filled-in
 // TransformNode.
-func parsenTRNChunk(c []byte) (id, childID, layerID int32, n *TransformNode, err error) {
+func (o ParseOptions) parsenTRNChunk(c []byte) (id, childID, layerID int32, n *TransformNode, err error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	id = vr.ReadInt32()
 	attr := vr.ReadDict()
@@ -256,7 +341,7 @@ func parsenTRNChunk(c []byte) (id, childID, layerID int32, n *TransformNode, err
 	layerID = vr.ReadInt32()
 	nFrame := vr.ReadInt32()
 	frames := []*dict{}
-	for i := 0; i < int(nFrame); i++ {
+	for i := 0; i < int(nFrame) && vr.Error() == nil; i++ {
 		frames = append(frames, vr.ReadDict())
 	}
 
@@ -264,46 +349,48 @@ func parsenTRNChunk(c []byte) (id, childID, layerID int32, n *TransformNode, err
 		return 0, 0, 0, nil, err
 	}
 
-	if reserved != -1 {
-		return 0, 0, 0, nil, fmt.Errorf("reserved field in nTRN must be -1, got %d", reserved)
+	if err := o.checkReserved("nTRN", reserved); err != nil {
+		return 0, 0, 0, nil, err
 	}
 
-	if nFrame != 1 {
-		return 0, 0, 0, nil, fmt.Errorf("must have one frame in nTRN chunk, got %d", nFrame)
+	if nFrame < 1 {
+		return 0, 0, 0, nil, fmt.Errorf("must have at least one frame in nTRN chunk, got %d", nFrame)
 	}
 
 	name := attr.ReadString("_name", "")
 	hidden := attr.ReadBool("_hidden", false)
 
 	if err := attr.Error(); err != nil {
-		return 0, 0, 0, nil, fmt.Errorf("error reading nTRN chunk: %v", err)
+		return 0, 0, 0, nil, fmt.Errorf("error reading nTRN chunk: %w", err)
 	}
 
 	if err := attr.AssertNoUnreadFields(); err != nil {
-		return 0, 0, 0, nil, fmt.Errorf("unexpected field or fields in nTRN attributes: %v", err)
+		return 0, 0, 0, nil, fmt.Errorf("unexpected field or fields in nTRN attributes: %w", err)
 	}
 
-	r := frames[0].ReadMatrix3x3("_r", Matrix3x3Identity)
-	t := frames[0].Read3xInt32("_t", [3]int32{0, 0, 0})
+	// Animated files have a frame for each keyframe, with _f
+	// holding the index of the animation frame it starts at.
+	var tfs []TransformFrame
+	for _, frame := range frames {
+		r := frame.ReadMatrix3x3("_r", Matrix3x3Identity)
+		t := frame.Read3xInt32("_t", [3]int32{0, 0, 0})
+		f := frame.ReadInt("_f", 0)
 
-	if err := frames[0].Error(); err != nil {
-		return 0, 0, 0, nil, fmt.Errorf("error reading nTRN frame chunk: %v", err)
-	}
+		if err := frame.Error(); err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("error reading nTRN frame chunk: %w", err)
+		}
 
-	if err := frames[0].AssertNoUnreadFields(); err != nil {
-		return 0, 0, 0, nil, fmt.Errorf("unexpected field or fields in nTRN frame: %v", err)
+		if err := frame.AssertNoUnreadFields(); err != nil {
+			return 0, 0, 0, nil, fmt.Errorf("unexpected field or fields in nTRN frame: %w", err)
+		}
+		tfs = append(tfs, TransformFrame{R: r, T: t, Frame: f})
 	}
 
 	vr.RequireEOF("nTRN")
 
 	return id, childID, layerID, &TransformNode{
-		Node: Node{Name: name, Hidden: hidden},
-		Transforms: []TransformFrame{
-			{
-				R: r,
-				T: t,
-			},
-		},
+		Node:       Node{Name: name, Hidden: hidden},
+		Transforms: tfs,
 	}, vr.Error()
 }
 
@@ -316,22 +403,22 @@ func parsenGRPChunk(c []byte) (id int32, childIDs []int32, g *GroupNode, err err
 	attr := vr.ReadDict()
 	nChild := vr.ReadInt32()
 	childIDs = []int32{}
-	for i := 0; i < int(nChild); i++ {
+	for i := 0; i < int(nChild) && vr.Error() == nil; i++ {
 		childIDs = append(childIDs, vr.ReadInt32())
 	}
 
 	if err := vr.Error(); err != nil {
-		return 0, nil, nil, fmt.Errorf("error reading nGRP chunk: %v", err)
+		return 0, nil, nil, fmt.Errorf("error reading nGRP chunk: %w", err)
 	}
 
 	name := attr.ReadString("_name", "")
 	hidden := attr.ReadBool("_hidden", false)
 
 	if err := attr.Error(); err != nil {
-		return 0, nil, nil, fmt.Errorf("error reading nGRP chunk: %v", err)
+		return 0, nil, nil, fmt.Errorf("error reading nGRP chunk: %w", err)
 	}
 	if err := attr.AssertNoUnreadFields(); err != nil {
-		return 0, nil, nil, fmt.Errorf("unexpected fields in nGRP chunk attributes: %v", err)
+		return 0, nil, nil, fmt.Errorf("unexpected fields in nGRP chunk attributes: %w", err)
 	}
 
 	vr.RequireEOF("nGRP")
@@ -348,51 +435,80 @@ func parsenSHPChunk(c []byte) (id int32, modelIDs []int32, s *ShapeNode, err err
 	attr := vr.ReadDict()
 	nModel := vr.ReadInt32()
 	modelIDs = []int32{}
-	for i := 0; i < int(nModel); i++ {
+	var modelAttrs []*dict
+	for i := 0; i < int(nModel) && vr.Error() == nil; i++ {
 		modelIDs = append(modelIDs, vr.ReadInt32())
-		_ = vr.ReadDict()
+		modelAttrs = append(modelAttrs, vr.ReadDict())
 	}
 	if err := vr.Error(); err != nil {
-		return 0, nil, nil, fmt.Errorf("error reading nSHP chunk: %v", err)
+		return 0, nil, nil, fmt.Errorf("error reading nSHP chunk: %w", err)
+	}
+
+	// Each model has its own attributes, which in animated files
+	// hold the frame that the model is shown from. Any other
+	// attributes are kept as they are.
+	var frames []int32
+	var extra []map[string]string
+	animated, hasExtra := false, false
+	for _, ma := range modelAttrs {
+		f := ma.ReadInt("_f", 0)
+		if err := ma.Error(); err != nil {
+			return 0, nil, nil, fmt.Errorf("error reading nSHP model attributes: %w", err)
+		}
+		frames = append(frames, f)
+		if f != 0 {
+			animated = true
+		}
+		uf := ma.UnreadFields()
+		extra = append(extra, uf)
+		if uf != nil {
+			hasExtra = true
+		}
+	}
+	if !animated {
+		frames = nil
+	}
+	if !hasExtra {
+		extra = nil
 	}
 
 	name := attr.ReadString("_name", "")
 	hidden := attr.ReadBool("_hidden", false)
 
 	if err := attr.Error(); err != nil {
-		return 0, nil, nil, fmt.Errorf("error reading nSHP chunk: %v", err)
+		return 0, nil, nil, fmt.Errorf("error reading nSHP chunk: %w", err)
 	}
 	if err := attr.AssertNoUnreadFields(); err != nil {
-		return 0, nil, nil, fmt.Errorf("unexpected fields in nSHP chunk attributes: %v", err)
+		return 0, nil, nil, fmt.Errorf("unexpected fields in nSHP chunk attributes: %w", err)
 	}
 
 	vr.RequireEOF("nSHP")
-	return id, modelIDs, &ShapeNode{Node: Node{name, hidden}}, vr.Error()
+	return id, modelIDs, &ShapeNode{Node: Node{name, hidden}, Frames: frames, ModelAttrs: extra}, vr.Error()
 }
 
 // parseLAYRChunk parses a LAYR (layer) chunk from the input,
 // returning its ID and the layer information it contains.
-func parseLAYRChunk(c []byte) (int32, *Layer, error) {
+func (o ParseOptions) parseLAYRChunk(c []byte) (int32, *Layer, error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	id := vr.ReadInt32()
 	attr := vr.ReadDict()
 	reserved := vr.ReadInt32()
 
 	if err := vr.Error(); err != nil {
-		return 0, nil, fmt.Errorf("error reading LAYR chunk: %v", err)
+		return 0, nil, fmt.Errorf("error reading LAYR chunk: %w", err)
 	}
-	if reserved != -1 {
-		return 0, nil, fmt.Errorf("reserved field in LAYR chunk must be -1, got %d", reserved)
+	if err := o.checkReserved("LAYR", reserved); err != nil {
+		return 0, nil, err
 	}
 
 	name := attr.ReadString("_name", "")
 	hidden := attr.ReadBool("_hidden", false)
 
 	if err := attr.Error(); err != nil {
-		return 0, nil, fmt.Errorf("error reading LAYR chunk: %v", err)
+		return 0, nil, fmt.Errorf("error reading LAYR chunk: %w", err)
 	}
 	if err := attr.AssertNoUnreadFields(); err != nil {
-		return 0, nil, fmt.Errorf("unexpected fields in LAYR chunk attributes: %v", err)
+		return 0, nil, fmt.Errorf("unexpected fields in LAYR chunk attributes: %w", err)
 	}
 
 	vr.RequireEOF("LAYR")
@@ -425,14 +541,17 @@ func parseMatType(s string) (MaterialType, error) {
 func parseMatlChunk(c []byte) (int, Material, error) {
 	vr := &voxReader{r: bytes.NewReader(c)}
 	matID := vr.ReadInt32()
-	if matID < 0 {
+	if matID < 0 || matID > 256 {
 		return 0, Material{}, fmt.Errorf("material index %d out of range", matID)
 	}
 	d := vr.ReadDict()
 	vr.RequireEOF("MATL")
 	if err := vr.Error(); err != nil {
-		return 0, Material{}, fmt.Errorf("error reading MATL chunk: %v", err)
+		return 0, Material{}, fmt.Errorf("error reading MATL chunk: %w", err)
 	}
+	// Material 256 is the material of the RGBA chunk's last entry,
+	// which is stored as index 0 (see buildMain).
+	matID %= 256
 
 	// TODO: some of these floats need renormalizing.
 	matTypeS := d.ReadString("_type", "<missing>")
@@ -452,16 +571,23 @@ func parseMatlChunk(c []byte) (int, Material, error) {
 	_ = d.ReadFloat("_gw", 0)
 
 	if err := d.Error(); err != nil {
-		return 0, Material{}, fmt.Errorf("dict error reading MATL chunk: %v", err)
+		return 0, Material{}, fmt.Errorf("dict error reading MATL chunk: %w", err)
 	}
 
 	if err := d.AssertNoUnreadFields(); err != nil {
-		return 0, Material{}, fmt.Errorf("dict error -- unknown field: %v", err)
+		return 0, Material{}, fmt.Errorf("dict error -- unknown field: %w", err)
 	}
 
 	matType, err := parseMatType(matTypeS)
 	if err != nil {
-		return 0, Material{}, fmt.Errorf("error reading MATL chunk: %v", err)
+		return 0, Material{}, fmt.Errorf("error reading MATL chunk: %w", err)
+	}
+
+	fields := FieldType
+	for key, f := range matlFields {
+		if _, ok := d.d[key]; ok {
+			fields |= f
+		}
 	}
 
 	return int(matID), Material{
@@ -474,17 +600,313 @@ func parseMatlChunk(c []byte) (int, Material, error) {
 		Flux:        flux,
 		Plastic:     plastic,
 		LDR:         ldr,
+		Fields:      fields,
 	}, nil
 }
 
+// matlFields maps the keys in MATL chunks to the properties they hold.
+var matlFields = map[string]MaterialFields{
+	"_weight":  FieldWeight,
+	"_rough":   FieldRoughness,
+	"_spec":    FieldSpecular,
+	"_ior":     FieldIOR,
+	"_att":     FieldAttenuation,
+	"_flux":    FieldFlux,
+	"_plastic": FieldPlastic,
+	"_ldr":     FieldLDR,
+}
+
+// parseMATTChunk parses a MATT chunk, the material format used by
+// versions of MagicaVoxel before 0.99, returning the ID of the
+// material and its properties.
+func parseMATTChunk(c []byte) (int, Material, error) {
+	vr := &voxReader{r: bytes.NewReader(c)}
+	matID := vr.ReadInt32()
+	matType := vr.ReadInt32()
+	weight := vr.ReadFloat32()
+	bits := vr.ReadInt32()
+	// The properties that are present are stored in bit order.
+	var props [7]float32
+	for i := range props {
+		if bits&(1<<uint(i)) != 0 {
+			props[i] = vr.ReadFloat32()
+		}
+	}
+	vr.RequireEOF("MATT")
+	if err := vr.Error(); err != nil {
+		return 0, Material{}, fmt.Errorf("error reading MATT chunk: %w", err)
+	}
+	if matID < 1 || matID > 255 {
+		return 0, Material{}, fmt.Errorf("material index %d out of range", matID)
+	}
+	if matType < 0 || matType > int32(MaterialEmissive) {
+		return 0, Material{}, fmt.Errorf("unknown material type %d in MATT chunk", matType)
+	}
+
+	// The property values are normalized to [0, 1], and scaled
+	// the same way as the corresponding MATL fields. Power and glow
+	// are the old names of flux and ldr.
+	m := NewMaterial(MaterialType(matType))
+	m.Weight = weight * 100
+	m.Plastic = props[0] != 0
+	m.Roughness = props[1] * 100
+	m.Specular = props[2] * 100
+	if bits&(1<<3) != 0 {
+		m.IOR = props[3] + 1
+	}
+	if bits&(1<<4) != 0 {
+		m.Attenuation = props[4] * 100
+	}
+	m.Flux = props[5] * 100
+	m.LDR = props[6] * 100
+	m.Fields = FieldType | FieldWeight
+	for i, f := range []MaterialFields{FieldPlastic, FieldRoughness, FieldSpecular, FieldIOR, FieldAttenuation, FieldFlux, FieldLDR} {
+		if bits&(1<<uint(i)) != 0 {
+			m.Fields |= f
+		}
+	}
+	return int(matID), m, nil
+}
+
+// parseRObjChunk parses a rOBJ (render object) chunk from the input.
+// Render objects describe rendering settings, and the only ones we
+// understand are lights, and the voxel scale in the general settings.
+// Lights are the render objects with _type _inf and _uni (see Light):
+// there's no separate light chunk, such as an rLIGHT chunk, in files
+// written by MagicaVoxel.
+// If the chunk describes a light, that light is returned, and if it
+// holds the scale, the scale is returned. Otherwise they're nil.
+func parseRObjChunk(c []byte) (*Light, *[3]float32, error) {
+	vr := &voxReader{r: bytes.NewReader(c)}
+	d := vr.ReadDict()
+	vr.RequireEOF("rOBJ")
+	if err := vr.Error(); err != nil {
+		return nil, nil, fmt.Errorf("error reading rOBJ chunk: %w", err)
+	}
+
+	var l Light
+	switch d.ReadString("_type", "") {
+	case "_setting":
+		if _, ok := d.d["_scale"]; !ok {
+			return nil, nil, nil
+		}
+		scale := d.Read3xFloat("_scale", [3]float32{1, 1, 1})
+		if err := d.Error(); err != nil {
+			return nil, nil, fmt.Errorf("dict error reading rOBJ chunk: %w", err)
+		}
+		return nil, &scale, nil
+	case "_inf":
+		l.Type = LightInfinite
+		l.Angle = d.Read2xFloat("_angle", [2]float32{0, 0})
+		l.Area = d.ReadFloat("_area", 0)
+		l.Disk = d.ReadBool("_disk", false)
+	case "_uni":
+		l.Type = LightUniform
+	default:
+		return nil, nil, nil
+	}
+	l.Intensity = d.ReadFloat("_i", 0)
+	k := d.Read3xInt32("_k", [3]int32{255, 255, 255})
+	for _, x := range k {
+		if x < 0 || x > 255 {
+			return nil, nil, fmt.Errorf("light color %v out of range in rOBJ chunk", k)
+		}
+	}
+	l.Color = color.RGBA{uint8(k[0]), uint8(k[1]), uint8(k[2]), 255}
+
+	// We don't check for unread fields here: render settings change
+	// between versions of MagicaVoxel, and aren't needed to
+	// understand the models.
+	if err := d.Error(); err != nil {
+		return nil, nil, fmt.Errorf("dict error reading rOBJ chunk: %w", err)
+	}
+	return &l, nil, nil
+}
+
+// standardChunks are the IDs of the chunks that the parser understands.
+var standardChunks = map[string]bool{
+	"MAIN": true, "PACK": true, "SIZE": true, "XYZI": true,
+	"nTRN": true, "nGRP": true, "nSHP": true, "LAYR": true,
+	"RGBA": true, "MATL": true, "MATT": true, "rOBJ": true,
+}
+
+var (
+	chunkParsersMu sync.RWMutex
+	chunkParsers   = map[string]func([]byte) (interface{}, error){}
+)
+
+// RegisterChunkParser registers a function to parse chunks with the
+// given ID, so that tools can add their own chunks to .vox files.
+// When Parse finds a chunk with the ID, it calls fn with the contents
+// of the chunk, and adds the result to Main.CustomChunks. Chunks with
+// IDs that aren't registered are ignored.
+// RegisterChunkParser panics if the ID isn't 4 bytes long, is one of the
+// chunks that MagicaVoxel uses, or has already been registered.
+func RegisterChunkParser(id string, fn func([]byte) (interface{}, error)) {
+	if len(id) != 4 {
+		panic(fmt.Sprintf("vox: chunk ID %q must be 4 bytes long", id))
+	}
+	if standardChunks[id] {
+		panic(fmt.Sprintf("vox: can't register a parser for standard chunk %q", id))
+	}
+	chunkParsersMu.Lock()
+	defer chunkParsersMu.Unlock()
+	if _, ok := chunkParsers[id]; ok {
+		panic(fmt.Sprintf("vox: chunk parser for %q registered twice", id))
+	}
+	chunkParsers[id] = fn
+}
+
+// chunkParser returns the registered parser for chunks with the given ID,
+// or nil if there's none.
+func chunkParser(id string) func([]byte) (interface{}, error) {
+	chunkParsersMu.RLock()
+	defer chunkParsersMu.RUnlock()
+	return chunkParsers[id]
+}
+
+// ParseError is the error returned when a .vox file can't be parsed.
+// It records where in the file the problem was found.
+type ParseError struct {
+	Offset int64  // The byte offset in the file of the chunk (or data) that couldn't be parsed.
+	Chunk  string // The ID of the chunk that couldn't be parsed, or "" if the error isn't in a chunk.
+	Err    error  // The underlying error.
+}
+
+func (e *ParseError) Error() string {
+	if e.Chunk == "" {
+		return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s chunk at offset %d: %v", e.Chunk, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseOptions controls how .vox files are parsed.
+// The zero value gives the default behavior.
+type ParseOptions struct {
+	// Lenient allows the chunks in the file to appear in any order,
+	// rather than the order that MagicaVoxel writes them. Each XYZI
+	// chunk must still follow the SIZE chunk that describes it.
+	Lenient bool
+
+	// KeepChunkOrder records the order of the chunks in the file
+	// in Main.ChunkOrder.
+	KeepChunkOrder bool
+
+	// Logger is used to report chunks that are ignored because
+	// they aren't understood. If it's nil, the standard logger
+	// is used.
+	Logger *log.Logger
+
+	// LazyModels delays decoding the voxels of each model until
+	// Model.Voxels is called. Until then, the model's V is nil,
+	// so code that uses V directly must call Voxels first. Encode
+	// writes the original voxels of models that haven't been decoded.
+	LazyModels bool
+
+	// Only, if it's not nil, lists the IDs of the chunks to decode.
+	// Other chunks are skipped without being read into memory, and
+	// may appear in any order. Chunks that must be decoded together
+	// are included together: the SIZE and XYZI chunks, the scene
+	// graph's nTRN, nGRP and nSHP chunks (which also need the models
+	// and the LAYR chunks), and MATL and MATT. If the RGBA chunk is
+	// skipped, the palette is MagicaVoxel's default palette.
+	Only []string
+
+	// AllowNonStandardReserved accepts nTRN and LAYR chunks whose
+	// reserved field isn't -1, as written by some programs other
+	// than MagicaVoxel, logging a warning rather than failing.
+	AllowNonStandardReserved bool
+
+	// NoDefaultScene leaves Main.Scene empty when the file has no
+	// scene graph, as in files written before MagicaVoxel 0.99.
+	// Otherwise, such files get the scene that MagicaVoxel creates
+	// when it loads them: each model in its own shape node, at the
+	// origin, on layer 0.
+	NoDefaultScene bool
+
+	// AllowShortPalette accepts RGBA chunks with fewer than 256
+	// colors, as written by some programs other than MagicaVoxel,
+	// logging a warning rather than failing. The missing colors are
+	// taken from MagicaVoxel's default palette.
+	AllowShortPalette bool
+}
+
+// checkReserved checks that the reserved field of a chunk has the
+// value -1 that MagicaVoxel writes.
+func (o ParseOptions) checkReserved(id string, reserved int32) error {
+	if reserved == -1 {
+		return nil
+	}
+	if o.AllowNonStandardReserved {
+		o.logf("reserved field in %s chunk should be -1, got %d\n", id, reserved)
+		return nil
+	}
+	return fmt.Errorf("reserved field in %s chunk must be -1, got %d", id, reserved)
+}
+
+// wanted returns the set of chunk IDs to decode, or nil if every
+// chunk should be decoded.
+func (o ParseOptions) wanted() map[string]bool {
+	if o.Only == nil {
+		return nil
+	}
+	r := map[string]bool{}
+	add := func(ids ...string) {
+		for _, id := range ids {
+			r[id] = true
+		}
+	}
+	for _, id := range o.Only {
+		switch chunkGroup(id) {
+		case "SIZE":
+			add("PACK", "SIZE", "XYZI")
+		case "nTRN":
+			add("PACK", "SIZE", "XYZI", "nTRN", "nGRP", "nSHP", "LAYR")
+		case "MATL", "MATT":
+			add("MATL", "MATT")
+		default:
+			add(id)
+		}
+	}
+	return r
+}
+
+// logf logs a message using the options' logger.
+func (o ParseOptions) logf(format string, args ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
 // parseMainChunks parses the child chunks of a MAIN chunk.
-func parseMainChunks(vr *voxReader) (*Main, error) {
+func (o ParseOptions) parseMainChunks(vr *voxReader) (_ *Main, err error) {
+	// The offset and ID of the chunk being parsed, used to report errors.
+	var chunkOffset int64
+	var chunkID string
+	defer func() {
+		if err != nil {
+			err = &ParseError{Offset: chunkOffset, Chunk: chunkID, Err: err}
+		}
+	}()
+
 	state := statePack
 	pack := -1
 	models := []Model{}
 	var rgba []color.RGBA
 	mats := []Material{}
 	var size [3]int32
+	sizePending := false // whether we've read a SIZE chunk, but not its XYZI chunk.
+	var lights []Light
+	var scale [3]float32
+	var custom map[string][]interface{}
+	var order []string
 
 	// map ids to scene nodes
 	sceneIDs := map[int32]AnyNode{}
@@ -494,74 +916,160 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 	sceneLayer := map[int32]int32{}
 	// map layer IDs to the corresponding lyaer.
 	layerIDs := map[int32]*Layer{}
-
-	ignoredChunks := map[string]bool{
-		"rOBJ": true,
+	// map the IDs of shape nodes to the IDs of their models, which
+	// are resolved once all the models have been read.
+	shapeModels := map[int32][]int32{}
+
+	ignoredChunks := map[string]bool{}
+
+	// placed reports whether a chunk is allowed to appear here.
+	// In lenient mode, chunks can appear anywhere, and since skipped
+	// chunks aren't checked, the same is true when only some chunks
+	// are decoded.
+	wanted := o.wanted()
+	placed := func(ok bool) bool {
+		return ok || o.Lenient || wanted != nil
 	}
 
 	for {
-		id, c, cc, err := parseChunk(vr)
+		chunkOffset, chunkID = vr.Offset(), ""
+		var id string
+		var c, cc []byte
+		if wanted == nil {
+			id, c, cc, err = parseChunk(vr)
+		} else {
+			var n, m int32
+			id, n, m, err = parseChunkHeader(vr)
+			if err == nil && !wanted[id] {
+				if o.KeepChunkOrder {
+					order = append(order, id)
+				}
+				vr.Skip(int64(n) + int64(m))
+				if err := vr.Error(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err == nil {
+				c = vr.ReadBytes(int(n))
+				cc = vr.ReadBytes(int(m))
+				err = vr.Error()
+			}
+		}
 		if err == io.EOF {
+			if sizePending {
+				return nil, fmt.Errorf("SIZE chunk has no XYZI chunk")
+			}
 			if pack != -1 && len(models) != pack {
 				return nil, fmt.Errorf("expected %d models, but got %d", pack, len(models))
 			}
-			scene, err := buildScene(sceneIDs, sceneChildren, sceneLayer, layerIDs)
+			// Resolve the nodes in order of their IDs, so that the
+			// error for a missing model doesn't depend on map order.
+			var shapeIDs []int32
+			for id := range shapeModels {
+				shapeIDs = append(shapeIDs, id)
+			}
+			sortInt32s(shapeIDs)
+			for _, id := range shapeIDs {
+				node := sceneIDs[id].(*ShapeNode)
+				for _, modelID := range shapeModels[id] {
+					if modelID < 0 || int(modelID) >= len(models) {
+						return nil, fmt.Errorf("nSHP node %d refers to missing model ID %d", id, modelID)
+					}
+					node.Models = append(node.Models, &models[int(modelID)])
+				}
+			}
+			var scene Scene
+			if len(sceneIDs) == 0 && len(layerIDs) == 0 {
+				// An older file, without a scene graph.
+				if !o.NoDefaultScene && (wanted == nil || wanted["nTRN"]) {
+					scene = newScene(models)
+				}
+			} else if wanted == nil || wanted["nTRN"] {
+				scene, err = buildScene(sceneIDs, sceneChildren, sceneLayer, layerIDs)
+				if err != nil {
+					return nil, fmt.Errorf("error building scene graph: %w", err)
+				}
+			}
+			if rgba == nil && wanted != nil && !wanted["RGBA"] {
+				// The RGBA chunk was skipped, so use the default palette.
+				raw := rawPalette(defaultPalette)
+				rgba = raw[:]
+			}
+			main, err := buildMain(models, rgba, mats, scene)
 			if err != nil {
-				return nil, fmt.Errorf("error building scene graph: %v", err)
+				return nil, err
 			}
-			return buildMain(models, rgba, mats, scene)
+			main.Lights = lights
+			main.Scale = scale
+			main.CustomChunks = custom
+			main.ChunkOrder = order
+			return main, nil
 		}
 		if err != nil {
 			return nil, err
 		}
+		chunkID = id
+		if o.KeepChunkOrder {
+			order = append(order, id)
+		}
 		switch id {
 		case "PACK":
-			if state != statePack {
+			if !placed(state == statePack) || pack != -1 {
 				return nil, fmt.Errorf("PACK chunk must appear first in MAIN")
 			}
 			pack, err = parsePackChunk(c)
 			if err != nil {
 				return nil, err
 			}
-			state = stateSize
+			if state == statePack {
+				state = stateSize
+			}
 		case "SIZE":
 			if state == statePack {
 				state = stateSize
 			}
-			if state != stateSize {
+			if !placed(state == stateSize) || sizePending {
 				return nil, fmt.Errorf("misplaced SIZE chunk")
 			}
 			size, err = parseSizeChunk(c)
 			if err != nil {
 				return nil, err
 			}
+			sizePending = true
 			state = stateXYZI
 		case "XYZI":
-			if state != stateXYZI {
+			if !placed(state == stateXYZI) || !sizePending {
 				return nil, fmt.Errorf("misplaced XYZI chunk")
 			}
-			var vs []Voxel
-			vs, err = parseXYZIChunk(c)
-			if err != nil {
-				return nil, err
+			model := Model{X: int(size[0]), Y: int(size[1]), Z: int(size[2])}
+			if o.LazyModels {
+				model.raw = c
+			} else {
+				model.V, err = parseXYZIChunk(c)
+				if err != nil {
+					return nil, err
+				}
+				model.UpdatePaletteHint()
 			}
-			models = append(models, Model{X: int(size[0]), Y: int(size[1]), Z: int(size[2]), V: vs})
+			models = append(models, model)
+			sizePending = false
 			if pack != -1 && len(models) == pack {
 				state = stateSceneGraph
 			} else {
 				state = stateSize
 			}
 		case "nTRN":
-			if state == stateSize {
+			if state == stateSize && !o.Lenient {
 				if pack != -1 {
 					return nil, fmt.Errorf("missing models: expected %d but found %d", pack, len(models))
 				}
 				state = stateSceneGraph
 			}
-			if state != stateSceneGraph {
+			if !placed(state == stateSceneGraph) {
 				return nil, fmt.Errorf("misplaced nTRN chunk")
 			}
-			id, childID, layerID, node, err := parsenTRNChunk(c)
+			id, childID, layerID, node, err := o.parsenTRNChunk(c)
 			if err != nil {
 				return nil, err
 			}
@@ -572,7 +1080,7 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 			sceneChildren[id] = []int32{childID}
 			sceneLayer[id] = layerID
 		case "nGRP":
-			if state != stateSceneGraph {
+			if !placed(state == stateSceneGraph) {
 				return nil, fmt.Errorf("misplaced nGRP chunk")
 			}
 			id, childIDs, node, err := parsenGRPChunk(c)
@@ -585,7 +1093,7 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 			sceneIDs[id] = node
 			sceneChildren[id] = childIDs
 		case "nSHP":
-			if state != stateSceneGraph {
+			if !placed(state == stateSceneGraph) {
 				return nil, fmt.Errorf("misplaced nSHP chunk")
 			}
 			id, modelIDs, node, err := parsenSHPChunk(c)
@@ -595,21 +1103,16 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 			if _, ok := sceneIDs[id]; ok {
 				return nil, fmt.Errorf("node %d appears twice", id)
 			}
-			for _, modelID := range modelIDs {
-				if modelID < 0 || int(modelID) >= len(models) {
-					return nil, fmt.Errorf("nSHP node refers to missing model ID %d", modelID)
-				}
-				node.Models = append(node.Models, &models[int(modelID)])
-			}
+			shapeModels[id] = modelIDs
 			sceneIDs[id] = node
 		case "LAYR":
 			if state == stateSceneGraph {
 				state = stateLAYR
 			}
-			if state != stateLAYR {
+			if !placed(state == stateLAYR) {
 				return nil, fmt.Errorf("misplaced LAYR chunk")
 			}
-			id, layer, err := parseLAYRChunk(c)
+			id, layer, err := o.parseLAYRChunk(c)
 			if err != nil {
 				return nil, err
 			}
@@ -622,26 +1125,60 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 				// We've just finished parsing the layers
 				state = stateRGBA
 			}
-			if state != stateRGBA {
+			if (state == stateSize && pack == -1) || (state == stateSceneGraph && len(sceneIDs) == 0) {
+				// We've just finished parsing the models of a
+				// file without a scene graph.
+				state = stateRGBA
+			}
+			if !placed(state == stateRGBA) || rgba != nil {
 				return nil, fmt.Errorf("misplaced RGBA chunk")
 			}
-			rgba, err = parseRGBAChunk(c)
+			rgba, err = o.parseRGBAChunk(c)
+			if err != nil {
+				return nil, err
+			}
 			state = stateMatt
-		case "MATL":
-			if state != stateMatt {
-				return nil, fmt.Errorf("misplaced MATL chunk")
+		case "MATL", "MATT":
+			if !placed(state == stateMatt) {
+				return nil, fmt.Errorf("misplaced %s chunk", id)
 			}
-			idx, mat, err := parseMatlChunk(c)
+			parse := parseMatlChunk
+			if id == "MATT" {
+				parse = parseMATTChunk
+			}
+			idx, mat, err := parse(c)
 			if err != nil {
 				return nil, err
 			}
 			for len(mats) <= idx {
-				mats = append(mats, Material{})
+				mats = append(mats, NewMaterial(MaterialDiffuse))
 			}
 			mats[idx] = mat
+		case "rOBJ":
+			light, sc, err := parseRObjChunk(c)
+			if err != nil {
+				return nil, err
+			}
+			if light != nil {
+				lights = append(lights, *light)
+			}
+			if sc != nil {
+				scale = *sc
+			}
 		default:
+			if fn := chunkParser(id); fn != nil {
+				v, err := fn(c)
+				if err != nil {
+					return nil, err
+				}
+				if custom == nil {
+					custom = map[string][]interface{}{}
+				}
+				custom[id] = append(custom[id], v)
+				break
+			}
 			if !ignoredChunks[id] {
-				log.Printf("unexpected chunk %s\n", id)
+				o.logf("unexpected chunk %s\n", id)
 				ignoredChunks[id] = true // stop the error appearing multiple times
 			}
 			continue
@@ -653,47 +1190,189 @@ func parseMainChunks(vr *voxReader) (*Main, error) {
 }
 
 // parseMainChunk parses the top-level MAIN chunk in the .vox file.
-func parseMainChunk(vr *voxReader) (*Main, error) {
+func (o ParseOptions) parseMainChunk(vr *voxReader) (*Main, error) {
+	offset := vr.Offset()
 	id, contents, childContents, err := parseChunk(vr)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Offset: offset, Err: err}
 	}
 	if id != "MAIN" {
-		return nil, fmt.Errorf("missing MAIN chunk")
+		return nil, &ParseError{Offset: offset, Chunk: id, Err: fmt.Errorf("missing MAIN chunk")}
 	}
 	if len(contents) != 0 {
-		return nil, fmt.Errorf("unexpected MAIN contents")
+		return nil, &ParseError{Offset: offset, Chunk: id, Err: fmt.Errorf("unexpected MAIN contents")}
 	}
+	childOffset := vr.Offset() - int64(len(childContents))
 	vr.RequireEOF("MAIN")
-	return parseMainChunks(&voxReader{r: bytes.NewReader(childContents)})
+	return o.parseMainChunks(&voxReader{r: bytes.NewReader(childContents), off: childOffset})
 }
 
 // Parse reads and parses a magicavoxel .vox file.
-func Parse(r io.Reader) (*Main, error) {
+func (o ParseOptions) Parse(r io.Reader) (*Main, error) {
 	vr := &voxReader{r: r}
 	id := vr.ReadBytes(4)
 	ver := vr.ReadInt32()
 
 	if err := vr.Error(); err != nil {
-		return nil, fmt.Errorf("failed reading header: %v", err)
+		return nil, &ParseError{Offset: vr.Offset(), Err: fmt.Errorf("failed reading header: %w", err)}
 	}
 
 	if bytes.Compare(id, []byte("VOX ")) != 0 {
-		return nil, fmt.Errorf("not a magicavox file")
+		return nil, &ParseError{Err: fmt.Errorf("not a magicavox file")}
 	}
 	if ver != version {
-		return nil, fmt.Errorf("vox file must be version %d, got %d", version, ver)
+		return nil, &ParseError{Offset: 4, Err: fmt.Errorf("vox file must be version %d, got %d", version, ver)}
 	}
-	return parseMainChunk(vr)
+	return o.parseMainChunk(vr)
 }
 
-// Parse reads and parses the file with the given name as a magicavoxel .vox file.
-func ParseFile(filename string) (*Main, error) {
+// Peek reads the start of a magicavoxel .vox file, and returns its
+// version and the number of models it contains, without decoding the
+// voxels or the rest of the file. Unlike Parse, it doesn't require the
+// version to be one that this package supports.
+func Peek(r io.Reader) (ver int32, numModels int, err error) {
+	vr := &voxReader{r: r}
+	id := vr.ReadBytes(4)
+	ver = vr.ReadInt32()
+	if err := vr.Error(); err != nil {
+		return 0, 0, fmt.Errorf("failed reading header: %w", err)
+	}
+	if bytes.Compare(id, []byte("VOX ")) != 0 {
+		return 0, 0, fmt.Errorf("not a magicavox file")
+	}
+	id = vr.ReadBytes(4)
+	N := vr.ReadInt32()
+	M := vr.ReadInt32()
+	vr.Skip(int64(N))
+	if err := vr.Error(); err != nil {
+		return 0, 0, fmt.Errorf("failed reading MAIN chunk: %w", err)
+	}
+	if string(id) != "MAIN" {
+		return 0, 0, fmt.Errorf("expected MAIN chunk, got %q", id)
+	}
+	end := vr.Offset() + int64(M)
+	// The models come first, so stop at the first other chunk.
+	for vr.Offset() < end {
+		id, n, m, err := parseChunkHeader(vr)
+		if err != nil {
+			return 0, 0, err
+		}
+		switch id {
+		case "PACK":
+			c := vr.ReadBytes(int(n))
+			if err := vr.Error(); err != nil {
+				return 0, 0, err
+			}
+			numModels, err := parsePackChunk(c)
+			if err != nil {
+				return 0, 0, err
+			}
+			return ver, numModels, nil
+		case "SIZE":
+			numModels++
+		case "XYZI":
+		default:
+			return ver, numModels, nil
+		}
+		vr.Skip(int64(n) + int64(m))
+		if err := vr.Error(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return ver, numModels, nil
+}
+
+// ReadPalette reads the palette of a magicavoxel .vox file, indexed by
+// color index as in Main.Palette, without decoding the models, the
+// scene graph or any other chunks. It stops reading at the file's RGBA
+// chunk, or if it has none, returns the default palette. Like Peek, it
+// doesn't require the version to be one that this package supports.
+func ReadPalette(r io.Reader) ([256]color.RGBA, error) {
+	var pal [256]color.RGBA
+	vr := &voxReader{r: r}
+	id := vr.ReadBytes(4)
+	vr.ReadInt32()
+	if err := vr.Error(); err != nil {
+		return pal, fmt.Errorf("failed reading header: %w", err)
+	}
+	if bytes.Compare(id, []byte("VOX ")) != 0 {
+		return pal, fmt.Errorf("not a magicavox file")
+	}
+	id = vr.ReadBytes(4)
+	N := vr.ReadInt32()
+	M := vr.ReadInt32()
+	vr.Skip(int64(N))
+	if err := vr.Error(); err != nil {
+		return pal, fmt.Errorf("failed reading MAIN chunk: %w", err)
+	}
+	if string(id) != "MAIN" {
+		return pal, fmt.Errorf("expected MAIN chunk, got %q", id)
+	}
+	end := vr.Offset() + int64(M)
+	for vr.Offset() < end {
+		id, n, m, err := parseChunkHeader(vr)
+		if err != nil {
+			return pal, err
+		}
+		if id == "RGBA" {
+			c := vr.ReadBytes(int(n))
+			if err := vr.Error(); err != nil {
+				return pal, fmt.Errorf("failed reading RGBA chunk: %w", err)
+			}
+			rgba, err := ParseOptions{}.parseRGBAChunk(c)
+			if err != nil {
+				return pal, fmt.Errorf("error reading RGBA chunk: %w", err)
+			}
+			// The RGBA chunk starts with color 1, as in buildMain.
+			for i := range pal {
+				pal[i] = rgba[(i+255)%256]
+			}
+			return pal, nil
+		}
+		vr.Skip(int64(n) + int64(m))
+		if err := vr.Error(); err != nil {
+			return pal, err
+		}
+	}
+	return defaultPalette, nil
+}
+
+// ParseFile reads and parses the file with the given name as a magicavoxel .vox file.
+func (o ParseOptions) ParseFile(filename string) (*Main, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 	br := bufio.NewReader(f)
-	return Parse(br)
+	return o.Parse(br)
+}
+
+// ParseFS reads and parses the file with the given name in fsys as a
+// magicavoxel .vox file. It's useful for files in an embed.FS.
+func (o ParseOptions) ParseFS(fsys fs.FS, name string) (*Main, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	return o.Parse(br)
+}
+
+// Parse reads and parses a magicavoxel .vox file, using the default options.
+func Parse(r io.Reader) (*Main, error) {
+	return ParseOptions{}.Parse(r)
+}
+
+// ParseFile reads and parses the file with the given name as a magicavoxel .vox file,
+// using the default options.
+func ParseFile(filename string) (*Main, error) {
+	return ParseOptions{}.ParseFile(filename)
+}
+
+// ParseFS reads and parses the file with the given name in fsys as a
+// magicavoxel .vox file, using the default options.
+func ParseFS(fsys fs.FS, name string) (*Main, error) {
+	return ParseOptions{}.ParseFS(fsys, name)
 }
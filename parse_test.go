@@ -0,0 +1,883 @@
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// splitChunks returns the child chunks of the MAIN chunk in the
+// .vox file b, each including its header.
+func splitChunks(t *testing.T, b []byte) [][]byte {
+	var r [][]byte
+	for off := 20; off < len(b); {
+		n := int(binary.LittleEndian.Uint32(b[off+4:])) + int(binary.LittleEndian.Uint32(b[off+8:]))
+		r = append(r, b[off:off+12+n])
+		off += 12 + n
+	}
+	return r
+}
+
+// joinChunks returns a .vox file whose MAIN chunk has the given children.
+func joinChunks(chunks [][]byte) []byte {
+	var children []byte
+	for _, c := range chunks {
+		children = append(children, c...)
+	}
+	var b bytes.Buffer
+	b.WriteString("VOX ")
+	binary.Write(&b, binary.LittleEndian, int32(version))
+	b.WriteString("MAIN")
+	binary.Write(&b, binary.LittleEndian, int32(0))
+	binary.Write(&b, binary.LittleEndian, int32(len(children)))
+	b.Write(children)
+	return b.Bytes()
+}
+
+func TestParseLenient(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the palette and materials to the start, and the models to the end.
+	var first, models, rest [][]byte
+	for _, c := range splitChunks(t, orig) {
+		switch string(c[:4]) {
+		case "RGBA", "MATL":
+			first = append(first, c)
+		case "SIZE", "XYZI":
+			models = append(models, c)
+		default:
+			rest = append(rest, c)
+		}
+	}
+	reordered := joinChunks(append(append(first, rest...), models...))
+
+	if _, err := Parse(bytes.NewReader(reordered)); err == nil {
+		t.Errorf("strict parsing of reordered file succeeded, want error")
+	}
+	got, err := ParseOptions{Lenient: true}.Parse(bytes.NewReader(reordered))
+	if err != nil {
+		t.Fatalf("lenient parsing of reordered file failed: %v", err)
+	}
+	if g, w := describeScene(got, got.Scene.Node), describeScene(want, want.Scene.Node); g != w {
+		t.Errorf("scene = %s, want %s", g, w)
+	}
+	for i := range want.Materials {
+		if got.Materials[i] != want.Materials[i] {
+			t.Errorf("material %d = %v, want %v", i, got.Materials[i], want.Materials[i])
+		}
+	}
+
+	// Even in lenient mode, XYZI must follow its SIZE.
+	swapped := append([][]byte{models[1], models[0]}, models[2:]...)
+	if _, err := (ParseOptions{Lenient: true}).Parse(bytes.NewReader(joinChunks(append(rest, swapped...)))); err == nil {
+		t.Errorf("lenient parsing of XYZI before SIZE succeeded, want error")
+	}
+}
+
+func TestParseErrorOffset(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := splitChunks(t, orig)
+	// Corrupt the type of the first material.
+	offset := int64(20)
+	var matl []byte
+	for _, c := range chunks {
+		if string(c[:4]) == "MATL" {
+			matl = c
+			break
+		}
+		offset += int64(len(c))
+	}
+	if matl == nil {
+		t.Fatal("no MATL chunk found")
+	}
+	i := bytes.Index(matl, []byte("_diffuse"))
+	if i < 0 {
+		t.Fatal("MATL chunk doesn't have type _diffuse")
+	}
+	copy(matl[i:], "_unknown")
+	_, err = Parse(bytes.NewReader(joinChunks(chunks)))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Parse(corrupt file) = %v, want a ParseError", err)
+	}
+	if pe.Offset != offset || pe.Chunk != "MATL" {
+		t.Errorf("ParseError has offset %d and chunk %q, want %d and %q", pe.Offset, pe.Chunk, offset, "MATL")
+	}
+
+	// The MAIN chunk starts after the 8 byte header.
+	_, err = Parse(bytes.NewReader(orig[:50]))
+	if !errors.As(err, &pe) || pe.Offset != 8 {
+		t.Errorf("Parse(truncated file) = %v, want ParseError at offset 8", err)
+	}
+}
+
+func TestParseErrorWrapping(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/test.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(bytes.NewReader(orig[:50])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Parse(truncated file) = %v, want io.ErrUnexpectedEOF", err)
+	}
+	// A MATL chunk whose dict is cut short.
+	c := newChunk("MATL", func(vw *voxWriter) {
+		vw.WriteInt32(1)
+		vw.WriteDict([]dictEntry{{"_type", "_diffuse"}})
+	})
+	if _, _, err := parseMatlChunk(c.contents[:len(c.contents)-2]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("parsing truncated MATL chunk gave %v, want io.ErrUnexpectedEOF", err)
+	}
+	// A bad number in a dict wraps the strconv error.
+	c = newChunk("MATL", func(vw *voxWriter) {
+		vw.WriteInt32(1)
+		vw.WriteDict([]dictEntry{{"_type", "_diffuse"}, {"_rough", "x"}})
+	})
+	if _, _, err := parseMatlChunk(c.contents); !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("parsing MATL chunk with a bad float gave %v, want strconv.ErrSyntax", err)
+	}
+}
+
+func TestParseMatlIndex(t *testing.T) {
+	matl := func(id int32) []byte {
+		return newChunk("MATL", func(vw *voxWriter) {
+			vw.WriteInt32(id)
+			vw.WriteDict([]dictEntry{{"_type", "_metal"}})
+		}).contents
+	}
+	// Material 256 is stored at index 0, like the last RGBA entry.
+	for id, want := range map[int32]int{0: 0, 1: 1, 255: 255, 256: 0} {
+		if idx, _, err := parseMatlChunk(matl(id)); err != nil || idx != want {
+			t.Errorf("parsing MATL chunk %d gave index %d, error %v; want %d", id, idx, err, want)
+		}
+	}
+	for _, id := range []int32{-1, 257} {
+		if _, _, err := parseMatlChunk(matl(id)); err == nil {
+			t.Errorf("parsing MATL chunk %d succeeded, want error", id)
+		}
+	}
+}
+
+// smallMain returns a small file with a single voxel.
+func smallMain() *Main {
+	m := &Main{
+		Models: []Model{{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}},
+		Scene:  Scene{Layers: []Layer{{Index: 0}}},
+	}
+	for i := 0; i < 256; i++ {
+		m.Materials = append(m.Materials, NewMaterial(MaterialDiffuse))
+	}
+	m.Scene.Node = &TransformNode{
+		Transforms: []TransformFrame{{R: Matrix3x3Identity}},
+		Child: &GroupNode{Children: []AnyNode{
+			&TransformNode{
+				Layer:      &m.Scene.Layers[0],
+				Transforms: []TransformFrame{{R: Matrix3x3Identity}},
+				Child:      &ShapeNode{Models: []*Model{&m.Models[0]}},
+			},
+		}},
+	}
+	return m
+}
+
+// smallVox returns the encoding of smallMain.
+func smallVox(t testing.TB) []byte {
+	var b bytes.Buffer
+	if err := Encode(&b, smallMain()); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func FuzzParse(f *testing.F) {
+	// The testdata files are large, which makes fuzzing slow, so
+	// we also start from a much smaller file.
+	f.Add(smallVox(f))
+	for _, name := range []string{"test.vox", "scene.vox", "newattrs.vox"} {
+		b, err := ioutil.ReadFile("testdata/" + name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, o := range []ParseOptions{{}, {Lenient: true}} {
+			m, err := o.Parse(bytes.NewReader(b))
+			if err != nil {
+				if m != nil {
+					t.Errorf("Parse returned an error and a non-nil result")
+				}
+				continue
+			}
+			if len(m.Materials) < 256 {
+				t.Errorf("Parse returned %d materials, want at least 256", len(m.Materials))
+			}
+		}
+	})
+}
+
+func TestParseNegativeLengths(t *testing.T) {
+	le := func(x int32) []byte {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(x))
+		return b[:]
+	}
+	chunk := func(id string, n, m int32, contents ...[]byte) []byte {
+		b := append([]byte(id), le(n)...)
+		b = append(b, le(m)...)
+		for _, c := range contents {
+			b = append(b, c...)
+		}
+		return b
+	}
+	testCases := []struct {
+		desc  string
+		chunk []byte
+		want  string
+	}{
+		{"negative contents", chunk("SIZE", -12, 0), "negative length"},
+		{"negative children", chunk("SIZE", 0, -1), "negative length"},
+		{"negative dict string", chunk("nGRP", 16, 0, le(0), le(1), le(-5), le(0)), "negative length -5"},
+	}
+	for _, tc := range testCases {
+		// Parse leniently so the chunks don't need to appear in a full file.
+		_, err := ParseOptions{Lenient: true}.Parse(bytes.NewReader(joinChunks([][]byte{tc.chunk})))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Parse() = %v, want error containing %q", tc.desc, err, tc.want)
+		}
+	}
+}
+
+func TestPeek(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ver, n, err := Peek(bytes.NewReader(orig))
+	if err != nil || ver != version || n != len(main.Models) {
+		t.Errorf("Peek(scene.vox) = %d, %d, %v, want %d, %d, nil", ver, n, err, version, len(main.Models))
+	}
+
+	// With a PACK chunk, Peek doesn't need to read the models.
+	pack := append([]byte("PACK"), 4, 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0)
+	b := joinChunks([][]byte{pack})
+	if ver, n, err := Peek(bytes.NewReader(b)); err != nil || ver != version || n != 7 {
+		t.Errorf("Peek(PACK) = %d, %d, %v, want %d, 7, nil", ver, n, err, version)
+	}
+
+	if _, _, err := Peek(bytes.NewReader(orig[:100])); err == nil {
+		t.Errorf("Peek(truncated file) succeeded, want error")
+	}
+}
+
+func TestReadPalette(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pal, err := ReadPalette(bytes.NewReader(orig)); err != nil || pal != main.Palette() {
+		t.Errorf("ReadPalette(scene.vox) = %v, %v, want %v, nil", pal, err, main.Palette())
+	}
+
+	// Without an RGBA chunk, the palette is the default one.
+	var chunks [][]byte
+	for _, c := range splitChunks(t, orig) {
+		if string(c[:4]) != "RGBA" {
+			chunks = append(chunks, c)
+		}
+	}
+	if pal, err := ReadPalette(bytes.NewReader(joinChunks(chunks))); err != nil || pal != defaultPalette {
+		t.Errorf("ReadPalette(file without RGBA) = %v, %v, want the default palette", pal, err)
+	}
+
+	if _, err := ReadPalette(bytes.NewReader(orig[:100])); err == nil {
+		t.Errorf("ReadPalette(truncated file) succeeded, want error")
+	}
+}
+
+func TestParseLazyModels(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := ParseOptions{LazyModels: true}.Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Models that haven't been decoded are encoded as they were.
+	var wantEnc, gotEnc bytes.Buffer
+	if err := Encode(&wantEnc, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&gotEnc, lazy); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotEnc.Bytes(), wantEnc.Bytes()) {
+		t.Errorf("encoding lazily-parsed file gave different bytes")
+	}
+
+	// Readers decode the voxels if they need them.
+	if got, want := lazy.Hash(), want.Hash(); got != want {
+		t.Errorf("lazy Hash() = %x, want %x", got, want)
+	}
+	if got, want := lazy.ColorUsage(), want.ColorUsage(); got != want {
+		t.Errorf("lazy ColorUsage() = %v, want %v", got, want)
+	}
+	if !lazy.Models[0].Equal(&want.Models[0]) {
+		t.Errorf("lazy model 0 isn't Equal to the eagerly parsed model")
+	}
+	gotStats, err := lazy.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStats, err := want.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotStats != wantStats {
+		t.Errorf("lazy Stats() = %+v, want %+v", gotStats, wantStats)
+	}
+
+	for i := range lazy.Models {
+		m := &lazy.Models[i]
+		if m.V != nil {
+			t.Fatalf("model %d was decoded before calling Voxels", i)
+		}
+		vs, err := m.Voxels()
+		if err != nil {
+			t.Fatalf("model %d: Voxels() failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(vs, want.Models[i].V) || !reflect.DeepEqual(m.V, vs) {
+			t.Errorf("model %d: Voxels() returned different voxels to Parse", i)
+		}
+	}
+
+	bad := Model{X: 1, Y: 1, Z: 1, raw: []byte{5, 0, 0, 0}}
+	if _, err := bad.Voxels(); err == nil {
+		t.Errorf("Voxels() on a corrupt model succeeded, want error")
+	}
+}
+
+func TestLazyModelsChanged(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := ParseOptions{LazyModels: true}.Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting V replaces the voxels that haven't been decoded.
+	lazy.Models[0].V = []Voxel{{0, 0, 0, 1}}
+	want.Models[0].V = []Voxel{{0, 0, 0, 1}}
+	if err := lazy.CompactPalette(); err != nil {
+		t.Fatal(err)
+	}
+	if err := want.CompactPalette(); err != nil {
+		t.Fatal(err)
+	}
+	if lazy.Hash() != want.Hash() {
+		t.Errorf("after CompactPalette, the lazily parsed file has a different hash")
+	}
+	var gotEnc, wantEnc bytes.Buffer
+	if err := Encode(&gotEnc, lazy); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&wantEnc, want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotEnc.Bytes(), wantEnc.Bytes()) {
+		t.Errorf("encoding the changed lazily parsed file gave different bytes")
+	}
+}
+
+func TestParseOnly(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pal, err := ParseOptions{Only: []string{"RGBA"}}.Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pal.Models) != 0 || pal.Scene.Node != nil {
+		t.Errorf("parsing only RGBA found %d models and scene %v, want none", len(pal.Models), pal.Scene.Node)
+	}
+	for i := range want.Materials {
+		if pal.Materials[i].Color != want.Materials[i].Color {
+			t.Fatalf("parsing only RGBA gave color %d = %v, want %v", i, pal.Materials[i].Color, want.Materials[i].Color)
+		}
+	}
+
+	// The scene graph needs the models and layers.
+	scene, err := ParseOptions{Only: []string{"nSHP", "MATL"}}.Parse(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scene.Models, want.Models) || !reflect.DeepEqual(scene.Scene, want.Scene) {
+		t.Errorf("parsing only the scene graph gave a different scene")
+	}
+	if scene.Materials[5].Type != want.Materials[5].Type || scene.Materials[5].Color != defaultPalette[5] {
+		t.Errorf("parsing without RGBA gave material %v, want %v with the default color", scene.Materials[5], want.Materials[5])
+	}
+
+	// The default palette is only used if the RGBA chunk is skipped,
+	// not if it's missing.
+	var noRGBA [][]byte
+	for _, c := range splitChunks(t, smallVox(t)) {
+		if string(c[:4]) != "RGBA" {
+			noRGBA = append(noRGBA, c)
+		}
+	}
+	if _, err := Parse(bytes.NewReader(joinChunks(noRGBA))); err == nil {
+		t.Errorf("parsing a file without an RGBA chunk succeeded, want error")
+	}
+}
+
+func TestDefaultPalette(t *testing.T) {
+	for i, want := range map[int]color.RGBA{
+		1:   {0xff, 0xff, 0xff, 0xff},
+		2:   {0xff, 0xff, 0xcc, 0xff},
+		7:   {0xff, 0xcc, 0xff, 0xff},
+		215: {0, 0, 0x33, 0xff},
+		216: {0xee, 0, 0, 0xff},
+		255: {0x11, 0x11, 0x11, 0xff},
+	} {
+		if got := defaultPalette[i]; got != want {
+			t.Errorf("defaultPalette[%d] = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestParseSizeChunk(t *testing.T) {
+	size := func(x, y, z int32) []byte {
+		var b [12]byte
+		binary.LittleEndian.PutUint32(b[0:], uint32(x))
+		binary.LittleEndian.PutUint32(b[4:], uint32(y))
+		binary.LittleEndian.PutUint32(b[8:], uint32(z))
+		return b[:]
+	}
+	for _, tc := range []struct {
+		x, y, z int32
+		ok      bool
+	}{
+		{1, 1, 1, true},
+		{256, 256, 256, true},
+		{0, 5, 5, false},
+		{5, -1, 5, false},
+		{5, 5, 257, false},
+		{-1 << 31, 5, 5, false},
+	} {
+		got, err := parseSizeChunk(size(tc.x, tc.y, tc.z))
+		if tc.ok && (err != nil || got != [3]int32{tc.x, tc.y, tc.z}) {
+			t.Errorf("parseSizeChunk(%d, %d, %d) = %v, %v, want success", tc.x, tc.y, tc.z, got, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("parseSizeChunk(%d, %d, %d) succeeded, want error", tc.x, tc.y, tc.z)
+		}
+	}
+}
+
+func BenchmarkParseXYZIChunk(b *testing.B) {
+	const n = 1 << 20
+	c := make([]byte, 4+4*n)
+	binary.LittleEndian.PutUint32(c, n)
+	for i := 4; i < len(c); i++ {
+		c[i] = uint8(i)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(c)))
+	for i := 0; i < b.N; i++ {
+		if _, err := parseXYZIChunk(c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(orig)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(bytes.NewReader(orig)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// upperChunk is a custom chunk that holds an upper-case string.
+type upperChunk string
+
+func (u upperChunk) MarshalBinary() ([]byte, error) {
+	return []byte(strings.ToUpper(string(u))), nil
+}
+
+// The parser is registered once, since the registry is global and the
+// test may be run more than once.
+func init() {
+	RegisterChunkParser("zTST", func(b []byte) (interface{}, error) {
+		if len(b) == 0 {
+			return nil, errors.New("empty zTST chunk")
+		}
+		return upperChunk(b), nil
+	})
+}
+
+func TestCustomChunks(t *testing.T) {
+	m := smallMain()
+	m.CustomChunks = map[string][]interface{}{
+		"zTST": {[]byte("HELLO"), upperChunk("world")},
+		"zIGN": {[]byte("ignored")},
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	var logged strings.Builder
+	got, err := ParseOptions{Logger: log.New(&logged, "", 0)}.Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "unexpected chunk zIGN\n"; logged.String() != want {
+		t.Errorf("logged %q, want %q", logged.String(), want)
+	}
+	want := map[string][]interface{}{"zTST": {upperChunk("HELLO"), upperChunk("WORLD")}}
+	if !reflect.DeepEqual(got.CustomChunks, want) {
+		t.Errorf("CustomChunks = %v, want %v", got.CustomChunks, want)
+	}
+
+	m.CustomChunks = map[string][]interface{}{"zTST": {[]byte{}}}
+	b.Reset()
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(&b); err == nil || !strings.Contains(err.Error(), "empty zTST chunk") {
+		t.Errorf("Parse(file with bad custom chunk) = %v, want error", err)
+	}
+
+	m.CustomChunks = map[string][]interface{}{"zTST": {42}}
+	if err := Encode(&b, m); err == nil {
+		t.Errorf("Encode(file with int custom chunk) succeeded, want error")
+	}
+}
+
+func TestParseFrameIndex(t *testing.T) {
+	m := smallMain()
+	tn := m.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode)
+	tn.Transforms[0].Frame = 3
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn = got.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode)
+	if f := tn.Transforms[0].Frame; f != 3 {
+		t.Errorf("transform has frame %d, want 3", f)
+	}
+}
+
+func TestParseKeyframes(t *testing.T) {
+	var b bytes.Buffer
+	vw := &voxWriter{w: &b}
+	vw.WriteInt32(5)
+	vw.WriteDict(nil)
+	vw.WriteInt32(6)
+	vw.WriteInt32(-1)
+	vw.WriteInt32(0)
+	vw.WriteInt32(2)
+	vw.WriteDict([]dictEntry{{"_t", "1 2 3"}})
+	vw.WriteDict([]dictEntry{{"_f", "10"}, {"_t", "4 5 6"}, {"_r", "20"}})
+	_, _, _, tn, err := ParseOptions{}.parsenTRNChunk(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TransformFrame{
+		{R: Matrix3x3Identity, T: [3]int32{1, 2, 3}},
+		{R: 20, T: [3]int32{4, 5, 6}, Frame: 10},
+	}
+	if !reflect.DeepEqual(tn.Transforms, want) {
+		t.Errorf("parsed keyframes %v, want %v", tn.Transforms, want)
+	}
+}
+
+func TestParseShapeFrames(t *testing.T) {
+	shape := func(modelAttrs ...[]dictEntry) []byte {
+		var b bytes.Buffer
+		vw := &voxWriter{w: &b}
+		vw.WriteInt32(3)
+		vw.WriteDict(nil)
+		vw.WriteInt32(int32(len(modelAttrs)))
+		for i, attrs := range modelAttrs {
+			vw.WriteInt32(int32(i))
+			vw.WriteDict(attrs)
+		}
+		return b.Bytes()
+	}
+	_, ids, sn, err := parsenSHPChunk(shape(nil, []dictEntry{{"_f", "4"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{0, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("parsed model IDs %v, want %v", ids, want)
+	}
+	if want := []int32{0, 4}; !reflect.DeepEqual(sn.Frames, want) {
+		t.Errorf("parsed frames %v, want %v", sn.Frames, want)
+	}
+
+	if _, _, sn, err := parsenSHPChunk(shape(nil)); err != nil || sn.Frames != nil {
+		t.Errorf("parsing a shape without frames gave frames %v, error %v; want nil, nil", sn.Frames, err)
+	}
+
+	// Unknown model attributes are kept, and written back by Encode.
+	_, _, sn, err = parsenSHPChunk(shape([]dictEntry{{"_x", "1"}, {"_f", "2"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]string{{"_x": "1"}, nil}; !reflect.DeepEqual(sn.ModelAttrs, want) {
+		t.Errorf("parsed model attributes %v, want %v", sn.ModelAttrs, want)
+	}
+	m := smallMain()
+	m.Scene.Node = &TransformNode{
+		Transforms: []TransformFrame{identityFrame},
+		Child:      &ShapeNode{Models: []*Model{&m.Models[0]}, ModelAttrs: []map[string]string{{"_x": "1", "_a": "b"}}},
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]string{{"_x": "1", "_a": "b"}}; !reflect.DeepEqual(got.Scene.Node.Child.(*ShapeNode).ModelAttrs, want) {
+		t.Errorf("after encoding, model attributes are %v, want %v", got.Scene.Node.Child.(*ShapeNode).ModelAttrs, want)
+	}
+}
+
+func TestParseMissingModels(t *testing.T) {
+	// Several shapes refer to models that aren't in the file, and
+	// the error must always be about the same one.
+	m := smallMain()
+	for i := 0; i < 4; i++ {
+		m.Models = append(m.Models, m.Models[0])
+	}
+	m.Scene = newScene(m.Models)
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	models := 0
+	for _, c := range splitChunks(t, b.Bytes()) {
+		if id := string(c[:4]); id == "SIZE" || id == "XYZI" {
+			if models++; models > 2 {
+				continue
+			}
+		}
+		chunks = append(chunks, c)
+	}
+	f := joinChunks(chunks)
+	var want string
+	for i := 0; i < 20; i++ {
+		_, err := Parse(bytes.NewReader(f))
+		if err == nil {
+			t.Fatal("parsing a file with missing models succeeded, want error")
+		}
+		if i == 0 {
+			want = err.Error()
+			if !strings.Contains(want, "missing model ID 1") {
+				t.Errorf("got error %q, want it to be about model 1", want)
+			}
+		} else if err.Error() != want {
+			t.Fatalf("got error %q, then %q", want, err)
+		}
+	}
+}
+
+func TestAllowNonStandardReserved(t *testing.T) {
+	chunks := splitChunks(t, smallVox(t))
+	found := false
+	for _, c := range chunks {
+		if string(c[:4]) == "LAYR" {
+			// The reserved field is the last thing in the chunk.
+			copy(c[len(c)-4:], []byte{0, 0, 0, 0})
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("no LAYR chunk found")
+	}
+	b := joinChunks(chunks)
+	if _, err := Parse(bytes.NewReader(b)); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Parse() with a reserved field of 0 gave error %v, want reserved field error", err)
+	}
+	var logged strings.Builder
+	opts := ParseOptions{AllowNonStandardReserved: true, Logger: log.New(&logged, "", 0)}
+	if _, err := opts.Parse(bytes.NewReader(b)); err != nil {
+		t.Errorf("Parse() with AllowNonStandardReserved failed: %v", err)
+	}
+	if want := "reserved field in LAYR chunk should be -1, got 0\n"; logged.String() != want {
+		t.Errorf("logged %q, want %q", logged.String(), want)
+	}
+}
+
+func TestAllowShortPalette(t *testing.T) {
+	c := []byte{1, 2, 3, 255, 4, 5, 6, 255}
+	if _, err := (ParseOptions{}).parseRGBAChunk(c); err == nil {
+		t.Errorf("parsing an RGBA chunk with 2 colors succeeded, want error")
+	}
+	var logged strings.Builder
+	opts := ParseOptions{AllowShortPalette: true, Logger: log.New(&logged, "", 0)}
+	pal, err := opts.parseRGBAChunk(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pal) != 256 {
+		t.Fatalf("got %d colors, want 256", len(pal))
+	}
+	if pal[0] != (color.RGBA{1, 2, 3, 255}) || pal[1] != (color.RGBA{4, 5, 6, 255}) {
+		t.Errorf("first colors are %v and %v, want the colors in the chunk", pal[0], pal[1])
+	}
+	// pal[i] is the color of index i+1.
+	if pal[2] != defaultPalette[3] || pal[254] != defaultPalette[255] {
+		t.Errorf("missing colors are %v and %v, want %v and %v from the default palette", pal[2], pal[254], defaultPalette[3], defaultPalette[255])
+	}
+	if logged.Len() == 0 {
+		t.Errorf("short palette wasn't logged")
+	}
+	if _, err := opts.parseRGBAChunk(c[:7]); err == nil {
+		t.Errorf("parsing an RGBA chunk with 7 bytes succeeded, want error")
+	}
+}
+
+func TestParseMATT(t *testing.T) {
+	le := func(x interface{}) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, x)
+		return b.Bytes()
+	}
+	// A metal material with weight 0.5, roughness 0.25 and specular 1.
+	var contents []byte
+	for _, x := range []interface{}{int32(5), int32(MaterialMetal), float32(0.5), int32(1<<1 | 1<<2), float32(0.25), float32(1)} {
+		contents = append(contents, le(x)...)
+	}
+	matt := append([]byte("MATT"), le(int32(len(contents)))...)
+	matt = append(matt, le(int32(0))...)
+	matt = append(matt, contents...)
+
+	b := joinChunks(append(splitChunks(t, smallVox(t)), matt))
+	m, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Materials[5]
+	want := NewMaterial(MaterialMetal)
+	want.Color = got.Color
+	want.Weight = 50
+	want.Roughness = 25
+	want.Specular = 100
+	want.Fields = FieldType | FieldWeight | FieldRoughness | FieldSpecular
+	if got != want {
+		t.Errorf("MATT material = %v, want %v", got, want)
+	}
+}
+
+func TestParseFS(t *testing.T) {
+	want, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseFS(os.DirFS("testdata"), "scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFS and ParseFile returned different results")
+	}
+
+	fsys := fstest.MapFS{"small.vox": {Data: smallVox(t)}}
+	if _, err := ParseFS(fsys, "small.vox"); err != nil {
+		t.Errorf("ParseFS(small.vox) failed: %v", err)
+	}
+	if _, err := ParseFS(fsys, "missing.vox"); err == nil {
+		t.Errorf("ParseFS(missing.vox) succeeded, want error")
+	}
+}
+
+func TestParseWithoutScene(t *testing.T) {
+	m := &Main{
+		Models:    []Model{{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}, {X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 2}}}},
+		Materials: make([]Material, 256),
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("Parse() failed on a file without a scene graph: %v", err)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("parsed file is invalid: %v", err)
+	}
+	m.Scene = newScene(m.Models)
+	if d, want := describeScene(got, got.Scene.Node), describeScene(m, m.Scene.Node); d != want {
+		t.Errorf("parsed scene = %s, want %s", d, want)
+	}
+
+	got, err = ParseOptions{NoDefaultScene: true}.Parse(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Scene.Node != nil || got.Scene.Layers != nil {
+		t.Errorf("with NoDefaultScene, parsed scene = %v, want an empty scene", got.Scene)
+	}
+}
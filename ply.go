@@ -0,0 +1,121 @@
+package vox
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+)
+
+// plyVertex is a colored vertex in a PLY file.
+type plyVertex struct {
+	p [3]float32
+	c color.RGBA
+}
+
+// writePLY writes the vertices, and faces made from consecutive groups
+// of four vertices, as a PLY file.
+func writePLY(w io.Writer, verts []plyVertex, quads bool, binaryFormat bool) error {
+	bw := bufio.NewWriter(w)
+	format := "ascii"
+	if binaryFormat {
+		format = "binary_little_endian"
+	}
+	fmt.Fprintf(bw, "ply\nformat %s 1.0\ncomment generated by github.com/paulhankin/vox\n", format)
+	fmt.Fprintf(bw, "element vertex %d\n", len(verts))
+	fmt.Fprintf(bw, "property float x\nproperty float y\nproperty float z\n")
+	fmt.Fprintf(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	nFaces := 0
+	if quads {
+		nFaces = len(verts) / 4
+		fmt.Fprintf(bw, "element face %d\nproperty list uchar int vertex_indices\n", nFaces)
+	}
+	fmt.Fprintf(bw, "end_header\n")
+
+	var buf [4]byte
+	for _, v := range verts {
+		if !binaryFormat {
+			fmt.Fprintf(bw, "%g %g %g %d %d %d %d\n", v.p[0], v.p[1], v.p[2], v.c.R, v.c.G, v.c.B, v.c.A)
+			continue
+		}
+		for _, f := range v.p {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(f))
+			bw.Write(buf[:])
+		}
+		bw.Write([]byte{v.c.R, v.c.G, v.c.B, v.c.A})
+	}
+	for i := 0; i < nFaces; i++ {
+		n := 4 * i
+		if !binaryFormat {
+			fmt.Fprintf(bw, "4 %d %d %d %d\n", n, n+1, n+2, n+3)
+			continue
+		}
+		bw.WriteByte(4)
+		for j := 0; j < 4; j++ {
+			binary.LittleEndian.PutUint32(buf[:], uint32(n+j))
+			bw.Write(buf[:])
+		}
+	}
+	return bw.Flush()
+}
+
+// PLYMode chooses what WritePLY writes for each voxel.
+type PLYMode int
+
+const (
+	PLYPoints PLYMode = iota // A colored point at the center of the voxel.
+	PLYMesh                  // A colored cube, without faces hidden by neighboring voxels.
+)
+
+func (pm PLYMode) String() string {
+	switch pm {
+	case PLYPoints:
+		return "Points"
+	case PLYMesh:
+		return "Mesh"
+	}
+	return fmt.Sprintf("PLYMode(%d)", int(pm))
+}
+
+// WritePLY writes the non-empty voxels of d in the PLY format, as
+// chosen by mode: either a colored point cloud, with one vertex at the
+// center of each voxel, or a mesh of colored cubes, where voxel
+// (x, y, z) is the unit cube from (x, y, z) to (x+1, y+1, z+1), and
+// faces that are covered by a neighboring voxel are omitted.
+// pal gives the color of each material index.
+// If binary is true, the file uses the binary little-endian PLY format,
+// which is much smaller and faster to read than the ascii format.
+func WritePLY(w io.Writer, d *DenseWorld, pal [256]color.RGBA, mode PLYMode, binary bool) error {
+	return ExportOptions{}.WritePLY(w, d, pal, mode, binary)
+}
+
+// WritePLY is like the package-level WritePLY, but uses the options in o.
+func (o ExportOptions) WritePLY(w io.Writer, d *DenseWorld, pal [256]color.RGBA, mode PLYMode, binary bool) error {
+	d = o.visible(d)
+	var verts []plyVertex
+	switch mode {
+	case PLYPoints:
+		for z := d.Min[2]; z <= d.Max[2]; z++ {
+			for y := d.Min[1]; y <= d.Max[1]; y++ {
+				for x := d.Min[0]; x <= d.Max[0]; x++ {
+					idx, _ := d.MaterialIndex([3]int{x, y, z})
+					if idx == 0 {
+						continue
+					}
+					verts = append(verts, plyVertex{o.position([3]float32{float32(x) + 0.5, float32(y) + 0.5, float32(z) + 0.5}), pal[idx]})
+				}
+			}
+		}
+	case PLYMesh:
+		for _, f := range d.ExposedFaces() {
+			for _, c := range faceCorners(f.Pos, f.Dir) {
+				verts = append(verts, plyVertex{o.position([3]float32{float32(c[0]), float32(c[1]), float32(c[2])}), pal[f.MaterialIndex]})
+			}
+		}
+	default:
+		return fmt.Errorf("unknown PLY mode %v", mode)
+	}
+	return writePLY(w, verts, mode == PLYMesh, binary)
+}
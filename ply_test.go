@@ -0,0 +1,86 @@
+package vox
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestWritePLY(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{0, 0, 0}, 1)
+	dw.SetMaterialIndex([3]int{1, 0, 0}, 2)
+	var pal [256]color.RGBA
+	pal[1] = color.RGBA{255, 0, 0, 255}
+	pal[2] = color.RGBA{0, 255, 0, 255}
+
+	var b bytes.Buffer
+	if err := WritePLY(&b, dw, pal, PLYPoints, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "ply\nformat ascii 1.0\n"
+	if !strings.HasPrefix(b.String(), want) {
+		t.Errorf("PLY file starts %q, want %q", b.String()[:20], want)
+	}
+	if !strings.Contains(b.String(), "element vertex 2\n") || !strings.Contains(b.String(), "\n0.5 0.5 0.5 255 0 0 255\n") {
+		t.Errorf("unexpected PLY point cloud:\n%s", b.String())
+	}
+
+	// Two adjacent cubes have 10 exposed faces.
+	b.Reset()
+	if err := WritePLY(&b, dw, pal, PLYMesh, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "element vertex 40\n") || !strings.Contains(b.String(), "element face 10\n") {
+		t.Errorf("unexpected PLY mesh header:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := WritePLY(&b, dw, pal, PLYMesh, true); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(b.String(), "end_header\n", 2)
+	if len(parts) != 2 {
+		t.Fatalf("binary PLY has no end_header")
+	}
+	// Each vertex is 3 floats and 4 color bytes, and each face has
+	// a count byte and 4 int32 indices.
+	if got, want := len(parts[1]), 40*16+10*17; got != want {
+		t.Errorf("binary PLY body has %d bytes, want %d", got, want)
+	}
+
+	// With the green voxel transparent, only the red cube is written.
+	opts := ExportOptions{Transparent: map[uint8]bool{2: true}}
+	b.Reset()
+	if err := opts.WritePLY(&b, dw, pal, PLYMesh, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "element face 6\n") || strings.Contains(b.String(), " 0 255 0 255\n") {
+		t.Errorf("unexpected PLY mesh with a transparent color:\n%s", b.String())
+	}
+	b.Reset()
+	if err := opts.WritePLY(&b, dw, pal, PLYPoints, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "element vertex 1\n") {
+		t.Errorf("unexpected PLY point cloud with a transparent color:\n%s", b.String())
+	}
+
+	// With Y up, the voxel at (1, 0, 0) has its center at
+	// (1.5, 0.5, -0.5).
+	b.Reset()
+	if err := (ExportOptions{YUp: true}).WritePLY(&b, dw, pal, PLYPoints, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\n1.5 0.5 -0.5 0 255 0 255\n") {
+		t.Errorf("unexpected Y-up PLY point cloud:\n%s", b.String())
+	}
+
+	if err := WritePLY(&b, dw, pal, PLYMode(2), false); err == nil {
+		t.Errorf("WritePLY with an unknown mode succeeded, want error")
+	}
+}
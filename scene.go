@@ -0,0 +1,755 @@
+package vox
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WalkOptions controls which parts of a scene are visited when
+// walking or flattening it.
+type WalkOptions struct {
+	// IncludeHidden causes hidden nodes, and nodes on hidden layers,
+	// to be visited. By default they are skipped along with all
+	// of their descendants, matching what MagicaVoxel displays.
+	IncludeHidden bool
+
+	// Frame is the animation frame to show. Each transform node uses
+	// its transform for that frame, as returned by TransformAt, and
+	// when flattening a scene, each shape node shows its model for
+	// that frame, as returned by ShapeNode.ModelAt.
+	Frame int32
+}
+
+// TransformAt returns the transform of tn at the given animation
+// frame: the last of its keyframes that starts at or before the frame,
+// or its first keyframe if they all start later. Transforms aren't
+// interpolated between keyframes. tn must have at least one transform.
+func (tn *TransformNode) TransformAt(frame int32) TransformFrame {
+	r, found := tn.Transforms[0], false
+	for _, tf := range tn.Transforms {
+		if tf.Frame <= frame && (!found || tf.Frame >= r.Frame) {
+			r, found = tf, true
+		}
+	}
+	return r
+}
+
+// ModelAt returns the model of sn shown at the given animation frame:
+// the last of its models whose frame in Frames is at or before the
+// frame, or its first model if they all start later. It's nil if sn
+// has no models.
+func (sn *ShapeNode) ModelAt(frame int32) *Model {
+	if len(sn.Models) == 0 {
+		return nil
+	}
+	r, found := 0, false
+	for i := range sn.Models {
+		if f := sn.frame(i); f <= frame && (!found || f >= sn.frame(r)) {
+			r, found = i, true
+		}
+	}
+	return sn.Models[r]
+}
+
+// AnimationFrames returns the frames at which the transform nodes of
+// the scene have keyframes, or the shape nodes change model, in
+// increasing order and without duplicates. A scene that isn't animated
+// has a single frame, 0.
+func (s Scene) AnimationFrames() []int32 {
+	if s.Node == nil {
+		return nil
+	}
+	frames := map[int32]bool{}
+	forEachNode(s.Node, func(n AnyNode) {
+		switch t := n.(type) {
+		case *TransformNode:
+			for _, tf := range t.Transforms {
+				frames[tf.Frame] = true
+			}
+		case *ShapeNode:
+			for i := range t.Models {
+				frames[t.frame(i)] = true
+			}
+		}
+	})
+	var r []int32
+	for f := range frames {
+		r = append(r, f)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+// A WalkFunc is called for each shape node found while walking a scene.
+// tf is the transform from the shape's model into world space, composed
+// from all the transform nodes above the shape. path holds the nodes from
+// the root of the scene down to and including the shape node; it is reused
+// between calls, so must be copied if it's retained.
+type WalkFunc func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error
+
+// composeTransforms returns the transform that has the effect of
+// applying child, and then parent.
+func composeTransforms(parent, child TransformFrame) TransformFrame {
+	t := parent.R.MulVec([3]int{int(child.T[0]), int(child.T[1]), int(child.T[2])})
+	return TransformFrame{
+		R: parent.R.Mul(child.R),
+		T: [3]int32{int32(t[0]) + parent.T[0], int32(t[1]) + parent.T[1], int32(t[2]) + parent.T[2]},
+	}
+}
+
+// ComposeTransforms returns the single transform that has the same effect
+// as the given transforms, which are listed from the outermost (nearest the
+// root of the scene) to the innermost. That is, the last transform is
+// applied first. The result of composing no transforms is the identity.
+// The transform that Walk passes to its WalkFunc is the composition of the
+// transforms on the path to the shape node.
+func ComposeTransforms(frames []TransformFrame) TransformFrame {
+	r := identityFrame
+	for _, f := range frames {
+		r = composeTransforms(r, f)
+	}
+	return r
+}
+
+// identityFrame is the transform that leaves its children unchanged.
+var identityFrame = TransformFrame{R: Matrix3x3Identity}
+
+// Walk calls fn for each shape node in the scene, in depth-first order.
+// If fn returns an error, the walk stops and that error is returned.
+func (s Scene) Walk(opts WalkOptions, fn WalkFunc) error {
+	if s.Node == nil {
+		return fmt.Errorf("scene has no root node")
+	}
+	return walkNode(s.Node, identityFrame, nil, opts, fn)
+}
+
+func walkNode(n AnyNode, tf TransformFrame, path []AnyNode, opts WalkOptions, fn WalkFunc) error {
+	path = append(path, n)
+	switch t := n.(type) {
+	case *TransformNode:
+		if !opts.IncludeHidden && (t.Hidden || (t.Layer != nil && t.Layer.Hidden)) {
+			return nil
+		}
+		if len(t.Transforms) == 0 {
+			return fmt.Errorf("transform node %q has no transforms", t.Name)
+		}
+		if t.Child == nil {
+			return nil
+		}
+		return walkNode(t.Child, composeTransforms(tf, t.TransformAt(opts.Frame)), path, opts, fn)
+	case *GroupNode:
+		if !opts.IncludeHidden && t.Hidden {
+			return nil
+		}
+		for _, c := range t.Children {
+			if err := walkNode(c, tf, path, opts, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ShapeNode:
+		if !opts.IncludeHidden && t.Hidden {
+			return nil
+		}
+		return fn(t, tf, path)
+	}
+	return fmt.Errorf("found unexpected node of type %T", n)
+}
+
+// SceneToDenseWorld flattens all the models in the scene into a single
+// DenseWorld, placing each according to the transforms above it.
+// Where models overlap, models later in the scene take precedence.
+func SceneToDenseWorld(s Scene, opts WalkOptions) (*DenseWorld, error) {
+	dw, err := s.denseWorld(opts, nil)
+	if err == nil && dw == nil {
+		return nil, fmt.Errorf("no models found in the scene")
+	}
+	return dw, err
+}
+
+// denseWorld flattens the models in the scene for which keep returns true
+// (or all models, if keep is nil) into a single DenseWorld. It returns
+// nil, and no error, if there are no such models.
+func (s Scene) denseWorld(opts WalkOptions, keep func(sn *ShapeNode, path []AnyNode) bool) (*DenseWorld, error) {
+	type placement struct {
+		tf    TransformFrame
+		model *Model
+	}
+	var placements []placement
+	var min, max [3]int
+	err := s.Walk(opts, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		if keep != nil && !keep(sn, path) {
+			return nil
+		}
+		// An animated shape shows one of its models at each frame.
+		if m := sn.ModelAt(opts.Frame); m != nil {
+			mmin, mmax := modelBounds(tf, *m)
+			for i := 0; i < 3; i++ {
+				if len(placements) == 0 || mmin[i] < min[i] {
+					min[i] = mmin[i]
+				}
+				if len(placements) == 0 || mmax[i] > max[i] {
+					max[i] = mmax[i]
+				}
+			}
+			placements = append(placements, placement{tf, m})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(placements) == 0 {
+		return nil, nil
+	}
+	// Check the size of the whole scene before rasterizing any of the
+	// models, since models with large translations can be far apart.
+	dw, err := NewDenseWorld(min, max)
+	if err != nil {
+		return nil, fmt.Errorf("scene is too large to flatten: %v", err)
+	}
+	for _, p := range placements {
+		w, err := DenseWorldFromModel(p.tf, *p.model)
+		if err != nil {
+			return nil, err
+		}
+		dw.Paste(w, [3]int{0, 0, 0}, true)
+	}
+	return dw, nil
+}
+
+// LayerWorld flattens the models on the layer with the given index into
+// a single DenseWorld, placing each according to the transforms above
+// it. A model is on the layer that the nearest transform node above it
+// belongs to. The layer's models are included even if the layer or the
+// nodes in it are hidden, so that each layer can be extracted. If the
+// layer has no models, the world is a single empty voxel at the
+// origin. It's an error if there's no layer with the index.
+func (m *Main) LayerWorld(layerIndex int32) (*DenseWorld, error) {
+	found := false
+	for _, l := range m.Scene.Layers {
+		if l.Index == layerIndex {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no layer with index %d in the scene", layerIndex)
+	}
+	dw, err := m.Scene.denseWorld(WalkOptions{IncludeHidden: true}, func(sn *ShapeNode, path []AnyNode) bool {
+		for i := len(path) - 2; i >= 0; i-- {
+			if tn, ok := path[i].(*TransformNode); ok && tn.Layer != nil {
+				return tn.Layer.Index == layerIndex
+			}
+		}
+		return false
+	})
+	if err == nil && dw == nil {
+		return NewDenseWorld([3]int{}, [3]int{})
+	}
+	return dw, err
+}
+
+// ModelWorldByName returns a DenseWorld containing just the model in the
+// shape node with the given name, placed according to the transforms
+// above it. Since MagicaVoxel stores the names of objects on the
+// transform node above each shape, the shape's parent transform node
+// can also have the name. Hidden nodes are included, and it's an error
+// if no shape node, or more than one, has the name.
+func (m *Main) ModelWorldByName(name string) (*DenseWorld, error) {
+	found := 0
+	dw, err := m.Scene.denseWorld(WalkOptions{IncludeHidden: true}, func(sn *ShapeNode, path []AnyNode) bool {
+		match := sn.Name == name
+		if tn, ok := path[len(path)-2].(*TransformNode); ok && tn.Name == name {
+			match = true
+		}
+		if match {
+			found++
+		}
+		return match
+	})
+	if found == 0 {
+		return nil, fmt.Errorf("no model named %q found in the scene", name)
+	}
+	if found > 1 {
+		return nil, fmt.Errorf("found %d models named %q in the scene", found, name)
+	}
+	if err == nil && dw == nil {
+		return nil, fmt.Errorf("the shape named %q has no models", name)
+	}
+	return dw, err
+}
+
+// newScene returns a scene with one layer, in which each of the
+// models is in its own shape node at the origin. It's the scene graph
+// that MagicaVoxel creates for a file with the given models.
+func newScene(models []Model) Scene {
+	s := Scene{Layers: []Layer{{Index: 0}}}
+	g := &GroupNode{}
+	for i := range models {
+		g.Children = append(g.Children, &TransformNode{
+			Layer:      &s.Layers[0],
+			Transforms: []TransformFrame{identityFrame},
+			Child:      &ShapeNode{Models: []*Model{&models[i]}},
+		})
+	}
+	s.Node = &TransformNode{
+		Transforms: []TransformFrame{identityFrame},
+		Child:      g,
+	}
+	return s
+}
+
+// SplitModels returns a separate Main for each model in m, so that the
+// models can be saved as individual files. Each has a scene containing
+// just the model, and the materials in m of the palette indices that
+// the model's voxels use, which are also its PaletteHint. The palette
+// indices are unchanged, and the other entries in the palette have
+// the default material with no color. If the model was parsed with
+// ParseOptions.LazyModels and its voxels are invalid, every material
+// is kept.
+func (m *Main) SplitModels() []*Main {
+	var r []*Main
+	for _, model := range m.Models {
+		sm := &Main{
+			Models:    []Model{model},
+			Materials: make([]Material, len(m.Materials)),
+		}
+		vs, err := model.decoded()
+		if err != nil {
+			copy(sm.Materials, m.Materials)
+		} else {
+			sm.Models[0].PaletteHint = paletteIndices(vs)
+			for i := range sm.Materials {
+				sm.Materials[i] = NewMaterial(MaterialDiffuse)
+			}
+			if len(m.Materials) > 0 {
+				sm.Materials[0] = m.Materials[0]
+			}
+			for _, c := range sm.Models[0].PaletteHint {
+				if int(c) < len(m.Materials) {
+					sm.Materials[c] = m.Materials[c]
+				}
+			}
+		}
+		sm.Scene = newScene(sm.Models)
+		r = append(r, sm)
+	}
+	return r
+}
+
+// forEachNode calls fn once for each node in the scene graph under n,
+// including n.
+func forEachNode(n AnyNode, fn func(n AnyNode)) {
+	visited := map[AnyNode]bool{}
+	var visit func(n AnyNode)
+	visit = func(n AnyNode) {
+		if n == nil || visited[n] {
+			return
+		}
+		visited[n] = true
+		fn(n)
+		switch t := n.(type) {
+		case *TransformNode:
+			visit(t.Child)
+		case *GroupNode:
+			for _, c := range t.Children {
+				visit(c)
+			}
+		}
+	}
+	visit(n)
+}
+
+// OrderedNodes returns the nodes of the scene graph in depth-first
+// order, starting with the root, with the children of each group in
+// order. This is the order in which Encode writes the nodes, and so
+// for a parsed scene, usually the order of the nodes in the file. A
+// node that appears more than once in the graph is only returned the
+// first time it's found.
+func (s Scene) OrderedNodes() []AnyNode {
+	var r []AnyNode
+	if s.Node != nil {
+		forEachNode(s.Node, func(n AnyNode) {
+			r = append(r, n)
+		})
+	}
+	return r
+}
+
+// Depth returns the number of nodes on the longest path from the root
+// of the scene graph to a node with no children, or 0 if there's no
+// scene graph. In the files that MagicaVoxel writes, the depth is at
+// least 4: the root transform node, its group, and a transform node
+// and shape node for each model. Cycles in the graph aren't followed.
+func (s Scene) Depth() int {
+	if s.Node == nil {
+		return 0
+	}
+	return nodeDepth(s.Node, map[AnyNode]bool{})
+}
+
+// nodeDepth returns the depth of the scene graph under n, where onPath
+// holds the nodes between the root and n.
+func nodeDepth(n AnyNode, onPath map[AnyNode]bool) int {
+	if n == nil || onPath[n] {
+		return 0
+	}
+	onPath[n] = true
+	defer delete(onPath, n)
+	d := 0
+	switch t := n.(type) {
+	case *TransformNode:
+		d = nodeDepth(t.Child, onPath)
+	case *GroupNode:
+		for _, c := range t.Children {
+			if cd := nodeDepth(c, onPath); cd > d {
+				d = cd
+			}
+		}
+	}
+	return d + 1
+}
+
+// NodeCounts returns the number of each type of node in the scene
+// graph. A node that appears more than once in the graph is counted
+// once.
+func (s Scene) NodeCounts() (transforms, groups, shapes int) {
+	if s.Node == nil {
+		return 0, 0, 0
+	}
+	forEachNode(s.Node, func(n AnyNode) {
+		switch n.(type) {
+		case *TransformNode:
+			transforms++
+		case *GroupNode:
+			groups++
+		case *ShapeNode:
+			shapes++
+		}
+	})
+	return transforms, groups, shapes
+}
+
+// relink updates the scene graph after m.Models or m.Scene.Layers
+// have been replaced by copies (for example, when appending to them
+// reallocated them), so that the nodes refer to the new copies. The
+// old slices are passed in.
+func (m *Main) relink(oldModels []Model, oldLayers []Layer) {
+	if m.Scene.Node == nil {
+		return
+	}
+	forEachNode(m.Scene.Node, func(n AnyNode) {
+		switch t := n.(type) {
+		case *TransformNode:
+			for i := range oldLayers {
+				if t.Layer == &oldLayers[i] {
+					t.Layer = &m.Scene.Layers[i]
+				}
+			}
+		case *ShapeNode:
+			for j, model := range t.Models {
+				for i := range oldModels {
+					if model == &oldModels[i] {
+						t.Models[j] = &m.Models[i]
+					}
+				}
+			}
+		}
+	})
+}
+
+// Normalize makes the child of the root transform node a group node,
+// as it is in the files that MagicaVoxel writes, so that code that reads
+// the scene can rely on it. If the root's child isn't a group, a group
+// is inserted to hold it. MagicaVoxel expects the children of groups to
+// be transform nodes, so if the child isn't a transform node either,
+// it's placed under a new transform node with the identity transform,
+// on the first layer of the scene (layer 0 is created if the scene has
+// no layers). The other nodes, and how the models are placed, don't
+// change. If the scene has no root node, Normalize does nothing.
+func (s *Scene) Normalize() {
+	root := s.Node
+	if root == nil {
+		return
+	}
+	if _, ok := root.Child.(*GroupNode); ok {
+		return
+	}
+	g := &GroupNode{}
+	if root.Child != nil {
+		child := root.Child
+		if _, ok := child.(*TransformNode); !ok {
+			if len(s.Layers) == 0 {
+				// There are no layers for nodes to refer to, so
+				// appending can't leave any dangling pointers.
+				s.Layers = append(s.Layers, Layer{Index: 0})
+			}
+			child = &TransformNode{Layer: &s.Layers[0], Transforms: []TransformFrame{identityFrame}, Child: child}
+		}
+		g.Children = append(g.Children, child)
+	}
+	root.Child = g
+}
+
+// AddModel adds a copy of model to m, and places it in the scene
+// with the given transform, on the layer with the given index. The
+// layer is created if it doesn't exist. The new shape node, and the
+// transform node above it, are added to the group under the root of the
+// scene, and the transform is relative to the root transform node. If
+// the root transform node's child isn't a group, a group is inserted to
+// hold it and the new model. If m has no scene, the default scene for
+// its models is created first, as it is when parsing an older file, so
+// the models already in m stay in the scene. It returns the new shape
+// node.
+func (m *Main) AddModel(model Model, transform TransformFrame, layer int32) *ShapeNode {
+	if m.Scene.Node == nil && len(m.Models) > 0 {
+		m.Scene = newScene(m.Models)
+	}
+	oldModels, oldLayers := m.Models, m.Scene.Layers
+	m.Models = append(m.Models, model)
+	var l *Layer
+	for i := range m.Scene.Layers {
+		if m.Scene.Layers[i].Index == layer {
+			l = &m.Scene.Layers[i]
+		}
+	}
+	if l == nil {
+		m.Scene.Layers = append(m.Scene.Layers, Layer{Index: layer})
+		l = &m.Scene.Layers[len(m.Scene.Layers)-1]
+	}
+	m.relink(oldModels, oldLayers)
+
+	if m.Scene.Node == nil {
+		m.Scene.Node = &TransformNode{Transforms: []TransformFrame{identityFrame}}
+	}
+	m.Scene.Normalize()
+	g := m.Scene.Node.Child.(*GroupNode)
+	sn := &ShapeNode{Models: []*Model{&m.Models[len(m.Models)-1]}}
+	g.Children = append(g.Children, &TransformNode{
+		Layer:      l,
+		Transforms: []TransformFrame{transform},
+		Child:      sn,
+	})
+	return sn
+}
+
+// Prune removes the models that have no voxels, along with the
+// shape nodes that refer only to removed models, the transform nodes
+// above those shape nodes, and groups left with no children. The root
+// transform node and its child are kept, so the scene graph is still
+// valid: if every model is removed, the root's child is an empty group.
+func (m *Main) Prune() {
+	var models []Model
+	newModel := map[*Model]*Model{}
+	keep := map[*Model]int{}
+	for i := range m.Models {
+		if !m.Models[i].empty() {
+			keep[&m.Models[i]] = len(models)
+			models = append(models, m.Models[i])
+		}
+	}
+	for old, i := range keep {
+		newModel[old] = &models[i]
+	}
+	m.Models = models
+	if m.Scene.Node == nil {
+		return
+	}
+
+	kept := map[AnyNode]bool{}
+	var prune func(n AnyNode) bool
+	prune = func(n AnyNode) bool {
+		if k, ok := kept[n]; ok {
+			return k
+		}
+		k := false
+		switch t := n.(type) {
+		case *TransformNode:
+			k = t.Child != nil && prune(t.Child)
+		case *GroupNode:
+			var children []AnyNode
+			for _, c := range t.Children {
+				if prune(c) {
+					children = append(children, c)
+				}
+			}
+			t.Children = children
+			k = len(children) > 0
+		case *ShapeNode:
+			var ms []*Model
+			var frames []int32
+			var attrs []map[string]string
+			for i, model := range t.Models {
+				if nm, ok := newModel[model]; ok {
+					ms = append(ms, nm)
+					frames = append(frames, t.frame(i))
+					if i < len(t.ModelAttrs) {
+						attrs = append(attrs, t.ModelAttrs[i])
+					} else {
+						attrs = append(attrs, nil)
+					}
+				}
+			}
+			t.Models = ms
+			if t.Frames != nil {
+				t.Frames = frames
+			}
+			if t.ModelAttrs != nil {
+				t.ModelAttrs = attrs
+			}
+			k = len(ms) > 0
+		}
+		kept[n] = k
+		return k
+	}
+	root := m.Scene.Node
+	if root.Child != nil && !prune(root.Child) {
+		if _, ok := root.Child.(*GroupNode); !ok {
+			root.Child = &GroupNode{}
+		}
+	}
+}
+
+// empty reports whether m has no voxels, without decoding its voxels
+// if it was parsed with ParseOptions.LazyModels.
+func (m *Model) empty() bool {
+	if m.raw != nil && m.V == nil {
+		return len(m.raw) >= 4 && m.raw[0]|m.raw[1]|m.raw[2]|m.raw[3] == 0
+	}
+	return len(m.V) == 0
+}
+
+// A ShapePlacement describes where a shape node is placed in a scene.
+type ShapePlacement struct {
+	Shape *ShapeNode
+	// Name is the name of the shape node or, if it has no name, the
+	// name of the transform node above it, which is where MagicaVoxel
+	// stores the names of objects.
+	Name string
+	// Layer is the layer of the nearest transform node above the shape
+	// that's on a layer, or nil if there's none.
+	Layer *Layer
+	// Transform is the composition of the transforms above the shape.
+	Transform TransformFrame
+	// Hidden is true if the shape, one of the nodes above it, or one of
+	// their layers is hidden.
+	Hidden bool
+}
+
+// Shapes returns the placements of all the shape nodes in the scene,
+// including hidden ones, in depth-first order.
+func (s Scene) Shapes() ([]ShapePlacement, error) {
+	return s.shapes(0)
+}
+
+// LocalTransform returns the composition of the transforms from the root
+// of the scene down to target, which maps target's models into world
+// space, as in ShapePlacement.Transform. Its inverse maps world space
+// back to the models: WorldToModel does this for a single point. If
+// target appears more than once in the scene, the transform of the
+// first in depth-first order is returned. It returns false if target
+// isn't in the scene.
+func (s Scene) LocalTransform(target *ShapeNode) (TransformFrame, bool) {
+	var r TransformFrame
+	found := false
+	s.Walk(WalkOptions{IncludeHidden: true}, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		if sn == target && !found {
+			r, found = tf, true
+		}
+		return nil
+	})
+	return r, found
+}
+
+// shapes returns the placements of all the shape nodes in the scene
+// at the given animation frame.
+func (s Scene) shapes(frame int32) ([]ShapePlacement, error) {
+	var r []ShapePlacement
+	err := s.Walk(WalkOptions{IncludeHidden: true, Frame: frame}, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		p := ShapePlacement{Shape: sn, Name: sn.Name, Transform: tf, Hidden: sn.Hidden}
+		for _, n := range path {
+			switch t := n.(type) {
+			case *TransformNode:
+				p.Hidden = p.Hidden || t.Hidden
+				if t.Layer != nil {
+					p.Layer = t.Layer
+					p.Hidden = p.Hidden || t.Layer.Hidden
+				}
+			case *GroupNode:
+				p.Hidden = p.Hidden || t.Hidden
+			}
+		}
+		if tn, ok := path[len(path)-2].(*TransformNode); ok && p.Name == "" {
+			p.Name = tn.Name
+		}
+		r = append(r, p)
+		return nil
+	})
+	return r, err
+}
+
+// An Instance is a model placed in the scene. A model that appears
+// in several places in the scene has several instances, which share
+// the same Model.
+type Instance struct {
+	Model *Model
+	// Transform maps the model into world space, in the same way as
+	// in DenseWorldFromModel.
+	Transform TransformFrame
+	Layer     *Layer // The layer of the shape, as in ShapePlacement.
+	Hidden    bool   // Whether the shape is hidden, as in ShapePlacement.
+}
+
+// Instances returns every placement of a model in the scene, including
+// hidden ones. It's an alternative to SceneToDenseWorld for renderers
+// that draw each model separately, which avoids copying the voxels of
+// models that are used more than once. If there's no scene graph, each
+// model has a single instance at the origin. Every model of an
+// animated shape node is returned, placed as at frame 0. It returns an
+// error if the scene graph is invalid, as Scene.Walk does.
+func (m *Main) Instances() ([]Instance, error) {
+	return m.instances(0, false)
+}
+
+// PoseAt returns the placements of the models in the scene at the
+// given animation frame, like Instances, but with each transform node
+// at its transform for the frame, and only the model that each shape
+// node shows at the frame, as returned by ShapeNode.ModelAt. The frames
+// at which the scene changes are returned by Scene.AnimationFrames.
+// Like Instances, it returns an error if the scene graph is invalid
+// (for example, if it has a cycle), since the graph of a Main that's
+// been changed after parsing can't be assumed to be valid.
+func (m *Main) PoseAt(frame int32) ([]Instance, error) {
+	return m.instances(frame, true)
+}
+
+// instances returns the placements of the models at the given frame.
+// If posed is true, only the model each shape shows at the frame is
+// included.
+func (m *Main) instances(frame int32, posed bool) ([]Instance, error) {
+	if m.Scene.Node == nil {
+		var r []Instance
+		for i := range m.Models {
+			r = append(r, Instance{Model: &m.Models[i], Transform: identityFrame})
+		}
+		return r, nil
+	}
+	shapes, err := m.Scene.shapes(frame)
+	if err != nil {
+		return nil, err
+	}
+	var r []Instance
+	for _, s := range shapes {
+		models := s.Shape.Models
+		if posed {
+			models = nil
+			if model := s.Shape.ModelAt(frame); model != nil {
+				models = []*Model{model}
+			}
+		}
+		for _, model := range models {
+			r = append(r, Instance{Model: model, Transform: s.Transform, Layer: s.Layer, Hidden: s.Hidden})
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,750 @@
+package vox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func shapeNames(t *testing.T, s Scene, opts WalkOptions) []string {
+	var names []string
+	err := s.Walk(opts, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		parent, ok := path[len(path)-2].(*TransformNode)
+		if !ok {
+			t.Fatalf("shape node's parent is %T, want *TransformNode", path[len(path)-2])
+		}
+		names = append(names, parent.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestWalkHidden(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := shapeNames(t, main.Scene, WalkOptions{}); len(got) != 4 {
+		t.Fatalf("found shapes %q, want 4 shapes", got)
+	}
+
+	// "other thing" and "something" are on layer 2, and
+	// "boxes" is a transform node we hide directly.
+	for i := range main.Scene.Layers {
+		if main.Scene.Layers[i].Index == 2 {
+			main.Scene.Layers[i].Hidden = true
+		}
+	}
+	for _, c := range main.Scene.Node.Child.(*GroupNode).Children {
+		if tn := c.(*TransformNode); tn.Name == "boxes" {
+			tn.Hidden = true
+		}
+	}
+
+	got := shapeNames(t, main.Scene, WalkOptions{})
+	if len(got) != 1 || got[0] != "redrum" {
+		t.Errorf("visible shapes = %q, want [redrum]", got)
+	}
+	if got := shapeNames(t, main.Scene, WalkOptions{IncludeHidden: true}); len(got) != 4 {
+		t.Errorf("found shapes %q including hidden, want 4 shapes", got)
+	}
+}
+
+func TestSceneToDenseWorld(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := SceneToDenseWorld(main.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := countVoxels(dw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for _, m := range main.Models {
+		want += len(m.V)
+	}
+	if got == 0 || got > want {
+		t.Errorf("flattened scene has %d voxels, want between 1 and %d", got, want)
+	}
+}
+
+func TestModelWorldByName(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want *DenseWorld
+	err = main.Scene.Walk(WalkOptions{}, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		if path[len(path)-2].(*TransformNode).Name != "redrum" {
+			return nil
+		}
+		var err error
+		want, err = DenseWorldFromModel(tf, *sn.Models[0])
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := main.ModelWorldByName("redrum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ModelWorldByName(redrum) has cuboid %v-%v, want the model's world with cuboid %v-%v", got.Min, got.Max, want.Min, want.Max)
+	}
+	if _, err := main.ModelWorldByName("no such model"); err == nil {
+		t.Errorf("ModelWorldByName(missing name) succeeded, want error")
+	}
+}
+
+func TestLayerWorld(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := main.Scene.Shapes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hiding a layer doesn't stop it being extracted.
+	main.Scene.Layers[1].Hidden = true
+	for _, s := range shapes {
+		if s.Layer.Index == 2 {
+			// Layer 2 has two overlapping models.
+			continue
+		}
+		got, err := main.LayerWorld(s.Layer.Index)
+		if err != nil {
+			t.Fatalf("LayerWorld(%d) failed: %v", s.Layer.Index, err)
+		}
+		want, err := DenseWorldFromModel(s.Transform, *s.Shape.Models[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LayerWorld(%d) differs from the world for model %q", s.Layer.Index, s.Name)
+		}
+	}
+	empty, err := main.LayerWorld(3)
+	if err != nil {
+		t.Fatalf("LayerWorld(3) of an empty layer failed: %v", err)
+	}
+	if want := (&DenseWorld{Voxels: []uint8{0}}); !reflect.DeepEqual(empty, want) {
+		t.Errorf("LayerWorld(3) of an empty layer = %v, want %v", empty, want)
+	}
+	if _, err := main.LayerWorld(100); err == nil {
+		t.Errorf("LayerWorld(100) of a missing layer succeeded, want error")
+	}
+}
+
+func TestAddModel(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(main.Models)
+	// Make sure appending the model reallocates the models.
+	main.Models = main.Models[:n:n]
+	model := Model{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 3}}}
+	tf := TransformFrame{R: Matrix3x3Identity, T: [3]int32{100, 0, 0}}
+	sn := main.AddModel(model, tf, 42)
+	if err := main.Validate(); err != nil {
+		t.Fatalf("after AddModel, scene is invalid: %v", err)
+	}
+	if sn.Models[0] != &main.Models[n] {
+		t.Errorf("new shape node doesn't refer to the new model")
+	}
+	instances, err := main.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := instances[len(instances)-1]
+	if last.Model != &main.Models[n] || last.Transform != tf || last.Layer.Index != 42 {
+		t.Errorf("new instance = %+v, want model %d at %v on layer 42", last, n, tf)
+	}
+
+	// Building a scene from nothing.
+	m := &Main{Materials: make([]Material, 256)}
+	m.AddModel(model, identityFrame, 0)
+	m.AddModel(model, tf, 0)
+	if err := m.Validate(); err != nil {
+		t.Fatalf("scene built with AddModel is invalid: %v", err)
+	}
+	dw, err := SceneToDenseWorld(m.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dw.Min != [3]int{0, 0, 0} || dw.Max != [3]int{100, 0, 0} {
+		t.Errorf("scene built with AddModel covers %v-%v, want [0 0 0]-[100 0 0]", dw.Min, dw.Max)
+	}
+
+	// Adding a model to a file without a scene keeps the models that
+	// are already there in the scene.
+	m = &Main{Models: []Model{model, model}, Materials: make([]Material, 256)}
+	m.AddModel(model, tf, 0)
+	if err := m.Validate(); err != nil {
+		t.Fatalf("after AddModel to a file without a scene, scene is invalid: %v", err)
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err = got.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Models) != 3 || len(instances) != 3 {
+		t.Fatalf("after encoding, got %d models and %d instances, want 3 of each", len(got.Models), len(instances))
+	}
+	for i, inst := range instances {
+		if inst.Model != &got.Models[i] {
+			t.Errorf("instance %d isn't of model %d", i, i)
+		}
+	}
+	if instances[2].Transform != tf {
+		t.Errorf("new model has transform %v, want %v", instances[2].Transform, tf)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	m := smallMain()
+	tn := m.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode)
+	tn.Transforms = []TransformFrame{
+		{R: Matrix3x3Identity, T: [3]int32{0, 0, 0}},
+		{R: Matrix3x3Identity, T: [3]int32{10, 0, 0}, Frame: 5},
+		{R: Matrix3x3Identity, T: [3]int32{20, 0, 0}, Frame: 8},
+	}
+	if got, want := m.Scene.AnimationFrames(), []int32{0, 5, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AnimationFrames() = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		frame int32
+		x     int32
+	}{{0, 0}, {4, 0}, {5, 10}, {7, 10}, {8, 20}, {100, 20}, {-1, 0}} {
+		pose, err := m.PoseAt(tc.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pose[0].Transform.T[0]; got != tc.x {
+			t.Errorf("PoseAt(%d) places the model at x = %d, want %d", tc.frame, got, tc.x)
+		}
+	}
+
+	// An animated shape shows one model at each frame.
+	m.Models = append(m.Models[:1:1], Model{X: 2, Y: 1, Z: 1, V: []Voxel{{1, 0, 0, 2}}})
+	sn := tn.Child.(*ShapeNode)
+	sn.Models = []*Model{&m.Models[0], &m.Models[1]}
+	sn.Frames = []int32{0, 6}
+	if got, want := m.Scene.AnimationFrames(), []int32{0, 5, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AnimationFrames() with an animated shape = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		frame int32
+		model int
+	}{{-1, 0}, {0, 0}, {5, 0}, {6, 1}, {100, 1}} {
+		pose, err := m.PoseAt(tc.frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pose) != 1 || pose[0].Model != &m.Models[tc.model] {
+			t.Errorf("PoseAt(%d) = %v, want just model %d", tc.frame, pose, tc.model)
+		}
+		// Flattening the scene also shows only that model.
+		dw, err := SceneToDenseWorld(m.Scene, WalkOptions{Frame: tc.frame})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := DenseWorldFromModel(pose[0].Transform, m.Models[tc.model])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dw, want) {
+			t.Errorf("SceneToDenseWorld at frame %d = %v, want just model %d", tc.frame, dw, tc.model)
+		}
+	}
+	sn.Models = sn.Models[:1]
+	sn.Frames = nil
+	m.Models = m.Models[:1]
+
+	// The keyframes survive encoding and parsing.
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gtn := got.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode)
+	if !reflect.DeepEqual(gtn.Transforms, tn.Transforms) {
+		t.Errorf("after round trip, keyframes = %v, want %v", gtn.Transforms, tn.Transforms)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	full := Model{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}
+	empty := Model{X: 2, Y: 2, Z: 2}
+	m := &Main{Materials: make([]Material, 256)}
+	m.AddModel(empty, identityFrame, 0)
+	sn := m.AddModel(full, identityFrame, 0)
+	m.AddModel(empty, identityFrame, 1)
+	// An animated shape whose first frame is an empty model.
+	sn.Models = []*Model{&m.Models[0], &m.Models[1]}
+	sn.Frames = []int32{3, 7}
+	// A group that holds only an empty model.
+	g := m.Scene.Node.Child.(*GroupNode)
+	g.Children = append(g.Children, &TransformNode{
+		Layer:      &m.Scene.Layers[0],
+		Transforms: []TransformFrame{identityFrame},
+		Child: &GroupNode{Children: []AnyNode{&TransformNode{
+			Layer:      &m.Scene.Layers[0],
+			Transforms: []TransformFrame{identityFrame},
+			Child:      &ShapeNode{Models: []*Model{&m.Models[2]}},
+		}}},
+	})
+
+	m.Prune()
+	if len(m.Models) != 1 || !m.Models[0].Equal(&full) {
+		t.Fatalf("after Prune, models = %v, want just %v", m.Models, full)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("after Prune, scene is invalid: %v", err)
+	}
+	if len(sn.Models) != 1 || !reflect.DeepEqual(sn.Frames, []int32{7}) {
+		t.Errorf("after Prune, shape has %d models and frames %v, want 1 model and frames [7]", len(sn.Models), sn.Frames)
+	}
+	if err := Encode(ioutil.Discard, m); err != nil {
+		t.Errorf("after Prune, Encode failed: %v", err)
+	}
+	s, err := m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root, the group, and the transform and shape of the model.
+	if s.Nodes != 4 {
+		t.Errorf("after Prune, scene has %d nodes, want 4", s.Nodes)
+	}
+
+	m.Models[0].V = nil
+	m.Prune()
+	if len(m.Models) != 0 {
+		t.Errorf("after Prune, there are %d models, want 0", len(m.Models))
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("after pruning every model, scene is invalid: %v", err)
+	}
+}
+
+func TestSplitModels(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing a voxel leaves the hint out of date, but the split
+	// file still has the voxel's material.
+	main.Models[0].V[0].ColorIndex = 1
+	if main.Models[0].PaletteHint[0] == 1 {
+		t.Fatalf("model 0 already uses color 1")
+	}
+	split := main.SplitModels()
+	if len(split) != len(main.Models) {
+		t.Fatalf("SplitModels() returned %d files, want %d", len(split), len(main.Models))
+	}
+	for i, m := range split {
+		if err := m.Validate(); err != nil {
+			t.Errorf("file %d is invalid: %v", i, err)
+		}
+		var b bytes.Buffer
+		if err := Encode(&b, m); err != nil {
+			t.Errorf("failed to encode file %d: %v", i, err)
+			continue
+		}
+		got, err := Parse(&b)
+		if err != nil {
+			t.Errorf("failed to parse file %d: %v", i, err)
+			continue
+		}
+		if len(got.Models) != 1 || !got.Models[0].Equal(&main.Models[i]) {
+			t.Errorf("file %d doesn't contain just model %d", i, i)
+		}
+		// Only the model's own colors are kept.
+		used := map[int]bool{}
+		for _, v := range main.Models[i].V {
+			used[int(v.ColorIndex)] = true
+		}
+		if len(used) == 0 {
+			t.Errorf("model %d has no voxels", i)
+		}
+		for j := 1; j < 256; j++ {
+			want := NewMaterial(MaterialDiffuse)
+			if used[j] {
+				want = main.Materials[j]
+			}
+			if m.Materials[j] != want {
+				t.Errorf("file %d has material %d %v, want %v", i, j, m.Materials[j], want)
+			}
+		}
+		if got := m.Models[0].PaletteHint; len(got) != len(used) || !used[int(got[0])] {
+			t.Errorf("file %d has palette hint %v, want the colors of its voxels", i, got)
+		}
+	}
+
+	// Lazily parsed models are split in the same way.
+	lazy, err := ParseOptions{LazyModels: true}.ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eager, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazySplit, eagerSplit := lazy.SplitModels(), eager.SplitModels()
+	for i := range lazySplit {
+		if !reflect.DeepEqual(lazySplit[i].Materials, eagerSplit[i].Materials) {
+			t.Errorf("lazily parsed file %d has different materials", i)
+		}
+	}
+}
+
+func TestComposeTransforms(t *testing.T) {
+	var frames []TransformFrame
+	for r := Matrix3x3(0); r < 128 && len(frames) < 5; r += 11 {
+		if r.Valid() {
+			frames = append(frames, TransformFrame{R: r, T: [3]int32{int32(r), -int32(len(frames)), 3}})
+		}
+	}
+	if got := ComposeTransforms(nil); got != identityFrame {
+		t.Errorf("ComposeTransforms(nil) = %v, want the identity", got)
+	}
+	all := ComposeTransforms(frames)
+	wantR := Matrix3x3Identity
+	for _, f := range frames {
+		wantR = wantR.Mul(f.R)
+	}
+	if all.R != wantR {
+		t.Errorf("composed rotation = %v, want %v", all.R, wantR)
+	}
+	// Composition is associative.
+	for i := 0; i <= len(frames); i++ {
+		got := ComposeTransforms([]TransformFrame{ComposeTransforms(frames[:i]), ComposeTransforms(frames[i:])})
+		if got != all {
+			t.Errorf("composing frames split at %d = %v, want %v", i, got, all)
+		}
+	}
+	// Applying the composed transform is the same as applying each in turn.
+	p := [3]int{1, 2, 3}
+	want := p
+	for i := len(frames) - 1; i >= 0; i-- {
+		want = addVec(frames[i].R.MulVec(want), [3]int{int(frames[i].T[0]), int(frames[i].T[1]), int(frames[i].T[2])})
+	}
+	got := addVec(all.R.MulVec(p), [3]int{int(all.T[0]), int(all.T[1]), int(all.T[2])})
+	if got != want {
+		t.Errorf("composed transform maps %v to %v, want %v", p, got, want)
+	}
+}
+
+func TestSceneToDenseWorldTooLarge(t *testing.T) {
+	m := smallMain()
+	m.Models = append(m.Models, m.Models[0])
+	m.Scene = newScene(m.Models)
+	g := m.Scene.Node.Child.(*GroupNode)
+	g.Children[0].(*TransformNode).Transforms[0].T = [3]int32{-1 << 31, 0, 0}
+	g.Children[1].(*TransformNode).Transforms[0].T = [3]int32{1<<31 - 1, 0, 0}
+	_, err := SceneToDenseWorld(m.Scene, WalkOptions{})
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("SceneToDenseWorld(models far apart) = %v, want error", err)
+	}
+
+	// Large translations are fine if the models are close together.
+	g.Children[0].(*TransformNode).Transforms[0].T = [3]int32{1<<31 - 5, 0, 0}
+	dw, err := SceneToDenseWorld(m.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dw.Min[0] != 1<<31-5 {
+		t.Errorf("flattened world starts at %v, want x = %d", dw.Min, 1<<31-5)
+	}
+}
+
+func TestShapes(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range main.Scene.Layers {
+		if main.Scene.Layers[i].Index == 2 {
+			main.Scene.Layers[i].Hidden = true
+		}
+	}
+	shapes, err := main.Scene.Shapes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var visible []string
+	for _, s := range shapes {
+		if s.Layer == nil {
+			t.Errorf("shape %q has no layer", s.Name)
+		}
+		if !s.Hidden {
+			visible = append(visible, s.Name)
+		}
+	}
+	if len(shapes) != 4 {
+		t.Errorf("found %d shapes, want 4", len(shapes))
+	}
+	if want := shapeNames(t, main.Scene, WalkOptions{}); !reflect.DeepEqual(visible, want) {
+		t.Errorf("visible shapes = %q, want %q", visible, want)
+	}
+}
+
+func TestOrderedNodes(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first []byte
+	for i := 0; i < 10; i++ {
+		main, err := Parse(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := main.Scene.OrderedNodes()
+		if len(nodes) != 10 || nodes[0] != AnyNode(main.Scene.Node) {
+			t.Fatalf("OrderedNodes() returned %d nodes starting with %v, want 10 starting with the root", len(nodes), nodes[0])
+		}
+		if _, ok := nodes[1].(*GroupNode); !ok {
+			t.Errorf("second node is %T, want the root's group", nodes[1])
+		}
+		// Parsing and encoding the file always gives the same bytes.
+		var b bytes.Buffer
+		if err := Encode(&b, main); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b.Bytes()
+		} else if !bytes.Equal(b.Bytes(), first) {
+			t.Fatalf("encoding scene.vox gave different bytes on attempt %d", i)
+		}
+	}
+	if nodes := (Scene{}).OrderedNodes(); len(nodes) != 0 {
+		t.Errorf("OrderedNodes() of an empty scene = %v, want none", nodes)
+	}
+}
+
+func TestBuildSceneOrder(t *testing.T) {
+	// Scenes with several errors report the one for the smallest
+	// node ID, whatever the order of the maps.
+	for _, tc := range []struct {
+		desc     string
+		children map[int32][]int32
+		layers   map[int32]int32
+		want     string
+	}{
+		{
+			desc:   "missing layers",
+			layers: map[int32]int32{0: -1, 5: 15, 3: 13, 8: 18, 4: 14, 7: 17, 6: 16},
+			want:   "layer id 13 not found",
+		},
+		{
+			desc:     "missing children",
+			children: map[int32][]int32{0: {1}, 6: {26}, 2: {22}, 9: {29}, 4: {24}, 7: {27}},
+			layers:   map[int32]int32{0: -1},
+			want:     "node 2 has child 22, but no such node exists",
+		},
+	} {
+		for i := 0; i < 20; i++ {
+			nodes := map[int32]AnyNode{}
+			for id := int32(0); id < 10; id++ {
+				nodes[id] = &TransformNode{}
+			}
+			nodes[1] = &GroupNode{}
+			for id := int32(2); id < 10; id++ {
+				if tc.children != nil {
+					nodes[id] = &GroupNode{}
+				}
+			}
+			_, err := buildScene(nodes, tc.children, tc.layers, map[int32]*Layer{0: {Index: 0}})
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("%s: buildScene() = %v, want error %q", tc.desc, err, tc.want)
+			}
+		}
+	}
+}
+
+func TestLocalTransform(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := main.Scene.Shapes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range shapes {
+		tf, ok := main.Scene.LocalTransform(s.Shape)
+		if !ok || tf != s.Transform {
+			t.Errorf("LocalTransform(%q) = %v, %v, want %v, true", s.Name, tf, ok, s.Transform)
+		}
+		// A voxel in world space maps back to the model.
+		m := s.Shape.Models[0]
+		size := [3]int{m.X, m.Y, m.Z}
+		v := [3]int{m.X - 1, 0, m.Z / 2}
+		if got := WorldToModel(tf, size, ModelToWorld(tf, size, v)); got != v {
+			t.Errorf("shape %q: voxel %v maps back to %v", s.Name, v, got)
+		}
+	}
+	if _, ok := main.Scene.LocalTransform(&ShapeNode{}); ok {
+		t.Errorf("LocalTransform found a shape that isn't in the scene")
+	}
+}
+
+func TestInstances(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := main.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Building a world from the visible instances gives the same
+	// result as flattening the scene.
+	var worlds []*DenseWorld
+	var min, max [3]int
+	for _, in := range instances {
+		if in.Hidden {
+			continue
+		}
+		dw, err := DenseWorldFromModel(in.Transform, *in.Model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if len(worlds) == 0 || dw.Min[i] < min[i] {
+				min[i] = dw.Min[i]
+			}
+			if len(worlds) == 0 || dw.Max[i] > max[i] {
+				max[i] = dw.Max[i]
+			}
+		}
+		worlds = append(worlds, dw)
+	}
+	got, err := NewDenseWorld(min, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range worlds {
+		got.Paste(w, [3]int{0, 0, 0}, true)
+	}
+	want, err := SceneToDenseWorld(main.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("world built from instances differs from the flattened scene")
+	}
+
+	m := &Main{Models: make([]Model, 2)}
+	instances, err = m.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[1].Model != &m.Models[1] || instances[1].Transform != identityFrame {
+		t.Errorf("Instances() without a scene = %v, want each model at the origin", instances)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	m := &Main{
+		Models:    []Model{{X: 1, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}}}},
+		Materials: make([]Material, 256),
+	}
+	m.Scene.Node = &TransformNode{
+		Transforms: []TransformFrame{{R: Matrix3x3Identity, T: [3]int32{1, 2, 3}}},
+		Child:      &ShapeNode{Node: Node{Hidden: true}, Models: []*Model{&m.Models[0]}},
+	}
+	before, err := m.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Scene.Normalize()
+	if err := m.Validate(); err != nil {
+		t.Fatalf("normalized scene is invalid: %v", err)
+	}
+	g, ok := m.Scene.Node.Child.(*GroupNode)
+	if !ok || len(g.Children) != 1 {
+		t.Fatalf("after Normalize, root's child is %v, want a group with one child", m.Scene.Node.Child)
+	}
+	tn, ok := g.Children[0].(*TransformNode)
+	if !ok || tn.Layer != &m.Scene.Layers[0] {
+		t.Fatalf("group's child is %v, want a transform node on layer 0", g.Children[0])
+	}
+	if sn, ok := tn.Child.(*ShapeNode); !ok || !sn.Hidden {
+		t.Errorf("transform node's child is %v, want the hidden shape node", tn.Child)
+	}
+	after, err := m.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shape is now on layer 0, but is placed in the same way.
+	for i := range after {
+		after[i].Layer = nil
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("after Normalize, instances = %v, want %v", after, before)
+	}
+
+	// Normalizing again changes nothing.
+	m.Scene.Normalize()
+	if m.Scene.Node.Child != g || len(m.Scene.Layers) != 1 {
+		t.Errorf("normalizing a normalized scene changed it")
+	}
+}
+
+func TestSceneDepthAndNodeCounts(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := main.Scene.Depth(); got != 4 {
+		t.Errorf("Depth() = %d, want 4", got)
+	}
+	tns, gns, sns := main.Scene.NodeCounts()
+	if tns != 5 || gns != 1 || sns != 4 {
+		t.Errorf("NodeCounts() = %d, %d, %d; want 5, 1, 4", tns, gns, sns)
+	}
+
+	// A group nested in the group, with one shape shared with the
+	// outer group.
+	g := main.Scene.Node.Child.(*GroupNode)
+	shared := g.Children[0]
+	g.Children = append(g.Children, &TransformNode{
+		Layer:      &main.Scene.Layers[0],
+		Transforms: []TransformFrame{identityFrame},
+		Child:      &GroupNode{Children: []AnyNode{shared}},
+	})
+	if got := main.Scene.Depth(); got != 6 {
+		t.Errorf("after nesting, Depth() = %d, want 6", got)
+	}
+	tns, gns, sns = main.Scene.NodeCounts()
+	if tns != 6 || gns != 2 || sns != 4 {
+		t.Errorf("after nesting, NodeCounts() = %d, %d, %d; want 6, 2, 4", tns, gns, sns)
+	}
+
+	if d := (Scene{}).Depth(); d != 0 {
+		t.Errorf("empty scene has depth %d, want 0", d)
+	}
+}
@@ -0,0 +1,132 @@
+package vox
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+)
+
+// NBT tag types used in .schematic files.
+const (
+	nbtEnd       = 0
+	nbtShort     = 2
+	nbtByteArray = 7
+	nbtString    = 8
+	nbtList      = 9
+	nbtCompound  = 10
+)
+
+// nbtWriter writes Minecraft's NBT format, which is big-endian. Like
+// voxWriter, writes after an error do nothing, and the first error can
+// be checked using Error.
+type nbtWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Error returns the first error (if any) encountered by the writer.
+func (nw *nbtWriter) Error() error {
+	return nw.err
+}
+
+func (nw *nbtWriter) writeBytes(b []byte) {
+	if nw.err != nil {
+		return
+	}
+	_, nw.err = nw.w.Write(b)
+}
+
+func (nw *nbtWriter) writeInt16(x int16) {
+	nw.writeBytes([]byte{byte(uint16(x) >> 8), byte(x)})
+}
+
+func (nw *nbtWriter) writeInt32(x int32) {
+	u := uint32(x)
+	nw.writeBytes([]byte{byte(u >> 24), byte(u >> 16), byte(u >> 8), byte(u)})
+}
+
+// writeString writes s as an unprefixed NBT string.
+func (nw *nbtWriter) writeString(s string) {
+	nw.writeInt16(int16(len(s)))
+	nw.writeBytes([]byte(s))
+}
+
+// tag writes the header of a named tag.
+func (nw *nbtWriter) tag(typ byte, name string) {
+	nw.writeBytes([]byte{typ})
+	nw.writeString(name)
+}
+
+// WriteSchematic writes d as a gzipped MCEdit .schematic file, for
+// importing into Minecraft. blockMap gives the Minecraft block ID that
+// each palette index becomes, which must be between 0 and 255. Empty
+// voxels, and voxels whose index isn't in blockMap, become air (block
+// ID 0). Every block has data value 0.
+//
+// Minecraft's Y axis is up, so the coordinates are converted as
+// ExportOptions.YUp does: the voxel at (x, y, z) is the block at
+// (x, z, -y), moved so that the blocks start at (0, 0, 0). The world
+// must be less than 32768 voxels along each axis.
+func WriteSchematic(w io.Writer, d *DenseWorld, blockMap map[uint8]int) error {
+	var blocks [256]byte
+	for idx, id := range blockMap {
+		if id < 0 || id > 255 {
+			return fmt.Errorf("palette index %d maps to block ID %d, which must be between 0 and 255", idx, id)
+		}
+		if idx != 0 {
+			blocks[idx] = byte(id)
+		}
+	}
+	var size [3]int
+	for i := range size {
+		size[i] = d.Max[i] - d.Min[i] + 1
+		if size[i] > math.MaxInt16 {
+			return fmt.Errorf("the world is %d voxels long on axis %d, but a schematic can be at most %d", size[i], i, math.MaxInt16)
+		}
+	}
+	// The schematic's width, height and length are along the x, y
+	// and z axes of Minecraft.
+	width, height, length := size[0], size[2], size[1]
+	data := make([]byte, len(d.Voxels))
+	i := 0
+	for z := 0; z < size[2]; z++ {
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				// Blocks are stored with y (up) most significant,
+				// then z, then x.
+				bz := size[1] - 1 - y
+				data[(z*length+bz)*width+x] = blocks[d.Voxels[i]]
+				i++
+			}
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	nw := &nbtWriter{w: gz}
+	nw.tag(nbtCompound, "Schematic")
+	nw.tag(nbtShort, "Width")
+	nw.writeInt16(int16(width))
+	nw.tag(nbtShort, "Height")
+	nw.writeInt16(int16(height))
+	nw.tag(nbtShort, "Length")
+	nw.writeInt16(int16(length))
+	nw.tag(nbtString, "Materials")
+	nw.writeString("Alpha")
+	nw.tag(nbtByteArray, "Blocks")
+	nw.writeInt32(int32(len(data)))
+	nw.writeBytes(data)
+	nw.tag(nbtByteArray, "Data")
+	nw.writeInt32(int32(len(data)))
+	nw.writeBytes(make([]byte, len(data)))
+	for _, name := range []string{"Entities", "TileEntities"} {
+		nw.tag(nbtList, name)
+		nw.writeBytes([]byte{nbtCompound})
+		nw.writeInt32(0)
+	}
+	nw.writeBytes([]byte{nbtEnd})
+	if err := nw.Error(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,100 @@
+package vox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// readSchematic reads the tags of a schematic written by
+// WriteSchematic, returning the shorts and byte arrays by name.
+func readSchematic(t *testing.T, r io.Reader) (map[string]int16, map[string][]byte) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func() string {
+		n := int(binary.BigEndian.Uint16(b))
+		s := string(b[2 : 2+n])
+		b = b[2+n:]
+		return s
+	}
+	if b[0] != nbtCompound {
+		t.Fatalf("schematic starts with tag %d, want a compound", b[0])
+	}
+	b = b[1:]
+	if name := str(); name != "Schematic" {
+		t.Fatalf("schematic has name %q, want Schematic", name)
+	}
+	shorts, arrays := map[string]int16{}, map[string][]byte{}
+	for {
+		typ := b[0]
+		b = b[1:]
+		if typ == nbtEnd {
+			break
+		}
+		name := str()
+		switch typ {
+		case nbtShort:
+			shorts[name] = int16(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		case nbtString:
+			str()
+		case nbtByteArray:
+			n := int(binary.BigEndian.Uint32(b))
+			arrays[name] = b[4 : 4+n]
+			b = b[4+n:]
+		case nbtList:
+			if n := binary.BigEndian.Uint32(b[1:]); n != 0 {
+				t.Fatalf("list %q has %d entries, want none", name, n)
+			}
+			b = b[5:]
+		default:
+			t.Fatalf("unexpected tag %d", typ)
+		}
+	}
+	if len(b) != 0 {
+		t.Errorf("schematic has %d bytes after the end", len(b))
+	}
+	return shorts, arrays
+}
+
+func TestWriteSchematic(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{5, 5, 5}, [3]int{6, 7, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{5, 5, 5}, 1)
+	dw.SetMaterialIndex([3]int{6, 7, 6}, 2)
+	dw.SetMaterialIndex([3]int{6, 5, 5}, 3)
+	var b bytes.Buffer
+	if err := WriteSchematic(&b, dw, map[uint8]int{1: 35, 2: 1}); err != nil {
+		t.Fatal(err)
+	}
+	shorts, arrays := readSchematic(t, &b)
+	if shorts["Width"] != 2 || shorts["Height"] != 2 || shorts["Length"] != 3 {
+		t.Errorf("schematic has size %v, want width 2, height 2 and length 3", shorts)
+	}
+	blocks := arrays["Blocks"]
+	if len(blocks) != 12 || len(arrays["Data"]) != 12 {
+		t.Fatalf("schematic has %d blocks and %d data values, want 12", len(blocks), len(arrays["Data"]))
+	}
+	// Voxel (x, y, z) is block (x, z, 2-y), at index (z*3 + 2-y)*2 + x.
+	want := make([]byte, 12)
+	want[(0*3+2)*2+0] = 35
+	want[(1*3+0)*2+1] = 1
+	if !bytes.Equal(blocks, want) {
+		t.Errorf("schematic has blocks %v, want %v", blocks, want)
+	}
+
+	if err := WriteSchematic(ioutil.Discard, dw, map[uint8]int{1: 256}); err == nil {
+		t.Errorf("WriteSchematic with block ID 256 succeeded, want error")
+	}
+}
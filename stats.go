@@ -0,0 +1,128 @@
+package vox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stats summarizes the contents of a .vox file.
+type Stats struct {
+	Models     int // The number of models.
+	Voxels     int // The total number of voxels in all the models.
+	ColorsUsed int // The number of different palette indexes used by the voxels.
+	Nodes      int // The number of nodes in the scene graph.
+	Layers     int // The number of layers.
+
+	// Min and Max are the corners of the smallest box that contains
+	// every model (including hidden ones) placed in the scene. If
+	// there's no scene graph, the models are all placed at the origin,
+	// and if there are no models, Min and Max are zero.
+	Min, Max [3]int
+}
+
+// Stats returns a summary of the contents of m.
+func (m *Main) Stats() (Stats, error) {
+	s := Stats{Models: len(m.Models), Layers: len(m.Scene.Layers)}
+	for i, model := range m.Models {
+		vs, err := model.decoded()
+		if err != nil {
+			return Stats{}, fmt.Errorf("model %d: %w", i, err)
+		}
+		s.Voxels += len(vs)
+	}
+	usage := m.ColorUsage()
+	for _, n := range usage[1:] {
+		if n != 0 {
+			s.ColorsUsed++
+		}
+	}
+
+	found := false
+	addBounds := func(min, max [3]int) {
+		for i := 0; i < 3; i++ {
+			if !found || min[i] < s.Min[i] {
+				s.Min[i] = min[i]
+			}
+			if !found || max[i] > s.Max[i] {
+				s.Max[i] = max[i]
+			}
+		}
+		found = true
+	}
+	if m.Scene.Node == nil {
+		for _, model := range m.Models {
+			addBounds([3]int{0, 0, 0}, [3]int{model.X - 1, model.Y - 1, model.Z - 1})
+		}
+		return s, nil
+	}
+	nodes, err := m.Scene.Node.nodeCount(map[AnyNode]bool{})
+	if err != nil {
+		return Stats{}, err
+	}
+	s.Nodes = nodes
+	err = m.Scene.Walk(WalkOptions{IncludeHidden: true}, func(sn *ShapeNode, tf TransformFrame, path []AnyNode) error {
+		for _, model := range sn.Models {
+			addBounds(modelBounds(tf, *model))
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return s, nil
+}
+
+// Summary returns a short description of m, over several lines, for
+// use in reports: the models and their sizes, the number of colors
+// used, the types of the materials that are used, the layers, and the
+// depth of the scene graph.
+func (m *Main) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d models\n", len(m.Models))
+	for i, model := range m.Models {
+		fmt.Fprintf(&b, "  model %d: %dx%dx%d, %d voxels\n", i, model.X, model.Y, model.Z, len(model.voxels()))
+	}
+
+	usage := m.ColorUsage()
+	colors := 0
+	types := map[MaterialType]int{}
+	for i, n := range usage[1:] {
+		if n != 0 {
+			colors++
+			if i+1 < len(m.Materials) {
+				types[m.Materials[i+1].Type]++
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d colors used\n", colors)
+	var parts []string
+	for _, t := range []MaterialType{MaterialDiffuse, MaterialMetal, MaterialGlass, MaterialEmissive} {
+		if types[t] != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", types[t], t))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(&b, "materials used: %s\n", strings.Join(parts, ", "))
+	}
+
+	fmt.Fprintf(&b, "%d layers\n", len(m.Scene.Layers))
+	for _, l := range m.Scene.Layers {
+		hidden := ""
+		if l.Hidden {
+			hidden = " (hidden)"
+		}
+		fmt.Fprintf(&b, "  layer %d: %q%s\n", l.Index, l.Name, hidden)
+	}
+
+	if m.Scene.Node == nil {
+		b.WriteString("no scene graph\n")
+		return b.String()
+	}
+	st, err := m.Stats()
+	if err != nil {
+		fmt.Fprintf(&b, "invalid scene graph: %v\n", err)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "scene graph: %d nodes, depth %d\n", st.Nodes, m.Scene.Depth())
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package vox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := main.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := SceneToDenseWorld(main.Scene, WalkOptions{IncludeHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Min != dw.Min || s.Max != dw.Max {
+		t.Errorf("Stats bounds = %v-%v, want %v-%v", s.Min, s.Max, dw.Min, dw.Max)
+	}
+	if s.Models != len(main.Models) || s.Layers != len(main.Scene.Layers) {
+		t.Errorf("Stats has %d models and %d layers, want %d and %d", s.Models, s.Layers, len(main.Models), len(main.Scene.Layers))
+	}
+	// The root transform and group, and a transform and shape for each of the 4 objects.
+	if s.Nodes != 10 {
+		t.Errorf("Stats has %d nodes, want 10", s.Nodes)
+	}
+
+	m := &Main{Models: []Model{
+		{X: 2, Y: 3, Z: 4, V: []Voxel{{0, 0, 0, 1}, {1, 1, 1, 2}}},
+		{X: 5, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 2}}},
+	}}
+	s, err = m.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{Models: 2, Voxels: 3, ColorsUsed: 2, Max: [3]int{4, 2, 3}}
+	if s != want {
+		t.Errorf("Stats() = %+v, want %+v", s, want)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	main.Scene.Layers[2].Hidden = true
+	got := main.Summary()
+	for _, want := range []string{
+		"4 models\n",
+		"  model 0: ",
+		" colors used\n",
+		"materials used: ",
+		"8 layers\n",
+		"  layer 2: \"2\" (hidden)\n",
+		"scene graph: 10 nodes, depth 4\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Summary() doesn't contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package vox
+
+import (
+	"fmt"
+)
+
+// TileGrid reports whether the visible models in the scene form a
+// regular grid of equal-sized models that exactly fill a box with no
+// gaps or overlaps, as when a large terrain is split into tiles because
+// of MagicaVoxel's limit on the size of a model. If so, it returns the
+// number of tiles along the x, y and z axes.
+func (m *Main) TileGrid() (cols, rows, layers int, ok bool) {
+	instances, err := m.Instances()
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	type tile struct{ min, max [3]int }
+	var tiles []tile
+	for _, in := range instances {
+		if in.Hidden {
+			continue
+		}
+		min, max := modelBounds(in.Transform, *in.Model)
+		tiles = append(tiles, tile{min, max})
+	}
+	if len(tiles) == 0 {
+		return 0, 0, 0, false
+	}
+
+	// Every tile must have the same size, and the same position
+	// relative to the grid, which starts at the smallest corner.
+	size := addVec(tiles[0].max, [3]int{1 - tiles[0].min[0], 1 - tiles[0].min[1], 1 - tiles[0].min[2]})
+	start := tiles[0].min
+	for _, t := range tiles {
+		for i := 0; i < 3; i++ {
+			if t.max[i]-t.min[i]+1 != size[i] {
+				return 0, 0, 0, false
+			}
+			if t.min[i] < start[i] {
+				start[i] = t.min[i]
+			}
+		}
+	}
+	var n [3]int
+	cells := map[[3]int]bool{}
+	for _, t := range tiles {
+		var cell [3]int
+		for i := 0; i < 3; i++ {
+			d := t.min[i] - start[i]
+			if d%size[i] != 0 {
+				return 0, 0, 0, false
+			}
+			cell[i] = d / size[i]
+			if cell[i]+1 > n[i] {
+				n[i] = cell[i] + 1
+			}
+		}
+		if cells[cell] {
+			return 0, 0, 0, false
+		}
+		cells[cell] = true
+	}
+	if len(cells) != n[0]*n[1]*n[2] {
+		return 0, 0, 0, false
+	}
+	return n[0], n[1], n[2], true
+}
+
+// Stitch returns a single DenseWorld containing the visible models in
+// the scene, which must form a grid as reported by TileGrid.
+func (m *Main) Stitch() (*DenseWorld, error) {
+	if _, _, _, ok := m.TileGrid(); !ok {
+		return nil, fmt.Errorf("the models in the scene don't form a grid of tiles")
+	}
+	if m.Scene.Node == nil {
+		return DenseWorldFromModel(identityFrame, m.Models[0])
+	}
+	return SceneToDenseWorld(m.Scene, WalkOptions{})
+}
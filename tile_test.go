@@ -0,0 +1,39 @@
+package vox
+
+import (
+	"testing"
+)
+
+func TestTileGrid(t *testing.T) {
+	tile := Model{X: 4, Y: 4, Z: 2, V: []Voxel{{0, 0, 0, 1}, {3, 3, 1, 2}}}
+	m := &Main{Materials: make([]Material, 256)}
+	for x := 0; x < 3; x++ {
+		for y := 0; y < 2; y++ {
+			// Models are centered on their translation.
+			m.AddModel(tile, TransformFrame{R: Matrix3x3Identity, T: [3]int32{int32(x*4 + 10), int32(y * 4), 1}}, 0)
+		}
+	}
+	cols, rows, layers, ok := m.TileGrid()
+	if !ok || cols != 3 || rows != 2 || layers != 1 {
+		t.Errorf("TileGrid() = %d, %d, %d, %v, want 3, 2, 1, true", cols, rows, layers, ok)
+	}
+	dw, err := m.Stitch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if min, max := dw.Cuboid(); min != [3]int{9, -1, 1} || max != [3]int{20, 6, 2} {
+		t.Errorf("stitched world covers %v-%v, want [9 -1 1]-[20 6 2]", min, max)
+	}
+	if n := countNonEmpty(dw); n != 12 {
+		t.Errorf("stitched world has %d voxels, want 12", n)
+	}
+
+	// A gap in the grid.
+	m.AddModel(tile, TransformFrame{R: Matrix3x3Identity, T: [3]int32{10, 12, 1}}, 0)
+	if _, _, _, ok := m.TileGrid(); ok {
+		t.Errorf("TileGrid() of grid with a gap = true, want false")
+	}
+	if _, err := m.Stitch(); err == nil {
+		t.Errorf("Stitch() of grid with a gap succeeded, want error")
+	}
+}
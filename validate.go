@@ -0,0 +1,133 @@
+package vox
+
+import (
+	"fmt"
+)
+
+// Validate checks that m is consistent: every model's voxels are inside
+// the model, every voxel's color index has a material, layer indices
+// are unique, and the scene graph (if there is one) has no cycles, has
+// transform nodes on layers in the scene, and refers only to models
+// in m.Models. Parse always returns a valid Main, but Validate is
+// useful after changing a Main, for example before encoding it.
+func (m *Main) Validate() error {
+	for i, model := range m.Models {
+		if model.X < 1 || model.Y < 1 || model.Z < 1 || model.X > 256 || model.Y > 256 || model.Z > 256 {
+			return fmt.Errorf("model %d has invalid size %dx%dx%d", i, model.X, model.Y, model.Z)
+		}
+		vs, err := model.decoded()
+		if err != nil {
+			return fmt.Errorf("model %d: %w", i, err)
+		}
+		for _, v := range vs {
+			if int(v.X) >= model.X || int(v.Y) >= model.Y || int(v.Z) >= model.Z {
+				return fmt.Errorf("model %d has voxel %v outside its size %dx%dx%d", i, v, model.X, model.Y, model.Z)
+			}
+			if int(v.ColorIndex) >= len(m.Materials) {
+				return fmt.Errorf("model %d has voxel %v, but there are only %d materials", i, v, len(m.Materials))
+			}
+		}
+	}
+
+	layers := map[int32]bool{}
+	for _, l := range m.Scene.Layers {
+		if layers[l.Index] {
+			return fmt.Errorf("two layers have index %d", l.Index)
+		}
+		layers[l.Index] = true
+	}
+
+	if m.Scene.Node == nil {
+		if len(m.Scene.Layers) != 0 {
+			return fmt.Errorf("scene has %d layers, but no nodes", len(m.Scene.Layers))
+		}
+		return nil
+	}
+	if m.Scene.Node.Layer != nil {
+		return fmt.Errorf("root transform node must not have a layer")
+	}
+	v := &sceneValidator{
+		m:        m,
+		layers:   layers,
+		visiting: map[AnyNode]bool{},
+		done:     map[AnyNode]bool{},
+	}
+	return v.validate(m.Scene.Node)
+}
+
+// sceneValidator checks the nodes of a scene graph.
+type sceneValidator struct {
+	m      *Main
+	layers map[int32]bool
+	// visiting holds the nodes on the path from the root to the
+	// current node, and done holds the nodes that have been checked.
+	visiting, done map[AnyNode]bool
+}
+
+func (v *sceneValidator) validate(n AnyNode) error {
+	if n == nil {
+		return fmt.Errorf("scene graph contains a nil node")
+	}
+	if v.visiting[n] {
+		return fmt.Errorf("scene graph has a cycle")
+	}
+	if v.done[n] {
+		return nil
+	}
+	v.visiting[n] = true
+	defer func() {
+		delete(v.visiting, n)
+		v.done[n] = true
+	}()
+
+	switch t := n.(type) {
+	case *TransformNode:
+		if t != v.m.Scene.Node {
+			if t.Layer == nil {
+				return fmt.Errorf("non-root transform node %q has no layer", t.Name)
+			}
+			if !v.layers[t.Layer.Index] {
+				return fmt.Errorf("transform node %q is on layer %d, which isn't in the scene", t.Name, t.Layer.Index)
+			}
+		}
+		if len(t.Transforms) == 0 {
+			return fmt.Errorf("transform node %q has no transforms", t.Name)
+		}
+		for _, tf := range t.Transforms {
+			if !tf.R.Valid() {
+				return fmt.Errorf("transform node %q has invalid rotation %d", t.Name, tf.R)
+			}
+		}
+		if t.Child == nil {
+			return fmt.Errorf("transform node %q has no child", t.Name)
+		}
+		return v.validate(t.Child)
+	case *GroupNode:
+		for _, c := range t.Children {
+			if err := v.validate(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ShapeNode:
+		if t.Frames != nil && len(t.Frames) != len(t.Models) {
+			return fmt.Errorf("shape node %q has %d models, but %d frames", t.Name, len(t.Models), len(t.Frames))
+		}
+		if t.ModelAttrs != nil && len(t.ModelAttrs) != len(t.Models) {
+			return fmt.Errorf("shape node %q has %d models, but %d model attributes", t.Name, len(t.Models), len(t.ModelAttrs))
+		}
+		for _, model := range t.Models {
+			found := false
+			for i := range v.m.Models {
+				if &v.m.Models[i] == model {
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("shape node %q refers to a model that isn't in Main.Models", t.Name)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("found unexpected node of type %T", n)
+}
@@ -0,0 +1,47 @@
+package vox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, filename := range []string{"testdata/test.vox", "testdata/scene.vox", "testdata/newattrs.vox"} {
+		m, err := ParseFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Validate(); err != nil {
+			t.Errorf("%s: Validate() = %v, want nil", filename, err)
+		}
+	}
+
+	testCases := []struct {
+		desc   string
+		change func(m *Main)
+		want   string
+	}{
+		{"voxel outside model", func(m *Main) { m.Models[0].V[0].X = 1 }, "outside its size"},
+		{"missing material", func(m *Main) { m.Materials = m.Materials[:1] }, "only 1 materials"},
+		{"duplicate layers", func(m *Main) { m.Scene.Layers = append(m.Scene.Layers, m.Scene.Layers[0]) }, "two layers"},
+		{"missing layer", func(m *Main) {
+			m.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode).Layer = &Layer{Index: 3}
+		}, "isn't in the scene"},
+		{"copied model", func(m *Main) {
+			sn := m.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode).Child.(*ShapeNode)
+			model := m.Models[0]
+			sn.Models[0] = &model
+		}, "isn't in Main.Models"},
+		{"cycle", func(m *Main) {
+			g := m.Scene.Node.Child.(*GroupNode)
+			g.Children = append(g.Children, m.Scene.Node)
+		}, "cycle"},
+	}
+	for _, tc := range testCases {
+		m := smallMain()
+		tc.change(m)
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Validate() = %v, want error containing %q", tc.desc, err, tc.want)
+		}
+	}
+}
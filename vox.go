@@ -11,9 +11,50 @@ import (
 // Main contains the models, palette and materials
 // in a magicavoxel .vox file.
 type Main struct {
-	Models    []Model
+	Models []Model
+
+	// Materials[i] is the material of voxels with color index i.
+	// The RGBA chunk of a file doesn't have an entry for index 0,
+	// which means an empty voxel: its entry i holds the color of index
+	// i+1. Its last entry, which no voxel can use, is kept as the
+	// color of Materials[0], so that the chunk is written back as it
+	// was read. RawPalette returns the colors in the order of the
+	// chunk.
 	Materials []Material
 	Scene     Scene
+
+	// Lights holds the lights of MagicaVoxel's render settings, in
+	// the order they appear in the file.
+	Lights []Light
+
+	// Scale is the size of a voxel along the x, y and z axes, from
+	// the _scale field of MagicaVoxel's render settings, so that
+	// exporters can produce geometry of the size the author intended.
+	// The zero value means the same as (1, 1, 1). Like the lights,
+	// it isn't written by Encode.
+	Scale [3]float32
+
+	// CustomChunks holds the chunks with IDs that have been
+	// registered with RegisterChunkParser, keyed by chunk ID, in the
+	// order they appear in the file. When encoding, values that are
+	// []byte or implement encoding.BinaryMarshaler are written as
+	// chunks with the given ID.
+	CustomChunks map[string][]interface{}
+
+	// ChunkOrder holds the IDs of the chunks in the file, in the
+	// order they appeared, if the file was parsed with
+	// ParseOptions.KeepChunkOrder. When encoding, the chunks are
+	// written in the same order where possible, so that an edited file
+	// differs from the original as little as possible.
+	ChunkOrder []string
+}
+
+// voxelScale returns m.Scale, or (1, 1, 1) if it's zero.
+func (m *Main) voxelScale() [3]float32 {
+	if m.Scale == [3]float32{} {
+		return [3]float32{1, 1, 1}
+	}
+	return m.Scale
 }
 
 // A Voxel is a single voxel in a model.
@@ -22,6 +63,15 @@ type Voxel struct {
 	ColorIndex uint8
 }
 
+// IsEmpty reports whether a voxel with the given color (or material)
+// index is empty. Index 0 is reserved to mean an empty voxel: the
+// palette entries that voxels use are 1 to 255, and palette entry 0 is
+// never displayed. Models list only their non-empty voxels, and in a
+// DenseWorld, empty voxels have index 0.
+func IsEmpty(matIdx uint8) bool {
+	return matIdx == 0
+}
+
 func (v Voxel) String() string {
 	return fmt.Sprintf("V{%d,%d,%d:%d}", v.X, v.Y, v.Z, v.ColorIndex)
 }
@@ -30,6 +80,76 @@ func (v Voxel) String() string {
 type Model struct {
 	X, Y, Z int // Size
 	V       []Voxel
+
+	// PaletteHint holds the palette indices that the model's voxels
+	// use, in increasing order, without index 0. It lets code that only
+	// needs the model's colors, such as exporters, find them without
+	// looking at every voxel. Parse sets it (or, for lazily parsed
+	// models, Voxels does), and CompactPalette keeps it up to date, but
+	// it's only a hint: it's nil if it's not known, and other changes
+	// to V don't update it. UpdatePaletteHint recomputes it.
+	PaletteHint []uint8
+
+	// raw holds the contents of the model's XYZI chunk, if the
+	// model was parsed with ParseOptions.LazyModels and its voxels
+	// haven't been decoded yet. It's ignored once V is set.
+	raw []byte
+}
+
+// Voxels returns the voxels of m. If m was parsed with
+// ParseOptions.LazyModels, the first call decodes the voxels and stores
+// them in m.V, and returns an error if they are invalid. Otherwise, it
+// returns m.V.
+func (m *Model) Voxels() ([]Voxel, error) {
+	if m.raw != nil && m.V == nil {
+		vs, err := parseXYZIChunk(m.raw)
+		if err != nil {
+			return nil, err
+		}
+		m.V = vs
+		m.UpdatePaletteHint()
+	}
+	m.raw = nil
+	return m.V, nil
+}
+
+// decoded returns the voxels of m like Voxels, but without storing
+// them in m.
+func (m Model) decoded() ([]Voxel, error) {
+	if m.raw != nil && m.V == nil {
+		return parseXYZIChunk(m.raw)
+	}
+	return m.V, nil
+}
+
+// voxels returns the voxels of m, for code that can't return an error.
+// If m's voxels haven't been decoded and are invalid, it returns none;
+// Voxels and Validate report the error.
+func (m Model) voxels() []Voxel {
+	vs, _ := m.decoded()
+	return vs
+}
+
+// UpdatePaletteHint sets m.PaletteHint to the palette indices used by
+// the voxels of m.
+func (m *Model) UpdatePaletteHint() {
+	m.PaletteHint = paletteIndices(m.voxels())
+}
+
+// paletteIndices returns the palette indices other than 0 used by
+// vs, in increasing order.
+func paletteIndices(vs []Voxel) []uint8 {
+	var used [256]bool
+	for _, v := range vs {
+		used[v.ColorIndex] = true
+	}
+	r := []uint8{}
+	for i := 1; i < 256; i++ {
+		if used[i] {
+			r = append(r, uint8(i))
+		}
+	}
+	return r
 }
 
 // A Layer groups scene nodes.
@@ -63,8 +183,8 @@ func (n Node) isNode() {}
 // its children.
 type TransformNode struct {
 	Node
-	Layer      *Layer           // The layer this node belongs to (or nil if it's the root node).
-	Transforms []TransformFrame // Currently must be a single element.
+	Layer      *Layer           // The layer in Scene.Layers this node belongs to (or nil if it's the root node).
+	Transforms []TransformFrame // One for each keyframe of an animation. Non-animated files have a single transform.
 	Child      AnyNode          // Child nodes that are affected by this transformation.
 }
 
@@ -89,10 +209,12 @@ func (tn *TransformNode) String() string {
 }
 
 // TransformFrame describes how a transform node affects
-// its children.
+// its children. The frame dict in a .vox file holds the
+// fields _r (R), _t (T) and, in animated files, _f (Frame).
 type TransformFrame struct {
-	R Matrix3x3 // Rotation
-	T [3]int32  // Translation
+	R     Matrix3x3 // Rotation
+	T     [3]int32  // Translation
+	Frame int32     // The index of the animation frame this transform applies from.
 }
 
 func (tn TransformFrame) String() string {
@@ -125,7 +247,19 @@ func (gn *GroupNode) String() string {
 // to a voxel model.
 type ShapeNode struct {
 	Node
-	Models []*Model // Currently must be a single model.
+	// Models holds the models of the shape. There's usually one,
+	// but an animated shape has one model for each keyframe.
+	Models []*Model
+	// Frames holds the animation frame at which each model in Models
+	// starts, read from the _f field of the model's attributes. It's
+	// nil if none of the models has a frame, which means they're all
+	// at frame 0.
+	Frames []int32
+	// ModelAttrs holds the attributes of each model in Models other
+	// than _f, which this package doesn't interpret but writes back
+	// when encoding. It's nil if none of the models has any, and
+	// otherwise an entry is nil if its model has none.
+	ModelAttrs []map[string]string
 }
 
 func (sn *ShapeNode) String() string {
@@ -136,12 +270,24 @@ func (sn *ShapeNode) String() string {
 	if sn.Hidden {
 		parts = append(parts, "hidden")
 	}
-	for _, m := range sn.Models {
+	for i, m := range sn.Models {
 		parts = append(parts, fmt.Sprintf("model:%p", m))
+		if sn.Frames != nil {
+			parts = append(parts, fmt.Sprintf("frame:%d", sn.frame(i)))
+		}
 	}
 	return fmt.Sprintf("Shape{%s}", strings.Join(parts, ", "))
 }
 
+// frame returns the frame of the i'th model in sn.Models, or 0 if
+// sn.Frames doesn't have an entry for it.
+func (sn *ShapeNode) frame(i int) int32 {
+	if i < len(sn.Frames) {
+		return sn.Frames[i]
+	}
+	return 0
+}
+
 // MaterialType describes the nature of a material.
 type MaterialType int
 
@@ -169,6 +315,77 @@ type Material struct {
 	Attenuation float32
 	Flux        float32
 	LDR         float32
+
+	// Fields records which of the properties were present in the
+	// MATL (or MATT) chunk that the material was read from, so that
+	// properties that were missing, and so have their default values,
+	// can be told apart from properties that were set. A property that
+	// isn't in Fields, but whose value differs from the value a missing
+	// property is parsed as (because it was changed after parsing), is
+	// also treated as present. Encode writes only the present properties,
+	// and String doesn't show the others. Parsed materials always have
+	// FieldType set. If Fields is zero, as it is for a material made by
+	// NewMaterial, every property is treated as present.
+	Fields MaterialFields
+}
+
+// MaterialFields is a set of the properties of a material.
+type MaterialFields uint16
+
+const (
+	FieldType MaterialFields = 1 << iota
+	FieldWeight
+	FieldPlastic
+	FieldRoughness
+	FieldSpecular
+	FieldIOR
+	FieldAttenuation
+	FieldFlux
+	FieldLDR
+)
+
+// missingMaterial holds the values that parseMatlChunk gives the
+// properties that are missing from a MATL chunk.
+var missingMaterial = Material{Weight: 100, IOR: 1}
+
+// has reports whether the material's property f is present.
+func (m Material) has(f MaterialFields) bool {
+	if m.Fields == 0 || m.Fields&f != 0 {
+		return true
+	}
+	d := missingMaterial
+	switch f {
+	case FieldWeight:
+		return m.Weight != d.Weight
+	case FieldPlastic:
+		return m.Plastic != d.Plastic
+	case FieldRoughness:
+		return m.Roughness != d.Roughness
+	case FieldSpecular:
+		return m.Specular != d.Specular
+	case FieldIOR:
+		return m.IOR != d.IOR
+	case FieldAttenuation:
+		return m.Attenuation != d.Attenuation
+	case FieldFlux:
+		return m.Flux != d.Flux
+	case FieldLDR:
+		return m.LDR != d.LDR
+	}
+	return false
+}
+
+// NewMaterial returns a material of the given type, with every
+// property other than the color set to its default value. The
+// defaults are the values that String treats as unset, and that
+// MagicaVoxel uses for a new material of the type.
+func NewMaterial(t MaterialType) Material {
+	return Material{
+		Type:        t,
+		Weight:      100,
+		IOR:         1,
+		Attenuation: 100,
+	}
 }
 
 func (mt MaterialType) String() string {
@@ -187,29 +404,76 @@ func (mt MaterialType) String() string {
 
 func (m Material) String() string {
 	parts := []string{fmt.Sprintf("rgba:%02x%02x%02x%02x", m.Color.R, m.Color.G, m.Color.B, m.Color.A), m.Type.String()}
-	if m.Weight != 100 {
+	if m.Weight != 100 && m.has(FieldWeight) {
 		parts = append(parts, fmt.Sprintf("w:%.1f", m.Weight))
 	}
-	if m.Plastic && m.Type == MaterialMetal {
+	if m.Plastic && m.Type == MaterialMetal && m.has(FieldPlastic) {
 		parts = append(parts, fmt.Sprintf("plastic"))
 	}
 	all := 1 + 2 + 4 + 8
 	for _, v := range []struct {
-		s   string
-		v   float32
-		def float32
-		mt  int
+		s     string
+		v     float32
+		def   float32
+		mt    int
+		field MaterialFields
 	}{
-		{"rough", m.Roughness, 0, all},
-		{"spec", m.Specular, 0, all},
-		{"ior", m.IOR, 1.0, (1 << uint(MaterialGlass))},
-		{"attn", m.Attenuation, 100, (1 << uint(MaterialGlass))},
-		{"flux", m.Flux, 0, (1 << uint(MaterialEmissive))},
-		{"ldr", m.LDR, 0, (1 << uint(MaterialEmissive))},
+		{"rough", m.Roughness, 0, all, FieldRoughness},
+		{"spec", m.Specular, 0, all, FieldSpecular},
+		{"ior", m.IOR, 1.0, (1 << uint(MaterialGlass)), FieldIOR},
+		{"attn", m.Attenuation, 100, (1 << uint(MaterialGlass)), FieldAttenuation},
+		{"flux", m.Flux, 0, (1 << uint(MaterialEmissive)), FieldFlux},
+		{"ldr", m.LDR, 0, (1 << uint(MaterialEmissive)), FieldLDR},
 	} {
-		if v.v != v.def && (1<<uint(m.Type))&v.mt != 0 {
+		if v.v != v.def && (1<<uint(m.Type))&v.mt != 0 && m.has(v.field) {
 			parts = append(parts, fmt.Sprintf("%s:%.1f", v.s, v.v))
 		}
 	}
 	return fmt.Sprintf("Mat{%s}", strings.Join(parts, ", "))
 }
+
+// LightType describes the kind of a light.
+type LightType int
+
+const (
+	LightInfinite LightType = 0 // A distant light, like the sun.
+	LightUniform  LightType = 1 // Ambient light that comes from every direction.
+)
+
+func (lt LightType) String() string {
+	switch lt {
+	case LightInfinite:
+		return "infinite"
+	case LightUniform:
+		return "uniform"
+	}
+	return fmt.Sprintf("LightType(%d)", lt)
+}
+
+// A Light is one of the lights used when rendering the scene.
+// MagicaVoxel has no chunk of its own for lights: they're stored with
+// the other render settings, in rOBJ chunks whose _type is _inf (for
+// the sun) or _uni (for ambient light), with the intensity in _i, the
+// color in _k, and for the sun, its direction in _angle, its size in
+// _area and whether it's drawn as a disk in _disk.
+type Light struct {
+	Type      LightType
+	Intensity float32
+	Color     color.RGBA
+
+	// These are only used by infinite lights.
+	Angle [2]float32 // The direction of the light, in degrees.
+	Area  float32    // The angular size of the light source.
+	Disk  bool       // Whether the light source is visible as a disk.
+}
+
+func (l Light) String() string {
+	parts := []string{l.Type.String(), fmt.Sprintf("i:%.2f", l.Intensity), fmt.Sprintf("rgb:%02x%02x%02x", l.Color.R, l.Color.G, l.Color.B)}
+	if l.Type == LightInfinite {
+		parts = append(parts, fmt.Sprintf("angle:%.1f,%.1f", l.Angle[0], l.Angle[1]), fmt.Sprintf("area:%.2f", l.Area))
+		if l.Disk {
+			parts = append(parts, "disk")
+		}
+	}
+	return fmt.Sprintf("Light{%s}", strings.Join(parts, ", "))
+}
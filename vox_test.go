@@ -1,8 +1,11 @@
 package vox
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image/color"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -77,7 +80,54 @@ func TestSceneParse(t *testing.T) {
 	if main == nil {
 		t.Fatal("no main")
 	}
-	// TODO: verify scene structure etc.
+	checkGolden(t, main, "testdata/scene.golden", false)
+}
+
+func TestSceneLayers(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLayers := map[string]int32{
+		"other thing": 2,
+		"redrum":      0,
+		"boxes":       1,
+		"something":   2,
+	}
+	group, ok := main.Scene.Node.Child.(*GroupNode)
+	if !ok {
+		t.Fatalf("root child is %T, want *GroupNode", main.Scene.Node.Child)
+	}
+	if main.Scene.Node.Layer != nil {
+		t.Errorf("root node has layer %v, want nil", main.Scene.Node.Layer)
+	}
+	for _, c := range group.Children {
+		tn, ok := c.(*TransformNode)
+		if !ok {
+			t.Fatalf("group child is %T, want *TransformNode", c)
+		}
+		want, ok := wantLayers[tn.Name]
+		if !ok {
+			t.Errorf("unexpected transform node %q", tn.Name)
+			continue
+		}
+		if tn.Layer == nil {
+			t.Errorf("node %q has no layer, want layer %d", tn.Name, want)
+			continue
+		}
+		if tn.Layer.Index != want {
+			t.Errorf("node %q is on layer %d, want %d", tn.Name, tn.Layer.Index, want)
+		}
+		found := false
+		for i := range main.Scene.Layers {
+			if tn.Layer == &main.Scene.Layers[i] {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("node %q has layer %p, which isn't one of the scene's layers", tn.Name, tn.Layer)
+		}
+	}
 }
 
 func TestNewAttrsParse(t *testing.T) {
@@ -89,7 +139,7 @@ func TestNewAttrsParse(t *testing.T) {
 	if main == nil {
 		t.Fatal("no main")
 	}
-	// TODO: verify scene structure etc.
+	checkGolden(t, main, "testdata/newattrs.golden", false)
 }
 
 func countVoxels(dw *DenseWorld) (int, error) {
@@ -126,7 +176,7 @@ func TestDenseWorldFromModel(t *testing.T) {
 			continue
 		}
 		for _, tr := range translations {
-			tf := TransformFrame{m, tr}
+			tf := TransformFrame{R: m, T: tr}
 			dw, err := DenseWorldFromModel(tf, mod)
 			if err != nil {
 				t.Errorf("%#v: failed to create dense world: %v", tf, err)
@@ -151,3 +201,549 @@ func TestDenseWorldFromModel(t *testing.T) {
 		t.Fatalf("found %d voxels, but that's impossible because the original model was of size %d,%d,%d", vxCount, mod.X, mod.Y, mod.Z)
 	}
 }
+
+func TestDenseWorldTranslate(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{-2, -3, -4}, [3]int{2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{-2, -3, -4}, 7)
+	dw.SetMaterialIndex([3]int{1, 2, 3}, 9)
+	dw.Translate([3]int{2, 3, 4})
+	if min, max := dw.Cuboid(); min != [3]int{0, 0, 0} || max != [3]int{4, 6, 8} {
+		t.Errorf("translated world has cuboid %v-%v, want [0 0 0]-[4 6 8]", min, max)
+	}
+	for c, want := range map[[3]int]uint8{{0, 0, 0}: 7, {3, 5, 7}: 9, {1, 1, 1}: 0} {
+		if got, ok := dw.MaterialIndex(c); !ok || got != want {
+			t.Errorf("MaterialIndex(%v) = %d, %v, want %d, true", c, got, ok, want)
+		}
+	}
+}
+
+func TestNewDenseWorldSize(t *testing.T) {
+	const maxInt = int(^uint(0) >> 1)
+	const minInt = -maxInt - 1
+	for _, tc := range []struct {
+		min, max [3]int
+	}{
+		{[3]int{minInt, 0, 0}, [3]int{maxInt, 0, 0}},
+		{[3]int{0, minInt, 0}, [3]int{0, -1, 0}},
+		{[3]int{-1, 0, 0}, [3]int{maxInt - 1, 0, 0}},
+		{[3]int{0, 0, 0}, [3]int{1 << 20, 1 << 20, 1 << 20}},
+		{[3]int{0, 0, 0}, [3]int{maxInt / 2, 2, 0}},
+	} {
+		if _, err := NewDenseWorld(tc.min, tc.max); err == nil {
+			t.Errorf("NewDenseWorld(%v, %v) succeeded, want error", tc.min, tc.max)
+		}
+	}
+
+	defer func(old int) { MaxDenseWorldVoxels = old }(MaxDenseWorldVoxels)
+	MaxDenseWorldVoxels = 1000
+	if _, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{9, 9, 9}); err != nil {
+		t.Errorf("NewDenseWorld with 1000 voxels failed: %v", err)
+	}
+	if _, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{9, 9, 10}); err == nil {
+		t.Errorf("NewDenseWorld with 1100 voxels succeeded, want error")
+	}
+}
+
+func TestParseLights(t *testing.T) {
+	main, err := ParseFile("testdata/newattrs.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Light{
+		{Type: LightInfinite, Intensity: 0.7, Color: color.RGBA{255, 255, 255, 255}, Angle: [2]float32{50, 50}, Area: 0.07},
+		{Type: LightUniform, Intensity: 0.7, Color: color.RGBA{255, 255, 255, 255}},
+	}
+	if !reflect.DeepEqual(main.Lights, want) {
+		t.Errorf("lights = %v, want %v", main.Lights, want)
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	main, err := ParseFile("testdata/newattrs.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [3]float32{1, 1, 1}; main.Scale != want {
+		t.Errorf("scale = %v, want %v", main.Scale, want)
+	}
+
+	var b bytes.Buffer
+	vw := &voxWriter{w: &b}
+	vw.WriteDict([]dictEntry{{"_type", "_setting"}, {"_ground", "1"}, {"_scale", "2 1 0.5"}})
+	light, scale, err := parseRObjChunk(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [3]float32{2, 1, 0.5}; light != nil || scale == nil || *scale != want {
+		t.Errorf("parsing settings gave light %v, scale %v; want no light and scale %v", light, scale, want)
+	}
+}
+
+func TestNewMaterial(t *testing.T) {
+	for _, mt := range []MaterialType{MaterialDiffuse, MaterialMetal, MaterialGlass, MaterialEmissive} {
+		m := NewMaterial(mt)
+		m.Color = color.RGBA{1, 2, 3, 255}
+		want := fmt.Sprintf("Mat{rgba:010203ff, %s}", mt)
+		if got := m.String(); got != want {
+			t.Errorf("NewMaterial(%s) = %s, want %s", mt, got, want)
+		}
+	}
+}
+
+func TestModelRotate(t *testing.T) {
+	m := Model{X: 2, Y: 3, Z: 4, V: []Voxel{{0, 0, 0, 1}, {1, 2, 3, 2}, {1, 0, 2, 3}}}
+	rots := ValidMatrices()
+	for _, a := range rots {
+		for _, b := range rots {
+			got := m.Rotate(b).Rotate(a)
+			want := m.Rotate(a.Mul(b))
+			if !got.Equal(&want) {
+				t.Fatalf("rotating by %v then %v gives %v, but rotating by %v gives %v", b, a, got, a.Mul(b), want)
+			}
+		}
+	}
+
+	// A quarter turn about z maps x to y, and y to -x.
+	r := Matrix3x3(1 | 0<<2 | 1<<4)
+	got := m.Rotate(r)
+	want := Model{X: 3, Y: 2, Z: 4, V: []Voxel{{2, 0, 0, 1}, {0, 1, 3, 2}, {2, 1, 2, 3}}}
+	if !got.Equal(&want) {
+		t.Errorf("Rotate(%v) = %v, want %v", r, got, want)
+	}
+}
+
+func TestMainTransform(t *testing.T) {
+	orig := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {1, 0, 0, 2}}}
+	m := &Main{Models: []Model{orig}}
+	model := &m.Models[0]
+	var remap [256]uint8
+	for i := range remap {
+		remap[i] = uint8(i)
+	}
+	remap[1], remap[2] = 5, 0
+	// A quarter turn about z.
+	r := Matrix3x3(1 | 0<<2 | 1<<4 | 1<<5)
+	if err := m.Transform(0, r, &remap); err != nil {
+		t.Fatal(err)
+	}
+	// The same as rotating, then removing the voxel with color 2
+	// and changing color 1 to 5.
+	want := orig.Rotate(r)
+	want.V = want.V[:1]
+	want.V[0].ColorIndex = 5
+	if !model.Equal(&want) {
+		t.Errorf("after Transform, model = %v, want %v", *model, want)
+	}
+	if err := m.Transform(1, Matrix3x3Identity, nil); err == nil {
+		t.Errorf("Transform of a missing model succeeded, want error")
+	}
+	if err := m.Transform(0, Matrix3x3(0), nil); err == nil {
+		t.Errorf("Transform with an invalid matrix succeeded, want error")
+	}
+
+	// Lazily parsed models are decoded before they're transformed.
+	lazy := &Main{Models: []Model{{X: 2, Y: 1, Z: 1, raw: []byte{1, 0, 0, 0, 1, 0, 0, 7}}}}
+	if err := lazy.Transform(0, Matrix3x3Identity, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lazy.Models[0].V, []Voxel{{1, 0, 0, 7}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Transform, lazy model has voxels %v, want %v", got, want)
+	}
+	lazy.Models[0] = Model{X: 1, Y: 1, Z: 1, raw: []byte{5, 0, 0, 0}}
+	if err := lazy.Transform(0, Matrix3x3Identity, nil); err == nil {
+		t.Errorf("Transform of a corrupt lazy model succeeded, want error")
+	}
+}
+
+func TestModelToWorld(t *testing.T) {
+	size := [3]int{3, 4, 5}
+	m := Model{X: size[0], Y: size[1], Z: size[2]}
+	for _, r := range ValidMatrices() {
+		tf := TransformFrame{R: r, T: [3]int32{10, -20, 7}}
+		min, max := modelBounds(tf, m)
+		for _, v := range [][3]int{{0, 0, 0}, {2, 3, 4}, {1, 2, 0}} {
+			w := ModelToWorld(tf, size, v)
+			for i := 0; i < 3; i++ {
+				if w[i] < min[i] || w[i] > max[i] {
+					t.Errorf("ModelToWorld(%x, %v) = %v, outside the model's bounds %v-%v", r, v, w, min, max)
+				}
+			}
+			if got := WorldToModel(tf, size, w); got != v {
+				t.Errorf("WorldToModel(%x, ModelToWorld(%v)) = %v", r, v, got)
+			}
+		}
+	}
+	// Without rotation, a model is centered on its translation.
+	tf := TransformFrame{R: Matrix3x3Identity, T: [3]int32{10, 10, 10}}
+	if got, want := ModelToWorld(tf, size, [3]int{0, 0, 0}), [3]int{9, 9, 8}; got != want {
+		t.Errorf("ModelToWorld(identity, 0) = %v, want %v", got, want)
+	}
+}
+
+func TestVoxelsWithColor(t *testing.T) {
+	m := Model{X: 3, Y: 2, Z: 1, V: []Voxel{{2, 1, 0, 5}, {0, 0, 0, 1}, {1, 0, 0, 5}}}
+	if got, want := m.VoxelsWithColor(5), []Voxel{{2, 1, 0, 5}, {1, 0, 0, 5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VoxelsWithColor(5) = %v, want %v", got, want)
+	}
+	if got := m.VoxelsWithColor(7); len(got) != 0 {
+		t.Errorf("VoxelsWithColor(7) = %v, want none", got)
+	}
+
+	dw, err := NewDenseWorld([3]int{-1, 0, 0}, [3]int{1, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{1, 1, 0}, 5)
+	dw.SetMaterialIndex([3]int{-1, 0, 0}, 5)
+	dw.SetMaterialIndex([3]int{0, 0, 0}, 1)
+	if got, want := dw.CoordsWithMaterial(5), [][3]int{{-1, 0, 0}, {1, 1, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CoordsWithMaterial(5) = %v, want %v", got, want)
+	}
+	if got := len(dw.CoordsWithMaterial(0)); got != 3 {
+		t.Errorf("CoordsWithMaterial(0) found %d empty voxels, want 3", got)
+	}
+}
+
+func TestModelVolume(t *testing.T) {
+	for n := 1; n <= 4; n++ {
+		m := Model{X: n, Y: n, Z: n}
+		for x := 0; x < n; x++ {
+			for y := 0; y < n; y++ {
+				for z := 0; z < n; z++ {
+					m.V = append(m.V, Voxel{uint8(x), uint8(y), uint8(z), 1})
+				}
+			}
+		}
+		if got, want := m.Volume(), n*n*n; got != want {
+			t.Errorf("%d-cube: Volume() = %d, want %d", n, got, want)
+		}
+		if got, want := m.SurfaceArea(), 6*n*n; got != want {
+			t.Errorf("%d-cube: SurfaceArea() = %d, want %d", n, got, want)
+		}
+	}
+
+	// Two voxels that share a face, with one repeated and an empty
+	// voxel that doesn't count.
+	m := Model{X: 3, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {1, 0, 0, 2}, {1, 0, 0, 2}, {2, 0, 0, 0}}}
+	if got := m.Volume(); got != 2 {
+		t.Errorf("Volume() = %d, want 2", got)
+	}
+	if got := m.SurfaceArea(); got != 10 {
+		t.Errorf("SurfaceArea() = %d, want 10", got)
+	}
+}
+
+func TestModelCentroid(t *testing.T) {
+	m := Model{X: 4, Y: 4, Z: 4, V: []Voxel{{0, 0, 0, 1}, {2, 0, 0, 1}, {1, 3, 0, 1}}}
+	if got, want := m.Centroid(), [3]float64{1.5, 1.5, 0.5}; got != want {
+		t.Errorf("Centroid() = %v, want %v", got, want)
+	}
+	center, radius := m.BoundingSphere()
+	if want := [3]float64{1.5, 2, 0.5}; center != want {
+		t.Errorf("BoundingSphere() center = %v, want %v", center, want)
+	}
+	// The farthest corners are 1.5, 2 and 0.5 from the center.
+	if want := math.Sqrt(1.5*1.5 + 2*2 + 0.5*0.5); math.Abs(radius-want) > 1e-9 {
+		t.Errorf("BoundingSphere() radius = %v, want %v", radius, want)
+	}
+	if c, r := (Model{X: 1, Y: 1, Z: 1}).BoundingSphere(); c != [3]float64{} || r != 0 {
+		t.Errorf("BoundingSphere() of empty model = %v, %v, want origin and 0", c, r)
+	}
+}
+
+func TestModelRecenter(t *testing.T) {
+	m := Model{X: 10, Y: 10, Z: 2, V: []Voxel{{2, 3, 0, 1}, {5, 3, 0, 2}, {3, 7, 0, 3}}}
+	for _, tc := range []struct {
+		mode  PivotMode
+		pivot [3]int
+		size  [3]int
+	}{
+		{PivotMinCorner, [3]int{2, 3, 0}, [3]int{6, 8, 1}},
+		{PivotCenter, [3]int{3, 5, 0}, [3]int{4, 5, 1}},
+		{PivotCentroid, [3]int{3, 4, 0}, [3]int{4, 6, 1}},
+	} {
+		r, offset, err := m.Recenter(tc.mode)
+		if err != nil {
+			t.Errorf("Recenter(%v) failed: %v", tc.mode, err)
+			continue
+		}
+		if got := [3]int{r.X, r.Y, r.Z}; got != tc.size {
+			t.Errorf("Recenter(%v) has size %v, want %v", tc.mode, got, tc.size)
+		}
+		if got, want := addVec(tc.pivot, offset), [3]int{(r.X - 1) / 2, (r.Y - 1) / 2, (r.Z - 1) / 2}; got != want {
+			t.Errorf("Recenter(%v) moved the pivot to %v, want %v", tc.mode, got, want)
+		}
+		for i, v := range r.V {
+			o := m.V[i]
+			if want := addVec([3]int{int(o.X), int(o.Y), int(o.Z)}, offset); [3]int{int(v.X), int(v.Y), int(v.Z)} != want || v.ColorIndex != o.ColorIndex {
+				t.Errorf("Recenter(%v) moved voxel %v to %v, want %v", tc.mode, o, v, want)
+			}
+		}
+	}
+	wide := Model{X: 200, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 1}, {199, 0, 0, 1}}}
+	if _, _, err := wide.Recenter(PivotMinCorner); err == nil {
+		t.Errorf("Recenter(MinCorner) of a wide model succeeded, want error")
+	}
+}
+
+func TestModelDownsample(t *testing.T) {
+	m := Model{X: 3, Y: 2, Z: 1, V: []Voxel{
+		{0, 0, 0, 4}, {1, 0, 0, 3}, {0, 1, 0, 3}, {1, 1, 0, 4}, {0, 0, 0, 0},
+		{2, 1, 0, 7},
+	}}
+	got := m.Downsample(2)
+	want := Model{X: 2, Y: 1, Z: 1, V: []Voxel{{0, 0, 0, 3}, {1, 0, 0, 7}}}
+	if !got.Equal(&want) {
+		t.Errorf("Downsample(2) = %v, want %v", got, want)
+	}
+	if got := m.Downsample(1); !got.Equal(&Model{X: 3, Y: 2, Z: 1, V: []Voxel{{0, 0, 0, 4}, {1, 0, 0, 3}, {0, 1, 0, 3}, {1, 1, 0, 4}, {2, 1, 0, 7}}}) {
+		t.Errorf("Downsample(1) = %v, want the non-empty voxels of %v", got, m)
+	}
+}
+
+func TestMaterialAt(t *testing.T) {
+	main, err := ParseFile("testdata/scene.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := SceneToDenseWorld(main.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for i, idx := range dw.Voxels {
+		if idx == 0 {
+			continue
+		}
+		// Find the coordinates of voxel i.
+		sx, sy := dw.Max[0]-dw.Min[0]+1, dw.Max[1]-dw.Min[1]+1
+		c := [3]int{dw.Min[0] + i%sx, dw.Min[1] + (i/sx)%sy, dw.Min[2] + i/(sx*sy)}
+		mat, ok := main.MaterialAt(dw, c)
+		if !ok || mat != main.Materials[idx] {
+			t.Errorf("MaterialAt(%v) = %v, %v, want %v, true", c, mat, ok, main.Materials[idx])
+		}
+		found = true
+		break
+	}
+	if !found {
+		t.Fatal("world has no voxels")
+	}
+	if _, ok := main.MaterialAt(dw, addVec(dw.Max, [3]int{1, 0, 0})); ok {
+		t.Errorf("MaterialAt(outside the world) succeeded")
+	}
+}
+
+func TestDenseWorldSubWorld(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{-2, -2, -2}, [3]int{2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range dw.Voxels {
+		dw.Voxels[i] = uint8(i)
+	}
+	sub, err := dw.SubWorld([3]int{0, -1, -5}, [3]int{5, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Min != [3]int{0, -1, -2} || sub.Max != [3]int{2, 1, 0} {
+		t.Errorf("SubWorld has cuboid %v-%v, want [0 -1 -2]-[2 1 0]", sub.Min, sub.Max)
+	}
+	for x := sub.Min[0]; x <= sub.Max[0]; x++ {
+		for y := sub.Min[1]; y <= sub.Max[1]; y++ {
+			for z := sub.Min[2]; z <= sub.Max[2]; z++ {
+				c := [3]int{x, y, z}
+				got, _ := sub.MaterialIndex(c)
+				want, _ := dw.MaterialIndex(c)
+				if got != want {
+					t.Errorf("SubWorld voxel %v = %d, want %d", c, got, want)
+				}
+			}
+		}
+	}
+	if _, err := dw.SubWorld([3]int{3, 0, 0}, [3]int{4, 1, 1}); err == nil {
+		t.Errorf("SubWorld outside the world succeeded")
+	}
+}
+
+func TestDenseWorldPaste(t *testing.T) {
+	for _, skipEmpty := range []bool{false, true} {
+		dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{3, 0, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dw.Voxels = []uint8{1, 1, 1, 1}
+		src, err := NewDenseWorld([3]int{-1, 0, 0}, [3]int{1, 0, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		src.Voxels = []uint8{2, 0, 3}
+		// src's voxels land at x = 2, 3 and 4.
+		dw.Paste(src, [3]int{3, 0, 0}, skipEmpty)
+		want := []uint8{1, 1, 2, 0}
+		if skipEmpty {
+			want[3] = 1
+		}
+		if !reflect.DeepEqual(dw.Voxels, want) {
+			t.Errorf("Paste(skipEmpty=%v) gave voxels %v, want %v", skipEmpty, dw.Voxels, want)
+		}
+	}
+}
+
+func TestDenseWorldClear(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{1, 1, 1}, 9)
+	if !dw.Clear([3]int{1, 1, 1}) {
+		t.Errorf("Clear(1, 1, 1) = false, want true")
+	}
+	if idx, _ := dw.MaterialIndex([3]int{1, 1, 1}); !IsEmpty(idx) {
+		t.Errorf("after Clear, voxel has index %d, want empty", idx)
+	}
+	if dw.Clear([3]int{2, 0, 0}) {
+		t.Errorf("Clear outside the world = true, want false")
+	}
+	if IsEmpty(1) {
+		t.Errorf("IsEmpty(1) = true, want false")
+	}
+}
+
+func TestModelMaterialFor(t *testing.T) {
+	main := &Main{Materials: make([]Material, 10)}
+	main.Materials[3] = NewMaterial(MaterialMetal)
+	m := &Model{X: 2, Y: 2, Z: 2}
+	if mat, ok := m.MaterialFor(Voxel{1, 1, 1, 3}, main); !ok || mat.Type != MaterialMetal {
+		t.Errorf("MaterialFor(index 3) = %v, %v; want metal, true", mat, ok)
+	}
+	for _, v := range []Voxel{{0, 0, 0, 0}, {0, 0, 0, 10}, {2, 0, 0, 3}} {
+		if _, ok := m.MaterialFor(v, main); ok {
+			t.Errorf("MaterialFor(%v) = true, want false", v)
+		}
+	}
+}
+
+func TestDenseWorldPad(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{1, 0, 1}, 3)
+	padded, err := dw.Pad(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if padded.Min != [3]int{-2, -2, -2} || padded.Max != [3]int{3, 3, 3} {
+		t.Errorf("padded world is %v-%v, want [-2 -2 -2]-[3 3 3]", padded.Min, padded.Max)
+	}
+	if idx, _ := padded.MaterialIndex([3]int{1, 0, 1}); idx != 3 {
+		t.Errorf("padded world has index %d at (1, 0, 1), want 3", idx)
+	}
+	if n := countNonEmpty(padded); n != 1 {
+		t.Errorf("padded world has %d voxels, want 1", n)
+	}
+	if _, err := dw.Pad(-1); err == nil {
+		t.Errorf("Pad(-1) succeeded, want error")
+	}
+}
+
+func TestForEachTile(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{-1, 0, 0}, [3]int{3, 2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{2, 2, 0}, 4)
+	var origins [][3]int
+	total := 0
+	err = dw.ForEachTile(3, func(tile *DenseWorld, origin [3]int) error {
+		if tile.Min != origin {
+			t.Errorf("tile at %v has min %v", origin, tile.Min)
+		}
+		origins = append(origins, origin)
+		total += len(tile.Voxels)
+		if idx, ok := tile.MaterialIndex([3]int{2, 2, 0}); ok && idx != 4 {
+			t.Errorf("tile at %v has index %d at (2, 2, 0), want 4", origin, idx)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][3]int{{-1, 0, 0}, {2, 0, 0}}; !reflect.DeepEqual(origins, want) {
+		t.Errorf("tiles have origins %v, want %v", origins, want)
+	}
+	if total != len(dw.Voxels) {
+		t.Errorf("tiles have %d voxels in total, want %d", total, len(dw.Voxels))
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = dw.ForEachTile(1, func(*DenseWorld, [3]int) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("ForEachTile returned %v after %d calls, want the callback's error after 1", err, n)
+	}
+	if err := dw.ForEachTile(0, nil); err == nil {
+		t.Errorf("ForEachTile(0) succeeded, want error")
+	}
+}
+
+func TestSwapToYUp(t *testing.T) {
+	m := Model{X: 1, Y: 2, Z: 3, V: []Voxel{{0, 0, 2, 1}, {0, 1, 0, 2}}}
+	got := m.SwapToYUp()
+	want := Model{X: 1, Y: 3, Z: 2, V: []Voxel{{0, 2, 1, 1}, {0, 0, 0, 2}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SwapToYUp() = %v, want %v", got, want)
+	}
+}
+
+func TestMainFromWorld(t *testing.T) {
+	dw, err := NewDenseWorld([3]int{-5, 3, 10}, [3]int{-2, 4, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw.SetMaterialIndex([3]int{-5, 3, 10}, 1)
+	dw.SetMaterialIndex([3]int{-3, 4, 10}, 7)
+	var pal [256]color.RGBA
+	pal[7] = color.RGBA{1, 2, 3, 255}
+	m, err := MainFromWorld(dw, pal, []Material{{}, NewMaterial(MaterialMetal)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("MainFromWorld returned an invalid file: %v", err)
+	}
+	if len(m.Materials) != 256 || m.Materials[1].Type != MaterialMetal || m.Materials[7].Color != pal[7] {
+		t.Errorf("MainFromWorld has the wrong materials")
+	}
+
+	// Encoding and flattening the file gives back the world.
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SceneToDenseWorld(m2.Scene, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, dw) {
+		t.Errorf("flattened file has voxels %v-%v %v, want %v-%v %v", got.Min, got.Max, got.Voxels, dw.Min, dw.Max, dw.Voxels)
+	}
+
+	big, err := NewDenseWorld([3]int{0, 0, 0}, [3]int{256, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MainFromWorld(big, pal, nil); err == nil {
+		t.Errorf("MainFromWorld of a world 257 voxels wide succeeded, want error")
+	}
+}
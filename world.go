@@ -2,6 +2,7 @@ package vox
 
 import (
 	"fmt"
+	"image/color"
 	"math"
 )
 
@@ -13,18 +14,31 @@ type DenseWorld struct {
 	// Voxels[0] is the voxel Min, and the last
 	// element in the slice is the voxel Max.
 	// The elements are stored in X, Y, Z min to max significance.
+	// Each element is a material index, and index 0 means the voxel
+	// is empty.
 	Voxels []uint8
 }
 
+// MaxDenseWorldVoxels is the largest number of voxels that
+// NewDenseWorld will allocate. Larger worlds produce an error
+// rather than an enormous allocation.
+var MaxDenseWorldVoxels = 1 << 30
+
 // NewDenseWorld creates a new dense world for the given cuboid.
 func NewDenseWorld(min, max [3]int) (*DenseWorld, error) {
 	if max[0] < min[0] || max[1] < min[1] || max[2] < min[2] {
 		return nil, fmt.Errorf("the upper bounds of the cuboid %v must be at least as large as the lower bounds %v", max, min)
 	}
-	sx := max[0] - min[0] + 1
-	sy := max[1] - min[1] + 1
-	sz := max[2] - min[2] + 1
-	return &DenseWorld{min, max, make([]uint8, sx*sy*sz)}, nil
+	n := 1
+	for i := 0; i < 3; i++ {
+		// max >= min, so the size can only be non-positive if it overflowed.
+		s := max[i] - min[i] + 1
+		if s <= 0 || n > MaxDenseWorldVoxels/s {
+			return nil, fmt.Errorf("the cuboid %v-%v has more than %d voxels", min, max, MaxDenseWorldVoxels)
+		}
+		n *= s
+	}
+	return &DenseWorld{min, max, make([]uint8, n)}, nil
 }
 
 // Cuboid returns the size of the world.
@@ -54,8 +68,154 @@ func (d *DenseWorld) Resize(min, max [3]int) error {
 	return nil
 }
 
-// MaterialIndex returns the given voxel material.
-func (d *DenseWorld) MaterialIndex(c [3]int) (uint8, bool) {
+// SetColor sets the voxel at c to the palette index in pal whose
+// color is closest to rgba, as chosen by pal.NearestColorIndex.
+// It returns false if c is outside the world, or if the palette
+// has no colors.
+func (d *DenseWorld) SetColor(c [3]int, rgba color.RGBA, pal *Main) bool {
+	idx := pal.NearestColorIndex(rgba)
+	if idx == 0 {
+		return false
+	}
+	return d.SetMaterialIndex(c, idx)
+}
+
+// MaterialAt returns the material of the voxel at c in world, which
+// should have been made from the models in m. It returns false if c
+// is outside the world, the voxel is empty, or m has no material for
+// the voxel's index.
+func (m *Main) MaterialAt(world *DenseWorld, c [3]int) (Material, bool) {
+	idx, ok := world.MaterialIndex(c)
+	if !ok || idx == 0 || int(idx) >= len(m.Materials) {
+		return Material{}, false
+	}
+	return m.Materials[idx], true
+}
+
+// MaterialFor returns the material of the voxel v of m, which should
+// be one of the models in main. Like MaterialAt, it returns false if
+// the voxel is empty or main has no material for its index, and it
+// also returns false if v is outside m.
+func (m *Model) MaterialFor(v Voxel, main *Main) (Material, bool) {
+	if int(v.X) >= m.X || int(v.Y) >= m.Y || int(v.Z) >= m.Z {
+		return Material{}, false
+	}
+	if IsEmpty(v.ColorIndex) || int(v.ColorIndex) >= len(main.Materials) {
+		return Material{}, false
+	}
+	return main.Materials[v.ColorIndex], true
+}
+
+// SubWorld returns a copy of the part of the world inside the cuboid
+// from min to max, clamped to the bounds of d. It returns an error if
+// the cuboid doesn't overlap the world.
+func (d *DenseWorld) SubWorld(min, max [3]int) (*DenseWorld, error) {
+	for i := 0; i < 3; i++ {
+		if min[i] < d.Min[i] {
+			min[i] = d.Min[i]
+		}
+		if max[i] > d.Max[i] {
+			max[i] = d.Max[i]
+		}
+		if max[i] < min[i] {
+			return nil, fmt.Errorf("the cuboid doesn't overlap the world %v-%v", d.Min, d.Max)
+		}
+	}
+	sub, err := NewDenseWorld(min, max)
+	if err != nil {
+		return nil, err
+	}
+	// Copy a row of voxels along the x axis at a time.
+	n := max[0] - min[0] + 1
+	for z := min[2]; z <= max[2]; z++ {
+		for y := min[1]; y <= max[1]; y++ {
+			from, _ := d.index([3]int{min[0], y, z})
+			to, _ := sub.index([3]int{min[0], y, z})
+			copy(sub.Voxels[to:to+n], d.Voxels[from:from+n])
+		}
+	}
+	return sub, nil
+}
+
+// ForEachTile splits the world into cubes of tileSize voxels on each
+// side, starting at d.Min, and calls fn with a copy of each, as made by
+// SubWorld, along with the coordinates of its minimum corner. Tiles at
+// the edges of the world are smaller if the world's size isn't a
+// multiple of tileSize. Tiles are visited in order of z, then y, then
+// x. Changes fn makes to a tile don't change d.
+// If fn returns an error, ForEachTile stops and returns it. It returns
+// an error if tileSize isn't positive.
+func (d *DenseWorld) ForEachTile(tileSize int, fn func(tile *DenseWorld, origin [3]int) error) error {
+	if tileSize < 1 {
+		return fmt.Errorf("tile size must be positive, but is %d", tileSize)
+	}
+	for z := d.Min[2]; z <= d.Max[2]; z += tileSize {
+		for y := d.Min[1]; y <= d.Max[1]; y += tileSize {
+			for x := d.Min[0]; x <= d.Max[0]; x += tileSize {
+				origin := [3]int{x, y, z}
+				tile, err := d.SubWorld(origin, addVec(origin, [3]int{tileSize - 1, tileSize - 1, tileSize - 1}))
+				if err != nil {
+					return err
+				}
+				if err := fn(tile, origin); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Pad returns a copy of the world with amount layers of empty voxels
+// added on every side, so that every non-empty voxel has empty
+// neighbors inside the world. It returns an error if amount is
+// negative, or if the padded world would be too large.
+func (d *DenseWorld) Pad(amount int) (*DenseWorld, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("can't pad a world by %d voxels", amount)
+	}
+	a := [3]int{amount, amount, amount}
+	padded, err := NewDenseWorld(addVec(d.Min, [3]int{-amount, -amount, -amount}), addVec(d.Max, a))
+	if err != nil {
+		return nil, err
+	}
+	padded.Paste(d, [3]int{0, 0, 0}, false)
+	return padded, nil
+}
+
+// Paste copies the voxels of src into d, moving them by at: the voxel
+// at c in src is copied to c+at in d. Voxels that land outside d are
+// dropped. If skipEmpty is true, empty voxels in src aren't copied, so
+// the voxels of d behind them are left as they are.
+func (d *DenseWorld) Paste(src *DenseWorld, at [3]int, skipEmpty bool) {
+	i := 0
+	for z := src.Min[2]; z <= src.Max[2]; z++ {
+		for y := src.Min[1]; y <= src.Max[1]; y++ {
+			for x := src.Min[0]; x <= src.Max[0]; x++ {
+				idx := src.Voxels[i]
+				i++
+				if idx == 0 && skipEmpty {
+					continue
+				}
+				d.SetMaterialIndex([3]int{x + at[0], y + at[1], z + at[2]}, idx)
+			}
+		}
+	}
+}
+
+// Translate moves the world by the given offset, so that the voxel
+// that was at c is now at c+offset. Only the coordinates change, so
+// this is cheap, unlike Resize.
+func (d *DenseWorld) Translate(offset [3]int) {
+	d.Min = addVec(d.Min, offset)
+	d.Max = addVec(d.Max, offset)
+}
+
+// index returns the index in d.Voxels of the voxel c, and
+// whether c is in the world.
+// NewDenseWorld guarantees that SX*SY*SZ fits in an int, so none
+// of the arithmetic here can overflow for coordinates in the world.
+func (d *DenseWorld) index(c [3]int) (int, bool) {
 	SX := d.Max[0] - d.Min[0] + 1
 	SY := d.Max[1] - d.Min[1] + 1
 	SZ := d.Max[2] - d.Min[2] + 1
@@ -68,30 +228,36 @@ func (d *DenseWorld) MaterialIndex(c [3]int) (uint8, bool) {
 		// out of range
 		return 0, false
 	}
+	return z*(SX*SY) + y*SX + x, true
+}
 
-	return d.Voxels[z*(SX*SY)+y*SX+x], true
+// MaterialIndex returns the given voxel material.
+func (d *DenseWorld) MaterialIndex(c [3]int) (uint8, bool) {
+	i, ok := d.index(c)
+	if !ok {
+		return 0, false
+	}
+	return d.Voxels[i], true
 }
 
 // SetMaterialIndex sets the given voxel to the given material index.
-// It reports if the assignment succeeded.
+// It reports if the assignment succeeded. Setting the index to 0 makes
+// the voxel empty, as Clear does.
 func (d *DenseWorld) SetMaterialIndex(c [3]int, matIdx uint8) bool {
-	SX := d.Max[0] - d.Min[0] + 1
-	SY := d.Max[1] - d.Min[1] + 1
-	SZ := d.Max[2] - d.Min[2] + 1
-
-	x := c[0] - d.Min[0]
-	y := c[1] - d.Min[1]
-	z := c[2] - d.Min[2]
-
-	if x < 0 || x >= SX || y < 0 || y >= SY || z < 0 || z >= SZ {
-		// out of range
+	i, ok := d.index(c)
+	if !ok {
 		return false
 	}
-
-	d.Voxels[z*(SX*SY)+y*SX+x] = matIdx
+	d.Voxels[i] = matIdx
 	return true
 }
 
+// Clear makes the given voxel empty. It reports if the voxel is
+// in the world.
+func (d *DenseWorld) Clear(c [3]int) bool {
+	return d.SetMaterialIndex(c, 0)
+}
+
 func addVec(a, b [3]int) [3]int {
 	return [3]int{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
 }
@@ -103,44 +269,75 @@ func abs(x int) int {
 	return x
 }
 
-// DenseWorldFromModel takes a magicavoxel transform and a model, and builds
-// a DenseWorld from it.
-func DenseWorldFromModel(tf TransformFrame, m Model) (*DenseWorld, error) {
-	mat := tf.R
-
+// modelBounds returns the range of coordinates that the model
+// occupies after it's been transformed by tf.
+func modelBounds(tf TransformFrame, m Model) (min, max [3]int) {
 	v := [3]int{m.X, m.Y, m.Z}
-	mv := mat.MulVec(v)
+	mv := tf.R.MulVec(v)
 	mv[0] = abs(mv[0]) - 1
 	mv[1] = abs(mv[1]) - 1
 	mv[2] = abs(mv[2]) - 1
 	// magicvoxel puts the majority of the voxel block on the positive side of the zero axis.
-	min := [3]int{-(mv[0] / 2), -(mv[1] / 2), -(mv[2] / 2)}
-	max := [3]int{mv[0] + min[0], mv[1] + min[1], mv[2] + min[2]}
+	min = [3]int{-(mv[0] / 2), -(mv[1] / 2), -(mv[2] / 2)}
+	max = [3]int{mv[0] + min[0], mv[1] + min[1], mv[2] + min[2]}
 	T := [3]int{int(tf.T[0]), int(tf.T[1]), int(tf.T[2])}
-	min = addVec(min, T)
-	max = addVec(max, T)
-	dw, err := NewDenseWorld(min, max)
-	if err != nil {
-		return nil, err
-	}
+	return addVec(min, T), addVec(max, T)
+}
+
+// modelTranslation returns the translation that, after rotating a
+// model of the given size by tf.R, maps it into world space.
+func modelTranslation(tf TransformFrame, modelSize [3]int) [3]int {
+	min, _ := modelBounds(tf, Model{X: modelSize[0], Y: modelSize[1], Z: modelSize[2]})
 
 	// find the corner of the model that maps to the smallest point.
 	minCorner := [3]int{math.MaxInt64, math.MaxInt64, math.MaxInt64}
 	for i := 0; i <= 1; i++ {
 		for j := 0; j <= 1; j++ {
 			for k := 0; k <= 1; k++ {
-				x := [3]int{i * (m.X - 1), j * (m.Y - 1), k * (m.Z - 1)}
-				mx := mat.MulVec(x)
+				x := [3]int{i * (modelSize[0] - 1), j * (modelSize[1] - 1), k * (modelSize[2] - 1)}
+				mx := tf.R.MulVec(x)
 				if mx[0] <= minCorner[0] && mx[1] <= minCorner[1] && mx[2] <= minCorner[2] {
 					minCorner = mx
 				}
 			}
 		}
 	}
+	return [3]int{min[0] - minCorner[0], min[1] - minCorner[1], min[2] - minCorner[2]}
+}
+
+// ModelToWorld returns the world coordinates of the voxel v of a
+// model of the given size, when the model is placed with the transform
+// tf. It's the mapping that DenseWorldFromModel uses.
+func ModelToWorld(tf TransformFrame, modelSize [3]int, v [3]int) [3]int {
+	return addVec(tf.R.MulVec(v), modelTranslation(tf, modelSize))
+}
+
+// WorldToModel is the inverse of ModelToWorld: it returns the voxel of
+// a model of the given size, placed with the transform tf, that's at
+// the world coordinates w. The result may be outside the model.
+func WorldToModel(tf TransformFrame, modelSize [3]int, w [3]int) [3]int {
+	t := modelTranslation(tf, modelSize)
+	return tf.R.Inverse().MulVec([3]int{w[0] - t[0], w[1] - t[1], w[2] - t[2]})
+}
+
+// DenseWorldFromModel takes a magicavoxel transform and a model, and builds
+// a DenseWorld from it.
+func DenseWorldFromModel(tf TransformFrame, m Model) (*DenseWorld, error) {
+	mat := tf.R
+	min, max := modelBounds(tf, m)
+	dw, err := NewDenseWorld(min, max)
+	if err != nil {
+		return nil, err
+	}
+
 	// The translation that maps the unrotated model into the dense world coordinate space.
-	trn := [3]int{min[0] - minCorner[0], min[1] - minCorner[1], min[2] - minCorner[2]}
+	trn := modelTranslation(tf, [3]int{m.X, m.Y, m.Z})
 
-	for _, vox := range m.V {
+	vs, err := m.decoded()
+	if err != nil {
+		return nil, err
+	}
+	for _, vox := range vs {
 		voxLoc := [3]int{int(vox.X), int(vox.Y), int(vox.Z)}
 		rv := mat.MulVec(voxLoc)
 		rv = addVec(rv, trn)
@@ -152,3 +349,388 @@ func DenseWorldFromModel(tf TransformFrame, m Model) (*DenseWorld, error) {
 
 	return dw, nil
 }
+
+// ToModel returns a model containing the voxels of the world. Voxel
+// Min of the world is voxel (0, 0, 0) of the model. It returns an
+// error if the world is more than 256 voxels in any direction, which
+// is the largest model size that MagicaVoxel supports.
+func (d *DenseWorld) ToModel() (Model, error) {
+	var size [3]int
+	for i := 0; i < 3; i++ {
+		size[i] = d.Max[i] - d.Min[i] + 1
+		if size[i] > 256 {
+			return Model{}, fmt.Errorf("the world %v-%v is too large for a model: its size must be at most 256 in each direction", d.Min, d.Max)
+		}
+	}
+	m := Model{X: size[0], Y: size[1], Z: size[2]}
+	i := 0
+	for z := 0; z < size[2]; z++ {
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				if c := d.Voxels[i]; c != 0 {
+					m.V = append(m.V, Voxel{uint8(x), uint8(y), uint8(z), c})
+				}
+				i++
+			}
+		}
+	}
+	return m, nil
+}
+
+// MainFromWorld returns a file containing a single model with the
+// voxels of the world, in a scene that places the model so that its
+// voxels have the same coordinates as in the world. The palette
+// gives the colors of the materials. mats holds the other properties
+// of the materials, and if it has fewer than 256 entries, the
+// remaining materials are diffuse.
+func MainFromWorld(d *DenseWorld, pal [256]color.RGBA, mats []Material) (*Main, error) {
+	if len(mats) > 256 {
+		return nil, fmt.Errorf("got %d materials, but there can be at most 256", len(mats))
+	}
+	model, err := d.ToModel()
+	if err != nil {
+		return nil, err
+	}
+	m := &Main{
+		Models:    []Model{model},
+		Materials: append([]Material{}, mats...),
+	}
+	for len(m.Materials) < 256 {
+		m.Materials = append(m.Materials, NewMaterial(MaterialDiffuse))
+	}
+	for i := range m.Materials {
+		m.Materials[i].Color = pal[i]
+	}
+	m.Scene = newScene(m.Models)
+	// Models are centered on their translation, rounding down.
+	var t [3]int32
+	for i, n := range [3]int{model.X, model.Y, model.Z} {
+		t[i] = int32(d.Min[i] + (n-1)/2)
+	}
+	tn := m.Scene.Node.Child.(*GroupNode).Children[0].(*TransformNode)
+	tn.Transforms[0].T = t
+	return m, nil
+}
+
+// Rotate returns the model rotated by r. The voxels of the
+// returned model are moved so that their coordinates start at 0, and
+// the size of the model is updated to match the rotation.
+func (m Model) Rotate(r Matrix3x3) Model {
+	return m.transform(r, nil)
+}
+
+// SwapToYUp returns the model rotated from MagicaVoxel's convention,
+// where the Z axis is up, to one where the Y axis is up: the voxel at
+// (x, y, z) moves to (x, z, Y-1-y), where Y is the size of m on the y
+// axis. The returned model's size on the y axis is m's size on the z
+// axis, and vice versa.
+func (m Model) SwapToYUp() Model {
+	return m.Rotate(yUpMatrix)
+}
+
+// transform returns the model rotated by r, with its colors
+// remapped by colorRemap (if it's not nil). Voxels whose color is
+// remapped to 0 are removed.
+func (m Model) transform(r Matrix3x3, colorRemap *[256]uint8) Model {
+	size := r.MulVec([3]int{m.X, m.Y, m.Z})
+	// Each axis of a rotation matrix maps to a single axis, so the
+	// rotated voxels have coordinates between 0 and the rotated far
+	// corner on each axis. The offset moves them back to 0.
+	var offset [3]int
+	far := r.MulVec([3]int{m.X - 1, m.Y - 1, m.Z - 1})
+	for i := range offset {
+		if far[i] < 0 {
+			offset[i] = -far[i]
+		}
+	}
+	vs := m.voxels()
+	rm := Model{X: abs(size[0]), Y: abs(size[1]), Z: abs(size[2]), V: make([]Voxel, 0, len(vs))}
+	for _, v := range vs {
+		c := v.ColorIndex
+		if colorRemap != nil {
+			if c = colorRemap[c]; c == 0 {
+				continue
+			}
+		}
+		rv := addVec(r.MulVec([3]int{int(v.X), int(v.Y), int(v.Z)}), offset)
+		rm.V = append(rm.V, Voxel{uint8(rv[0]), uint8(rv[1]), uint8(rv[2]), c})
+	}
+	return rm
+}
+
+// Transform rotates (or reflects) the model with the given index by r,
+// and if colorRemap isn't nil, changes the color index of each voxel c
+// to colorRemap[c], in a single pass over the voxels. Voxels remapped to
+// index 0 are removed. The model is changed in place, so the scene
+// graph still refers to it. The voxels of the model are moved so
+// that their coordinates start at 0, as Model.Rotate does. If the
+// model was parsed with ParseOptions.LazyModels, its voxels are decoded
+// first, and an error is returned if they are invalid.
+func (m *Main) Transform(modelIndex int, r Matrix3x3, colorRemap *[256]uint8) error {
+	if modelIndex < 0 || modelIndex >= len(m.Models) {
+		return fmt.Errorf("model index %d out of range: there are %d models", modelIndex, len(m.Models))
+	}
+	if !r.Valid() {
+		return fmt.Errorf("invalid rotation matrix %x", uint8(r))
+	}
+	if _, err := m.Models[modelIndex].Voxels(); err != nil {
+		return fmt.Errorf("model %d: %w", modelIndex, err)
+	}
+	m.Models[modelIndex] = m.Models[modelIndex].transform(r, colorRemap)
+	return nil
+}
+
+// Centroid returns the average position of the voxels in m. Each voxel
+// is a unit cube, and its position is its center, so the centroid of
+// a model with a single voxel at (0, 0, 0) is (0.5, 0.5, 0.5). The
+// centroid of a model with no voxels is (0, 0, 0).
+func (m Model) Centroid() [3]float64 {
+	var c [3]float64
+	vs := m.voxels()
+	if len(vs) == 0 {
+		return c
+	}
+	for _, v := range vs {
+		c[0] += float64(v.X)
+		c[1] += float64(v.Y)
+		c[2] += float64(v.Z)
+	}
+	for i := range c {
+		c[i] = c[i]/float64(len(vs)) + 0.5
+	}
+	return c
+}
+
+// BoundingSphere returns a sphere that contains every voxel in m,
+// treating each voxel as a unit cube. The center is the center of the
+// smallest box that contains the voxels, so the sphere is small, but
+// not necessarily the smallest possible. A model with no voxels has
+// a sphere of radius 0 at (0, 0, 0).
+func (m Model) BoundingSphere() (center [3]float64, radius float64) {
+	vs := m.voxels()
+	if len(vs) == 0 {
+		return center, 0
+	}
+	min := [3]int{256, 256, 256}
+	var max [3]int
+	for _, v := range vs {
+		for i, x := range [3]int{int(v.X), int(v.Y), int(v.Z)} {
+			if x < min[i] {
+				min[i] = x
+			}
+			if x+1 > max[i] {
+				max[i] = x + 1
+			}
+		}
+	}
+	for i := range center {
+		center[i] = float64(min[i]+max[i]) / 2
+	}
+	r2 := 0.0
+	for _, v := range vs {
+		d2 := 0.0
+		for i, x := range [3]int{int(v.X), int(v.Y), int(v.Z)} {
+			// The farthest corner of the voxel on this axis.
+			d := math.Max(math.Abs(float64(x)-center[i]), math.Abs(float64(x+1)-center[i]))
+			d2 += d * d
+		}
+		r2 = math.Max(r2, d2)
+	}
+	return center, math.Sqrt(r2)
+}
+
+// PivotMode chooses the point of a model that Recenter makes its pivot.
+type PivotMode int
+
+const (
+	PivotMinCorner PivotMode = iota // The minimum corner of the voxels.
+	PivotCenter                     // The center of the box around the voxels.
+	PivotCentroid                   // The centroid of the voxels.
+)
+
+func (pm PivotMode) String() string {
+	switch pm {
+	case PivotMinCorner:
+		return "MinCorner"
+	case PivotCenter:
+		return "Center"
+	case PivotCentroid:
+		return "Centroid"
+	}
+	return fmt.Sprintf("PivotMode(%d)", int(pm))
+}
+
+// Recenter returns a copy of m with its voxels moved so that the voxel
+// chosen by mode is the model's pivot: the voxel that MagicaVoxel
+// places at the translation of the model's transform, which is the
+// voxel at half the model's size, rounding down (as in
+// DenseWorldFromModel). The returned model is as small as possible, so
+// empty space around the voxels is removed, and space is added on one
+// side of the voxels if that's needed to move the pivot. It also
+// returns the offset by which the voxels were moved: the voxel at v in
+// m is at v+offset in the returned model.
+// The pivot of PivotCenter and PivotCentroid is the voxel that
+// contains the center or centroid. A model with no voxels is returned
+// unchanged. It returns an error if the returned model would be more
+// than 256 voxels in size, or if mode is unknown.
+func (m Model) Recenter(mode PivotMode) (Model, [3]int, error) {
+	var offset [3]int
+	vs, err := m.decoded()
+	if err != nil {
+		return Model{}, offset, err
+	}
+	if len(vs) == 0 {
+		return m, offset, nil
+	}
+	min := [3]int{256, 256, 256}
+	var max [3]int
+	for _, v := range vs {
+		for i, x := range [3]int{int(v.X), int(v.Y), int(v.Z)} {
+			if x < min[i] {
+				min[i] = x
+			}
+			if x > max[i] {
+				max[i] = x
+			}
+		}
+	}
+	var pivot [3]int
+	switch mode {
+	case PivotMinCorner:
+		pivot = min
+	case PivotCenter:
+		for i := range pivot {
+			pivot[i] = (min[i] + max[i]) / 2
+		}
+	case PivotCentroid:
+		c := m.Centroid()
+		for i := range pivot {
+			pivot[i] = int(math.Floor(c[i]))
+		}
+	default:
+		return Model{}, offset, fmt.Errorf("unknown pivot mode %v", mode)
+	}
+	var size [3]int
+	for i := range size {
+		// The pivot of a model of size 2q+1 or 2q+2 is at q, so there
+		// must be room for the voxels below and above it.
+		below, above := pivot[i]-min[i], max[i]-pivot[i]
+		q := below
+		if above-1 > q {
+			q = above - 1
+		}
+		size[i] = 2*q + 1
+		if above > q {
+			size[i]++
+		}
+		if size[i] > 256 {
+			return Model{}, offset, fmt.Errorf("recentering the model on its %v needs a model of size %d", mode, size[i])
+		}
+		offset[i] = q - pivot[i]
+	}
+	r := Model{X: size[0], Y: size[1], Z: size[2], V: make([]Voxel, len(vs))}
+	for i, v := range vs {
+		r.V[i] = Voxel{uint8(int(v.X) + offset[0]), uint8(int(v.Y) + offset[1]), uint8(int(v.Z) + offset[2]), v.ColorIndex}
+	}
+	return r, offset, nil
+}
+
+// VoxelsWithColor returns the voxels in m with the color index idx, in
+// the order they appear in m.V.
+func (m Model) VoxelsWithColor(idx uint8) []Voxel {
+	var r []Voxel
+	for _, v := range m.voxels() {
+		if v.ColorIndex == idx {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// CoordsWithMaterial returns the coordinates of the voxels in d with
+// the material index idx, ordered by z, then y, then x.
+func (d *DenseWorld) CoordsWithMaterial(idx uint8) [][3]int {
+	var r [][3]int
+	i := 0
+	for z := d.Min[2]; z <= d.Max[2]; z++ {
+		for y := d.Min[1]; y <= d.Max[1]; y++ {
+			for x := d.Min[0]; x <= d.Max[0]; x++ {
+				if d.Voxels[i] == idx {
+					r = append(r, [3]int{x, y, z})
+				}
+				i++
+			}
+		}
+	}
+	return r
+}
+
+// occupied returns the set of positions of the non-empty voxels in m.
+func (m Model) occupied() map[[3]int]bool {
+	r := map[[3]int]bool{}
+	for _, v := range m.voxels() {
+		if !IsEmpty(v.ColorIndex) {
+			r[[3]int{int(v.X), int(v.Y), int(v.Z)}] = true
+		}
+	}
+	return r
+}
+
+// Volume returns the number of non-empty voxels in m. Voxels that
+// appear more than once in m.V are counted once.
+func (m Model) Volume() int {
+	return len(m.occupied())
+}
+
+// SurfaceArea returns the number of faces of non-empty voxels in m
+// that aren't shared with another non-empty voxel: the area of the
+// model's surface, including the surface of any holes inside it, with
+// each voxel face having area 1.
+func (m Model) SurfaceArea() int {
+	occ := m.occupied()
+	n := 0
+	for c := range occ {
+		for _, d := range faceDirs {
+			if !occ[addVec(c, d)] {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Downsample returns a smaller version of the model, for use as a level
+// of detail when the model is far away. Each voxel in the returned model
+// covers a block of factor×factor×factor voxels in m, and has the most
+// common color of the non-empty voxels in the block (the smallest
+// color index, if there's a tie). Blocks at the far edges of the model
+// may be partial, if the size of the model isn't a multiple of factor.
+// Downsample panics if factor is less than 1.
+func (m Model) Downsample(factor int) Model {
+	if factor < 1 {
+		panic(fmt.Sprintf("vox: Downsample factor %d must be at least 1", factor))
+	}
+	r := Model{X: (m.X + factor - 1) / factor, Y: (m.Y + factor - 1) / factor, Z: (m.Z + factor - 1) / factor}
+	counts := map[[3]int]*[256]int{}
+	var blocks [][3]int // the non-empty blocks, in the order they're found.
+	for _, v := range m.voxels() {
+		b := [3]int{int(v.X) / factor, int(v.Y) / factor, int(v.Z) / factor}
+		if counts[b] == nil {
+			counts[b] = new([256]int)
+			blocks = append(blocks, b)
+		}
+		counts[b][v.ColorIndex]++
+	}
+	for _, b := range blocks {
+		best, bestN := 0, 0
+		for i, n := range counts[b] {
+			if i != 0 && n > bestN {
+				best, bestN = i, n
+			}
+		}
+		if best != 0 {
+			r.V = append(r.V, Voxel{uint8(b[0]), uint8(b[1]), uint8(b[2]), uint8(best)})
+		}
+	}
+	return r
+}